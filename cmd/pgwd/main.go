@@ -6,6 +6,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -13,13 +14,17 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/hrodrig/pgwd/internal/alert"
 	"github.com/hrodrig/pgwd/internal/config"
 	"github.com/hrodrig/pgwd/internal/kube"
 	"github.com/hrodrig/pgwd/internal/notify"
+	"github.com/hrodrig/pgwd/internal/pgbouncer"
 	"github.com/hrodrig/pgwd/internal/postgres"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -50,39 +55,95 @@ func handleVersion() {
 	}
 }
 
-func parseFlags(cfg *config.Config) (showVersion bool) {
-	showVersionFlag := flag.Bool("version", false, "print version and exit")
-	flag.StringVar(&cfg.DBURL, "db-url", cfg.DBURL, "PostgreSQL connection URL (PGWD_DB_URL)")
-	flag.IntVar(&cfg.ThresholdTotal, "threshold-total", cfg.ThresholdTotal, "Alert when total connections >= N (PGWD_THRESHOLD_TOTAL). Deprecated: use -threshold-levels; will be removed in v1.0.0.")
-	flag.IntVar(&cfg.ThresholdActive, "threshold-active", cfg.ThresholdActive, "Alert when active connections >= N (PGWD_THRESHOLD_ACTIVE). Deprecated: use -threshold-levels; will be removed in v1.0.0.")
-	flag.IntVar(&cfg.ThresholdIdle, "threshold-idle", cfg.ThresholdIdle, "Alert when idle connections >= N (PGWD_THRESHOLD_IDLE)")
-	flag.IntVar(&cfg.StaleAge, "stale-age", cfg.StaleAge, "Consider connection stale if open longer than N seconds (PGWD_STALE_AGE)")
-	flag.IntVar(&cfg.ThresholdStale, "threshold-stale", cfg.ThresholdStale, "Alert when stale connections (open > stale-age) >= N (PGWD_THRESHOLD_STALE)")
-	flag.StringVar(&cfg.SlackWebhook, "slack-webhook", cfg.SlackWebhook, "Slack Incoming Webhook URL (PGWD_SLACK_WEBHOOK)")
-	flag.StringVar(&cfg.LokiURL, "loki-url", cfg.LokiURL, "Loki push API URL, e.g. http://localhost:3100/loki/api/v1/push (PGWD_LOKI_URL)")
-	flag.StringVar(&cfg.LokiLabels, "loki-labels", cfg.LokiLabels, "Loki labels, e.g. app=pgwd,env=prod (PGWD_LOKI_LABELS)")
-	flag.StringVar(&cfg.LokiOrgID, "loki-org-id", cfg.LokiOrgID, "Loki X-Scope-OrgID header (multi-tenancy); for 401 Unauthorized (PGWD_LOKI_ORG_ID)")
-	flag.StringVar(&cfg.LokiBearerToken, "loki-bearer-token", cfg.LokiBearerToken, "Loki Authorization: Bearer token (PGWD_LOKI_BEARER_TOKEN)")
-	flag.IntVar(&cfg.Interval, "interval", cfg.Interval, "Run every N seconds; 0 = run once (PGWD_INTERVAL)")
-	flag.BoolVar(&cfg.DryRun, "dry-run", cfg.DryRun, "Only print, do not send notifications (PGWD_DRY_RUN)")
-	flag.BoolVar(&cfg.ForceNotification, "force-notification", cfg.ForceNotification, "Always send a test notification to validate delivery/format (PGWD_FORCE_NOTIFICATION)")
-	flag.IntVar(&cfg.DefaultThresholdPercent, "default-threshold-percent", cfg.DefaultThresholdPercent, "When one of total/active is 0, set it to this % of max_connections (1-100, default 80) (PGWD_DEFAULT_THRESHOLD_PERCENT)")
-	flag.StringVar(&cfg.ThresholdLevels, "threshold-levels", cfg.ThresholdLevels, "When both total and active are 0: comma-separated percentages for 3-tier alerts, e.g. 75,85,95 (attention/alert/danger). Only highest level fires. (PGWD_THRESHOLD_LEVELS)")
-	flag.StringVar(&cfg.KubePostgres, "kube-postgres", cfg.KubePostgres, "Connect via kubectl port-forward: namespace/type/name (e.g. default/svc/postgres) (PGWD_KUBE_POSTGRES)")
-	flag.StringVar(&cfg.KubeLoki, "kube-loki", cfg.KubeLoki, "Connect to Loki via kubectl port-forward when Loki is inside the cluster: namespace/type/name (e.g. monitoring/svc/loki) (PGWD_KUBE_LOKI)")
-	flag.StringVar(&cfg.KubeContext, "kube-context", cfg.KubeContext, "Kubectl context to use (empty = current context) (PGWD_KUBE_CONTEXT)")
-	flag.IntVar(&cfg.KubeLocalPort, "kube-local-port", cfg.KubeLocalPort, "Local port for kube port-forward (default 5432) (PGWD_KUBE_LOCAL_PORT)")
-	flag.IntVar(&cfg.KubeLokiLocalPort, "kube-loki-local-port", cfg.KubeLokiLocalPort, "Local port for Loki port-forward (default 3100) (PGWD_KUBE_LOKI_LOCAL_PORT)")
-	flag.IntVar(&cfg.KubeLokiRemotePort, "kube-loki-remote-port", cfg.KubeLokiRemotePort, "Remote port on the Loki service (default 3100) (PGWD_KUBE_LOKI_REMOTE_PORT)")
-	flag.StringVar(&cfg.KubePasswordVar, "kube-password-var", cfg.KubePasswordVar, "Pod env var for password when URL has DISCOVER_MY_PASSWORD (default POSTGRES_PASSWORD) (PGWD_KUBE_PASSWORD_VAR)")
-	flag.StringVar(&cfg.KubePasswordContainer, "kube-password-container", cfg.KubePasswordContainer, "Container name in pod for password discovery (PGWD_KUBE_PASSWORD_CONTAINER)")
-	flag.StringVar(&cfg.Cluster, "cluster", cfg.Cluster, "Cluster name for notifications (PGWD_CLUSTER); when -kube-postgres is set, detected from kubeconfig if unset")
-	flag.StringVar(&cfg.Client, "client", cfg.Client, "Client/service/pod name for notifications (PGWD_CLIENT); when -kube-postgres is set, derived from resource (e.g. svc/name) if unset")
-	flag.BoolVar(&cfg.NotifyOnConnectFailure, "notify-on-connect-failure", cfg.NotifyOnConnectFailure, "Send an alert to notifiers when Postgres connection fails (infrastructure alert) (PGWD_NOTIFY_ON_CONNECT_FAILURE)")
-	flag.IntVar(&cfg.TestMaxConnections, "test-max-connections", cfg.TestMaxConnections, "Override server max_connections for defaults and display (for testing alerts; 0 = use server) (PGWD_TEST_MAX_CONNECTIONS)")
-	flag.BoolVar(&cfg.ValidateK8sAccess, "validate-k8s-access", cfg.ValidateK8sAccess, "Validate kubectl connectivity and list pods, then exit. Use -kube-context to select context. (PGWD_VALIDATE_K8S_ACCESS)")
-	flag.Parse()
-	return *showVersionFlag
+// parseFlags binds every flag on fs to cfg (its current values are the defaults) and parses args.
+func parseFlags(fs *flag.FlagSet, args []string, cfg *config.Config) (showVersion bool, err error) {
+	showVersionFlag := fs.Bool("version", false, "print version and exit")
+	fs.StringVar(&cfg.ConfigFile, "config", cfg.ConfigFile, "YAML config file; env and flags override it. Reloaded on SIGHUP (PGWD_CONFIG)")
+	fs.StringVar(&cfg.DBURL, "db-url", cfg.DBURL, "PostgreSQL connection URL (PGWD_DB_URL)")
+	fs.StringVar(&cfg.TargetsFile, "targets", cfg.TargetsFile, "JSON file listing databases to monitor concurrently, each with its own URL, thresholds, labels and notifiers (PGWD_TARGETS)")
+	fs.IntVar(&cfg.CheckTimeout, "check-timeout", cfg.CheckTimeout, "Cancel a check (queries and notifications) after N seconds; 0 = no limit (default 30) (PGWD_CHECK_TIMEOUT)")
+	fs.BoolVar(&cfg.ClusterWide, "cluster-wide", cfg.ClusterWide, "Check every database on the server, each with its own thresholds and events (PGWD_CLUSTER_WIDE)")
+	fs.IntVar(&cfg.ThresholdTotal, "threshold-total", cfg.ThresholdTotal, "Alert when total connections >= N (PGWD_THRESHOLD_TOTAL). Deprecated: use -threshold-levels; will be removed in v1.0.0.")
+	fs.IntVar(&cfg.ThresholdActive, "threshold-active", cfg.ThresholdActive, "Alert when active connections >= N (PGWD_THRESHOLD_ACTIVE). Deprecated: use -threshold-levels; will be removed in v1.0.0.")
+	fs.IntVar(&cfg.ThresholdIdle, "threshold-idle", cfg.ThresholdIdle, "Alert when idle connections >= N (PGWD_THRESHOLD_IDLE)")
+	fs.IntVar(&cfg.StaleAge, "stale-age", cfg.StaleAge, "Consider connection stale if open longer than N seconds (PGWD_STALE_AGE)")
+	fs.IntVar(&cfg.ThresholdStale, "threshold-stale", cfg.ThresholdStale, "Alert when stale connections (open > stale-age) >= N (PGWD_THRESHOLD_STALE)")
+	fs.IntVar(&cfg.ThresholdIdleInTransaction, "threshold-idle-in-transaction", cfg.ThresholdIdleInTransaction, "Alert when sessions idle in transaction (including aborted) >= N (PGWD_THRESHOLD_IDLE_IN_TRANSACTION)")
+	fs.IntVar(&cfg.IdleInTransactionAge, "idle-in-transaction-age", cfg.IdleInTransactionAge, "Alert when a session has been idle in transaction for >= N seconds (PGWD_IDLE_IN_TRANSACTION_AGE)")
+	fs.IntVar(&cfg.ThresholdQueryAge, "threshold-query-age", cfg.ThresholdQueryAge, "Alert when an active query has been running longer than N seconds (query_start) (PGWD_THRESHOLD_QUERY_AGE)")
+	fs.IntVar(&cfg.ThresholdTransactionAge, "threshold-transaction-age", cfg.ThresholdTransactionAge, "Alert when a transaction has been open longer than N seconds (xact_start) (PGWD_THRESHOLD_TRANSACTION_AGE)")
+	fs.IntVar(&cfg.ThresholdBlocked, "threshold-blocked", cfg.ThresholdBlocked, "Alert when sessions blocked by another session's locks >= N; names the root blocker (PGWD_THRESHOLD_BLOCKED)")
+	fs.IntVar(&cfg.ThresholdBlockedWait, "threshold-blocked-wait", cfg.ThresholdBlockedWait, "Alert when a blocked session has been waiting for a lock >= N seconds; names the root blocker (PGWD_THRESHOLD_BLOCKED_WAIT)")
+	fs.IntVar(&cfg.ThresholdRole, "threshold-role", cfg.ThresholdRole, "Alert when a single role (usename) has >= N connections across the server (PGWD_THRESHOLD_ROLE)")
+	fs.StringVar(&cfg.ApplicationThresholds, "application-thresholds", cfg.ApplicationThresholds, "Per-application_name limits, e.g. billing-api:idle=50,web:total=100 (metric: total, active, idle) (PGWD_APPLICATION_THRESHOLDS)")
+	fs.IntVar(&cfg.TopApplications, "top-applications", cfg.TopApplications, "List the N busiest application_name values in every threshold event; 0 = off (default) (PGWD_TOP_APPLICATIONS)")
+	fs.IntVar(&cfg.SnapshotSize, "snapshot-size", cfg.SnapshotSize, "Attach up to N offending sessions (pid, user, application, client, state, age, query) to events; 0 = off (default 5) (PGWD_SNAPSHOT_SIZE)")
+	fs.StringVar(&cfg.PgBouncerURL, "pgbouncer-url", cfg.PgBouncerURL, "PgBouncer admin console URL, e.g. postgres://pgwd@localhost:6432/pgbouncer (PGWD_PGBOUNCER_URL)")
+	fs.IntVar(&cfg.PgBouncerThresholdWaiting, "pgbouncer-threshold-waiting", cfg.PgBouncerThresholdWaiting, "Alert when a PgBouncer pool has >= N waiting clients (cl_waiting) (PGWD_PGBOUNCER_THRESHOLD_WAITING)")
+	fs.IntVar(&cfg.PgBouncerThresholdMaxWait, "pgbouncer-threshold-maxwait", cfg.PgBouncerThresholdMaxWait, "Alert when the oldest waiting client of a PgBouncer pool has waited >= N seconds (maxwait) (PGWD_PGBOUNCER_THRESHOLD_MAXWAIT)")
+	fs.IntVar(&cfg.PgBouncerThresholdClients, "pgbouncer-threshold-clients", cfg.PgBouncerThresholdClients, "Alert when a PgBouncer pool has >= N client connections (cl_active + cl_waiting) (PGWD_PGBOUNCER_THRESHOLD_CLIENTS)")
+	fs.IntVar(&cfg.PgBouncerThresholdServers, "pgbouncer-threshold-servers", cfg.PgBouncerThresholdServers, "Alert when a PgBouncer pool has >= N server connections (PGWD_PGBOUNCER_THRESHOLD_SERVERS)")
+	fs.IntVar(&cfg.RemediateIdleInTransactionAge, "remediate-idle-in-transaction-age", cfg.RemediateIdleInTransactionAge, "Remediation: terminate sessions idle in transaction for longer than N seconds; 0 = off (PGWD_REMEDIATE_IDLE_IN_TRANSACTION_AGE)")
+	fs.BoolVar(&cfg.RemediateStale, "remediate-stale", cfg.RemediateStale, "Remediation: terminate stale sessions (open longer than -stale-age) (PGWD_REMEDIATE_STALE)")
+	fs.StringVar(&cfg.RemediateAction, "remediate-action", cfg.RemediateAction, "Remediation action: terminate (pg_terminate_backend) or cancel (pg_cancel_backend) (default terminate) (PGWD_REMEDIATE_ACTION)")
+	fs.StringVar(&cfg.RemediateRoles, "remediate-roles", cfg.RemediateRoles, "Remediation: only act on these roles, comma-separated; empty = any (PGWD_REMEDIATE_ROLES)")
+	fs.StringVar(&cfg.RemediateApplications, "remediate-applications", cfg.RemediateApplications, "Remediation: only act on these application_name values, comma-separated; empty = any (PGWD_REMEDIATE_APPLICATIONS)")
+	fs.StringVar(&cfg.RemediateExcludeRoles, "remediate-exclude-roles", cfg.RemediateExcludeRoles, "Remediation: never act on these roles, comma-separated (PGWD_REMEDIATE_EXCLUDE_ROLES)")
+	fs.StringVar(&cfg.RemediateExcludeApplications, "remediate-exclude-applications", cfg.RemediateExcludeApplications, "Remediation: never act on these application_name values, comma-separated (PGWD_REMEDIATE_EXCLUDE_APPLICATIONS)")
+	fs.IntVar(&cfg.RemediateMaxKills, "remediate-max-kills", cfg.RemediateMaxKills, "Remediation: act on at most N sessions per run (default 5) (PGWD_REMEDIATE_MAX_KILLS)")
+	fs.BoolVar(&cfg.RemediatePrivileged, "remediate-privileged", cfg.RemediatePrivileged, "Remediation: also act on sessions of superuser and replication roles, skipped by default (PGWD_REMEDIATE_PRIVILEGED)")
+	fs.BoolVar(&cfg.CheckRoleLimits, "check-role-limits", cfg.CheckRoleLimits, "Alert when a role reaches the -threshold-levels percentages of its own rolconnlimit (PGWD_CHECK_ROLE_LIMITS)")
+	fs.IntVar(&cfg.For, "for", cfg.For, "Only notify a threshold once it has been breached continuously for N seconds; 0 = on the first breach (PGWD_FOR)")
+	fs.IntVar(&cfg.ForChecks, "for-checks", cfg.ForChecks, "Only notify a threshold once it has been breached in N consecutive checks (PGWD_FOR_CHECKS)")
+	fs.StringVar(&cfg.ForThresholds, "for-thresholds", cfg.ForThresholds, "Per-threshold -for, e.g. total=300,stale=3checks (N seconds or Nchecks) (PGWD_FOR_THRESHOLDS)")
+	fs.IntVar(&cfg.ResolveHysteresis, "resolve-hysteresis", cfg.ResolveHysteresis, "Send resolved once a firing threshold's value is below the threshold minus N percent of it; 0 = as soon as it is below (PGWD_RESOLVE_HYSTERESIS)")
+	fs.IntVar(&cfg.RepeatInterval, "repeat-interval", cfg.RepeatInterval, "Re-send an ongoing alert after N seconds at the same level; level changes are sent right away; 0 = never (default 3600) (PGWD_REPEAT_INTERVAL)")
+	fs.StringVar(&cfg.SlackWebhook, "slack-webhook", cfg.SlackWebhook, "Slack Incoming Webhook URL (PGWD_SLACK_WEBHOOK)")
+	fs.StringVar(&cfg.TeamsWebhook, "teams-webhook", cfg.TeamsWebhook, "Microsoft Teams Workflows or Incoming Webhook URL (PGWD_TEAMS_WEBHOOK)")
+	fs.StringVar(&cfg.LokiURL, "loki-url", cfg.LokiURL, "Loki push API URL, e.g. http://localhost:3100/loki/api/v1/push (PGWD_LOKI_URL)")
+	fs.StringVar(&cfg.LokiLabels, "loki-labels", cfg.LokiLabels, "Loki labels, e.g. app=pgwd,env=prod (PGWD_LOKI_LABELS)")
+	fs.StringVar(&cfg.LokiOrgID, "loki-org-id", cfg.LokiOrgID, "Loki X-Scope-OrgID header (multi-tenancy); for 401 Unauthorized (PGWD_LOKI_ORG_ID)")
+	fs.StringVar(&cfg.LokiBearerToken, "loki-bearer-token", cfg.LokiBearerToken, "Loki Authorization: Bearer token (PGWD_LOKI_BEARER_TOKEN)")
+	fs.StringVar(&cfg.PagerDutyRoutingKey, "pagerduty-routing-key", cfg.PagerDutyRoutingKey, "PagerDuty Events API v2 integration key (PGWD_PAGERDUTY_ROUTING_KEY)")
+	fs.StringVar(&cfg.PagerDutyURL, "pagerduty-url", cfg.PagerDutyURL, "PagerDuty Events API URL; default https://events.pagerduty.com/v2/enqueue (PGWD_PAGERDUTY_URL)")
+	fs.StringVar(&cfg.WebhookURL, "webhook-url", cfg.WebhookURL, "Generic webhook URL; the body is -webhook-template rendered with the event (PGWD_WEBHOOK_URL)")
+	fs.StringVar(&cfg.WebhookMethod, "webhook-method", cfg.WebhookMethod, "Webhook HTTP method: POST (default), PUT or PATCH (PGWD_WEBHOOK_METHOD)")
+	fs.StringVar(&cfg.WebhookHeaders, "webhook-headers", cfg.WebhookHeaders, "Webhook headers, e.g. Authorization=Bearer xyz,X-Team=dba (PGWD_WEBHOOK_HEADERS)")
+	fs.StringVar(&cfg.WebhookTemplate, "webhook-template", cfg.WebhookTemplate, "Webhook body as a Go text/template over the event; default the event as JSON (PGWD_WEBHOOK_TEMPLATE)")
+	fs.StringVar(&cfg.WebhookSecret, "webhook-secret", cfg.WebhookSecret, "Sign webhook requests with HMAC-SHA256 using this secret (PGWD_WEBHOOK_SECRET)")
+	fs.StringVar(&cfg.EmailSMTPAddr, "email-smtp-addr", cfg.EmailSMTPAddr, "SMTP server host[:port] for email notifications; port defaults to 587, 465 or 25 by -email-tls (PGWD_EMAIL_SMTP_ADDR)")
+	fs.StringVar(&cfg.EmailTLS, "email-tls", cfg.EmailTLS, "SMTP TLS: starttls (default), tls (implicit) or none (PGWD_EMAIL_TLS)")
+	fs.StringVar(&cfg.EmailAuth, "email-auth", cfg.EmailAuth, "SMTP auth mechanism when -email-username is set: plain (default) or login (PGWD_EMAIL_AUTH)")
+	fs.StringVar(&cfg.EmailUsername, "email-username", cfg.EmailUsername, "SMTP username; empty = no auth (PGWD_EMAIL_USERNAME)")
+	fs.StringVar(&cfg.EmailPassword, "email-password", cfg.EmailPassword, "SMTP password (PGWD_EMAIL_PASSWORD)")
+	fs.StringVar(&cfg.EmailFrom, "email-from", cfg.EmailFrom, "Email sender, e.g. \"pgwd <pgwd@example.com>\" (PGWD_EMAIL_FROM)")
+	fs.StringVar(&cfg.EmailTo, "email-to", cfg.EmailTo, "Comma-separated email recipients (PGWD_EMAIL_TO)")
+	fs.StringVar(&cfg.AlertmanagerURL, "alertmanager-url", cfg.AlertmanagerURL, "Comma-separated Alertmanager URLs, e.g. http://alertmanager:9093; events are posted to /api/v2/alerts (PGWD_ALERTMANAGER_URL)")
+	fs.StringVar(&cfg.ExecCommand, "exec-command", cfg.ExecCommand, "Shell command run for each event, with the event as JSON on stdin and PGWD_EVENT_* variables (PGWD_EXEC_COMMAND)")
+	fs.IntVar(&cfg.ExecTimeout, "exec-timeout", cfg.ExecTimeout, "Kill -exec-command after N seconds; 0 = no limit (PGWD_EXEC_TIMEOUT)")
+	fs.IntVar(&cfg.ExecConcurrency, "exec-concurrency", cfg.ExecConcurrency, "Run at most N -exec-command commands at once; 0 = no limit (PGWD_EXEC_CONCURRENCY)")
+	fs.IntVar(&cfg.Interval, "interval", cfg.Interval, "Run every N seconds; 0 = run once (PGWD_INTERVAL)")
+	fs.StringVar(&cfg.StateFile, "state-file", cfg.StateFile, "Keep alert state in this JSON file between runs, for -for, resolved and -repeat-interval in one-shot mode (cron) (PGWD_STATE_FILE)")
+	fs.StringVar(&cfg.SilenceFile, "silence-file", cfg.SilenceFile, "JSON file of silences (maintenance windows) managed with 'pgwd silence add|list|expire'; muted events are logged, not sent (PGWD_SILENCE_FILE)")
+	fs.BoolVar(&cfg.DryRun, "dry-run", cfg.DryRun, "Only print, do not send notifications (PGWD_DRY_RUN)")
+	fs.BoolVar(&cfg.ForceNotification, "force-notification", cfg.ForceNotification, "Always send a test notification to validate delivery/format (PGWD_FORCE_NOTIFICATION)")
+	fs.IntVar(&cfg.DefaultThresholdPercent, "default-threshold-percent", cfg.DefaultThresholdPercent, "When one of total/active is 0, set it to this % of max_connections (1-100, default 80) (PGWD_DEFAULT_THRESHOLD_PERCENT)")
+	fs.StringVar(&cfg.ThresholdLevels, "threshold-levels", cfg.ThresholdLevels, "When both total and active are 0: comma-separated percentages for 3-tier alerts, e.g. 75,85,95 (attention/alert/danger). Only highest level fires. (PGWD_THRESHOLD_LEVELS)")
+	fs.StringVar(&cfg.KubePostgres, "kube-postgres", cfg.KubePostgres, "Connect via kubectl port-forward: namespace/type/name (e.g. default/svc/postgres) (PGWD_KUBE_POSTGRES)")
+	fs.StringVar(&cfg.KubeLoki, "kube-loki", cfg.KubeLoki, "Connect to Loki via kubectl port-forward when Loki is inside the cluster: namespace/type/name (e.g. monitoring/svc/loki) (PGWD_KUBE_LOKI)")
+	fs.StringVar(&cfg.KubeContext, "kube-context", cfg.KubeContext, "Kubectl context to use (empty = current context) (PGWD_KUBE_CONTEXT)")
+	fs.IntVar(&cfg.KubeLocalPort, "kube-local-port", cfg.KubeLocalPort, "Local port for kube port-forward (default 5432) (PGWD_KUBE_LOCAL_PORT)")
+	fs.IntVar(&cfg.KubeLokiLocalPort, "kube-loki-local-port", cfg.KubeLokiLocalPort, "Local port for Loki port-forward (default 3100) (PGWD_KUBE_LOKI_LOCAL_PORT)")
+	fs.IntVar(&cfg.KubeLokiRemotePort, "kube-loki-remote-port", cfg.KubeLokiRemotePort, "Remote port on the Loki service (default 3100) (PGWD_KUBE_LOKI_REMOTE_PORT)")
+	fs.StringVar(&cfg.KubePasswordVar, "kube-password-var", cfg.KubePasswordVar, "Pod env var for password when URL has DISCOVER_MY_PASSWORD (default POSTGRES_PASSWORD) (PGWD_KUBE_PASSWORD_VAR)")
+	fs.StringVar(&cfg.KubePasswordContainer, "kube-password-container", cfg.KubePasswordContainer, "Container name in pod for password discovery (PGWD_KUBE_PASSWORD_CONTAINER)")
+	fs.StringVar(&cfg.Cluster, "cluster", cfg.Cluster, "Cluster name for notifications (PGWD_CLUSTER); when -kube-postgres is set, detected from kubeconfig if unset")
+	fs.StringVar(&cfg.Client, "client", cfg.Client, "Client/service/pod name for notifications (PGWD_CLIENT); when -kube-postgres is set, derived from resource (e.g. svc/name) if unset")
+	fs.BoolVar(&cfg.NotifyOnConnectFailure, "notify-on-connect-failure", cfg.NotifyOnConnectFailure, "Send an alert to notifiers when Postgres connection fails (infrastructure alert) (PGWD_NOTIFY_ON_CONNECT_FAILURE)")
+	fs.IntVar(&cfg.TestMaxConnections, "test-max-connections", cfg.TestMaxConnections, "Override server max_connections for defaults and display (for testing alerts; 0 = use server) (PGWD_TEST_MAX_CONNECTIONS)")
+	fs.BoolVar(&cfg.ValidateK8sAccess, "validate-k8s-access", cfg.ValidateK8sAccess, "Validate kubectl connectivity and list pods, then exit. Use -kube-context to select context. (PGWD_VALIDATE_K8S_ACCESS)")
+	err = fs.Parse(args)
+	return *showVersionFlag, err
 }
 
 func warnDeprecatedThresholds(cfg *config.Config) {
@@ -92,114 +153,70 @@ func warnDeprecatedThresholds(cfg *config.Config) {
 }
 
 func validateConfig(cfg *config.Config) {
-	validateDBURL(cfg)
 	warnDeprecatedThresholds(cfg)
-	validateStale(cfg)
-	validateNotifiers(cfg)
-	validateKubePostgres(cfg)
-	validateKubeLoki(cfg)
-}
-
-func validateDBURL(cfg *config.Config) {
-	if cfg.DBURL == "" {
-		log.Fatal("missing database URL: set PGWD_DB_URL or -db-url")
-	}
-}
-
-func validateStale(cfg *config.Config) {
-	if cfg.ThresholdStale > 0 && cfg.StaleAge <= 0 {
-		log.Fatal("when using threshold-stale, stale-age must be > 0 (PGWD_STALE_AGE or -stale-age)")
-	}
-}
-
-func validateNotifiers(cfg *config.Config) {
-	if !cfg.HasAnyNotifier() && !cfg.DryRun {
-		log.Fatal("no notifier configured: set PGWD_SLACK_WEBHOOK and/or PGWD_LOKI_URL (or -slack-webhook / -loki-url), or use -dry-run")
-	}
-	if cfg.ForceNotification && !cfg.HasAnyNotifier() {
-		log.Fatal("force-notification requires at least one notifier (slack-webhook or loki-url)")
-	}
-	if cfg.NotifyOnConnectFailure && !cfg.HasAnyNotifier() {
-		log.Fatal("notify-on-connect-failure requires at least one notifier (slack-webhook or loki-url)")
-	}
-}
-
-func validateKubePostgres(cfg *config.Config) {
-	if cfg.KubePostgres != "" && cfg.DBURL == "" {
-		log.Fatal("kube-postgres requires PGWD_DB_URL or -db-url (use host localhost and the same port as -kube-local-port)")
-	}
-}
-
-func validateKubeLoki(cfg *config.Config) {
-	if cfg.KubeLoki != "" && cfg.LokiURL != "" {
-		log.Fatal("use -kube-loki OR -loki-url, not both (-loki-url for exposed Loki, -kube-loki when Loki is inside the cluster)")
-	}
-	if cfg.KubeLoki != "" && (cfg.KubeLokiLocalPort < 1 || cfg.KubeLokiLocalPort > 65535) {
-		log.Fatal("kube-loki-local-port must be between 1 and 65535")
-	}
-	if cfg.KubeLoki != "" && (cfg.KubeLokiRemotePort < 1 || cfg.KubeLokiRemotePort > 65535) {
-		log.Fatal("kube-loki-remote-port must be between 1 and 65535")
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
 	}
 }
 
 // setupKube starts port-forward and updates cfg.DBURL when -kube-postgres is set.
 // Returns a cleanup function that must be called on exit (e.g. defer in main).
-func setupKube(ctx context.Context, cfg *config.Config) (cleanup func()) {
+func setupKube(ctx context.Context, cfg *config.Config) (cleanup func(), err error) {
 	if cfg.KubePostgres == "" {
-		return func() {}
+		return func() {}, nil
 	}
 	if err := kube.RequireKubectl(); err != nil {
-		log.Fatalf("kube-postgres: %v", err)
+		return nil, fmt.Errorf("kube-postgres: %w", err)
 	}
 	namespace, resource, err := kube.ParseKubePostgres(cfg.KubePostgres)
 	if err != nil {
-		log.Fatalf("kube-postgres: %v", err)
+		return nil, fmt.Errorf("kube-postgres: %w", err)
 	}
 	if cfg.KubeLocalPort < 1 || cfg.KubeLocalPort > 65535 {
-		log.Fatal("kube-local-port must be between 1 and 65535")
+		return nil, errors.New("kube-local-port must be between 1 and 65535")
 	}
 	password := ""
 	if kube.URLContainsDiscoverPassword(cfg.DBURL) {
 		podName, err := kube.ResolvePod(ctx, cfg.KubeContext, namespace, resource)
 		if err != nil {
-			log.Fatalf("kube resolve pod: %v", err)
+			return nil, fmt.Errorf("kube resolve pod: %w", err)
 		}
 		password, err = kube.GetPasswordFromPod(ctx, cfg.KubeContext, namespace, podName, cfg.KubePasswordContainer, cfg.KubePasswordVar)
 		if err != nil {
-			log.Fatal("kube: could not get password from pod (check namespace, pod name, container, and env var)")
+			return nil, errors.New("kube: could not get password from pod (check namespace, pod name, container, and env var)")
 		}
 	}
 	finalURL, err := kube.ReplaceDBURLForKube(cfg.DBURL, password, cfg.KubeLocalPort)
 	if err != nil {
-		log.Fatal("kube: failed to build DB URL (check -db-url format)")
+		return nil, errors.New("kube: failed to build DB URL (check -db-url format)")
 	}
 	cfg.DBURL = finalURL
 	cleanup, err = kube.StartPortForward(ctx, cfg.KubeContext, namespace, resource, cfg.KubeLocalPort)
 	if err != nil {
-		log.Fatalf("kube port-forward: %v", err)
+		return nil, fmt.Errorf("kube port-forward: %w", err)
 	}
-	return cleanup
+	return cleanup, nil
 }
 
 // setupKubeLoki starts port-forward to Loki when -kube-loki is set and LokiURL is empty.
 // Sets cfg.LokiURL to localhost:port. Returns a cleanup function. Call it on exit.
-func setupKubeLoki(ctx context.Context, cfg *config.Config) (cleanup func()) {
+func setupKubeLoki(ctx context.Context, cfg *config.Config) (cleanup func(), err error) {
 	if cfg.KubeLoki == "" || cfg.LokiURL != "" {
-		return func() {}
+		return func() {}, nil
 	}
 	if err := kube.RequireKubectl(); err != nil {
-		log.Fatalf("kube-loki: %v", err)
+		return nil, fmt.Errorf("kube-loki: %w", err)
 	}
 	namespace, resource, err := kube.ParseKubePostgres(cfg.KubeLoki)
 	if err != nil {
-		log.Fatalf("kube-loki: %v", err)
+		return nil, fmt.Errorf("kube-loki: %w", err)
 	}
 	cfg.LokiURL = fmt.Sprintf("http://127.0.0.1:%d/loki/api/v1/push", cfg.KubeLokiLocalPort)
 	cleanup, err = kube.StartPortForwardTo(ctx, cfg.KubeContext, namespace, resource, cfg.KubeLokiLocalPort, cfg.KubeLokiRemotePort)
 	if err != nil {
-		log.Fatalf("kube-loki port-forward: %v", err)
+		return nil, fmt.Errorf("kube-loki port-forward: %w", err)
 	}
-	return cleanup
+	return cleanup, nil
 }
 
 func runContextStrings(ctx context.Context, cfg *config.Config) (cluster, client, namespace, database string) {
@@ -231,65 +248,229 @@ func runContextStrings(ctx context.Context, cfg *config.Config) (cluster, client
 	return cluster, client, namespace, database
 }
 
+// buildSenders returns the notifiers of cfg: the top-level ones, or with routes one notify.Router that sends
+// each event to the receivers of its route (the top-level notifiers when no route matches).
 func buildSenders(cfg *config.Config) []notify.Sender {
+	senders := receiverSenders(cfg, cfg.DefaultReceiver())
+	if len(cfg.Routes) == 0 {
+		return senders
+	}
+	receivers := make(map[string][]notify.Sender, len(cfg.Receivers))
+	for _, r := range cfg.Receivers {
+		receivers[r.Name] = receiverSenders(cfg, r)
+	}
+	router := &notify.Router{Default: senders}
+	for _, rt := range cfg.Routes {
+		route := notify.Route{Continue: rt.Continue}
+		// Patterns are checked by Validate.
+		route.Level, _ = config.Pattern(rt.Match.Level)
+		route.Threshold, _ = config.Pattern(rt.Match.Threshold)
+		route.Database, _ = config.Pattern(rt.Match.Database)
+		route.Cluster, _ = config.Pattern(rt.Match.Cluster)
+		for _, name := range rt.Receivers {
+			route.Senders = append(route.Senders, receivers[name]...)
+		}
+		router.Routes = append(router.Routes, route)
+	}
+	return []notify.Sender{router}
+}
+
+func receiverSenders(cfg *config.Config, r config.Receiver) []notify.Sender {
 	var senders []notify.Sender
-	if cfg.SlackWebhook != "" {
-		senders = append(senders, &notify.Slack{WebhookURL: cfg.SlackWebhook})
+	if r.SlackWebhook != "" {
+		senders = append(senders, &notify.Slack{WebhookURL: r.SlackWebhook})
 	}
-	if cfg.LokiURL != "" {
+	if r.TeamsWebhook != "" {
+		senders = append(senders, &notify.Teams{WebhookURL: r.TeamsWebhook})
+	}
+	if r.LokiURL != "" {
 		senders = append(senders, &notify.Loki{
-			URL:         cfg.LokiURL,
-			Labels:      notify.ParseLokiLabels(cfg.LokiLabels),
-			OrgID:       cfg.LokiOrgID,
-			BearerToken: cfg.LokiBearerToken,
+			URL:         r.LokiURL,
+			Labels:      notify.ParseLokiLabels(r.LokiLabels),
+			OrgID:       r.LokiOrgID,
+			BearerToken: r.LokiBearerToken,
+		})
+	}
+	if r.PagerDutyRoutingKey != "" {
+		senders = append(senders, &notify.PagerDuty{RoutingKey: r.PagerDutyRoutingKey, URL: r.PagerDutyURL})
+	}
+	if r.WebhookURL != "" {
+		// Headers and template are checked by Validate.
+		headers, _ := notify.ParseWebhookHeaders(r.WebhookHeaders)
+		body, _ := notify.ParseWebhookTemplate(r.WebhookTemplate)
+		senders = append(senders, &notify.Webhook{
+			URL:     r.WebhookURL,
+			Method:  strings.ToUpper(r.WebhookMethod),
+			Headers: headers,
+			Body:    body,
+			Secret:  r.WebhookSecret,
+		})
+	}
+	if r.EmailSMTPAddr != "" {
+		to, _ := notify.ParseEmailAddresses(r.EmailTo) // checked by Validate
+		senders = append(senders, &notify.Email{
+			Addr:     r.EmailSMTPAddr,
+			TLS:      r.EmailTLS,
+			Auth:     r.EmailAuth,
+			Username: r.EmailUsername,
+			Password: r.EmailPassword,
+			From:     r.EmailFrom,
+			To:       to,
+		})
+	}
+	if r.AlertmanagerURL != "" {
+		// Firing alerts stay firing in Alertmanager until pgwd would have re-sent them twice.
+		senders = append(senders, &notify.Alertmanager{
+			URLs:      splitList(r.AlertmanagerURL),
+			EndsAfter: 2 * time.Duration(cfg.RepeatInterval) * time.Second,
+		})
+	}
+	if r.ExecCommand != "" {
+		timeout := r.ExecTimeout
+		if timeout == 0 {
+			timeout = cfg.ExecTimeout
+		}
+		senders = append(senders, &notify.Exec{
+			Command: r.ExecCommand,
+			Timeout: time.Duration(timeout) * time.Second,
+			Slots:   execSlots(cfg.ExecConcurrency),
 		})
 	}
 	return senders
 }
 
-func notifyConnectFailure(ctx context.Context, senders []notify.Sender, cfg *config.Config, cluster, client, ns, db string, connectErr error) {
+// execSlotsMu guards the slots shared by every exec sender, so -exec-concurrency bounds commands across targets
+// and receivers. A reload with a new limit starts a new set of slots.
+var (
+	execSlotsMu    sync.Mutex
+	execSlotsLimit int
+	execSlotsCh    chan struct{}
+)
+
+func execSlots(limit int) chan struct{} {
+	execSlotsMu.Lock()
+	defer execSlotsMu.Unlock()
+	if execSlotsCh == nil || execSlotsLimit != limit {
+		execSlotsLimit, execSlotsCh = limit, notify.NewExecSlots(limit)
+	}
+	return execSlotsCh
+}
+
+// splitList returns the non-empty entries of a comma-separated list.
+func splitList(s string) []string {
+	var list []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
+
+func notifyConnectFailure(ctx context.Context, senders []notify.Sender, cfg *config.Config, target, cluster, client, ns, db string, connectErr error) {
 	if len(senders) == 0 {
 		return
 	}
-	log.Printf("Sending notification…")
 	// Connection failure is urgent: always notify when senders exist, even in dry-run (infrastructure failure must be visible).
-	tooManyClients := connectErr != nil && (strings.Contains(connectErr.Error(), "too many clients") || strings.Contains(connectErr.Error(), "53300"))
+	ev := connectFailureEvent(target, cluster, client, ns, db, connectErr)
+	if len(dropSilenced(cfg, target, []notify.Event{ev})) == 0 {
+		return
+	}
+	log.Printf("Sending notification…")
+	sent := 0
+	for _, s := range senders {
+		if sendErr := s.Send(ctx, ev); sendErr != nil {
+			log.Printf("notify (connect failure): %v", sendErr)
+		} else {
+			sent++
+		}
+	}
+	if sent > 0 {
+		log.Printf("Notification sent")
+	}
+}
+
+// connectFailureEvent is the connect_failure event of connectErr, or too_many_clients when Postgres rejected the
+// connection because max_connections is reached.
+func connectFailureEvent(target, cluster, client, ns, db string, connectErr error) notify.Event {
 	ev := notify.Event{
 		Stats:          postgres.ConnectionStats{},
 		Threshold:      "connect_failure",
 		ThresholdValue: 0,
 		Message:        "pgwd could not connect to Postgres. Check database URL, connectivity, credentials, or infrastructure.",
+		Target:         target,
 		Cluster:        cluster,
 		Client:         client,
 		Namespace:      ns,
 		Database:       db,
 	}
-	if tooManyClients {
+	if connectErr != nil && (strings.Contains(connectErr.Error(), "too many clients") || strings.Contains(connectErr.Error(), "53300")) {
 		ev.Threshold = "too_many_clients"
 		ev.Message = "Postgres rejected connection: too many clients already (max_connections exceeded). Database is saturated — urgent."
 	}
-	sent := 0
-	for _, s := range senders {
-		if sendErr := s.Send(ctx, ev); sendErr != nil {
-			log.Printf("notify (connect failure): %v", sendErr)
-		} else {
-			sent++
-		}
-	}
-	if sent > 0 {
-		log.Printf("Notification sent")
-	}
+	return ev
 }
 
-func applyThresholdDefaults(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config) error {
-	maxConn, maxConnErr := postgres.MaxConnections(ctx, pool)
+// connectFailureEvents are the events of a check that could not reach Postgres: the connect_failure condition,
+// and an unevaluated event that keeps the other alerts as they are until pgwd connects again.
+func connectFailureEvents(target, cluster, client, ns, db string, connectErr error) []notify.Event {
+	return []notify.Event{connectFailureEvent(target, cluster, client, ns, db, connectErr), {Unevaluated: true}}
+}
+
+// isConnectError reports whether err is a failed connection attempt (Postgres down or unreachable, too many
+// clients) rather than a failed query.
+func isConnectError(err error) bool {
+	var connectErr *pgconn.ConnectError
+	return errors.As(err, &connectErr)
+}
+
+// connLimits holds the server connection limits for one check.
+type connLimits struct {
+	Max int // max_connections, or -test-max-connections when set
+	// Effective is Max minus superuser_reserved_connections and reserved_connections (PG16+):
+	// the connections ordinary roles can actually use. Level percentages are relative to it.
+	Effective int
+}
+
+// readConnLimits reads max_connections (replaced by -test-max-connections when set) and the reserved
+// connection settings. The error is from reading max_connections; reserved settings that cannot be
+// read are logged and treated as 0.
+func readConnLimits(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config) (connLimits, error) {
+	maxConn, err := postgres.MaxConnections(ctx, pool)
 	if cfg.TestMaxConnections > 0 {
 		maxConn = cfg.TestMaxConnections
 	}
-	if !cfg.UsesLevelMode() && maxConn > 0 {
-		applySingleThresholdDefaults(cfg, maxConn)
+	if maxConn <= 0 {
+		return connLimits{Max: maxConn, Effective: maxConn}, err
 	}
-	if err := validateThresholdConfig(cfg, maxConn, maxConnErr); err != nil {
+	superuser, reserved, rerr := postgres.ReservedConnections(ctx, pool)
+	if rerr != nil {
+		log.Printf("reserved connections: %v", rerr)
+		superuser, reserved = 0, 0
+	}
+	return newConnLimits(maxConn, superuser, reserved), err
+}
+
+// newConnLimits returns the limits of a server with maxConn connections of which superuser and reserved
+// are kept back. Effective is at least 1 so percentages of it are defined.
+func newConnLimits(maxConn, superuser, reserved int) connLimits {
+	return connLimits{Max: maxConn, Effective: max(maxConn-superuser-reserved, 1)}
+}
+
+// capacityName names the level capacity in messages: "effective max" when reserved connections lower it.
+func (l connLimits) capacityName() string {
+	if l.Effective < l.Max {
+		return "effective max"
+	}
+	return "max"
+}
+
+func applyThresholdDefaults(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config) error {
+	limits, maxConnErr := readConnLimits(ctx, pool, cfg)
+	if !cfg.UsesLevelMode() && limits.Effective > 0 {
+		applySingleThresholdDefaults(cfg, limits.Effective)
+	}
+	if err := validateThresholdConfig(cfg, limits.Max, maxConnErr); err != nil {
 		return err
 	}
 	return nil
@@ -322,7 +503,7 @@ func validateThresholdConfig(cfg *config.Config, maxConn int, maxConnErr error)
 		}
 		return fmt.Errorf("threshold-levels mode requires max_connections; server returned 0")
 	}
-	if cfg.HasAnyThreshold() || cfg.DryRun || cfg.ForceNotification {
+	if cfg.HasAnyThreshold() || cfg.RemediationEnabled() || cfg.DryRun || cfg.ForceNotification {
 		return nil
 	}
 	if maxConnErr != nil {
@@ -364,10 +545,11 @@ func title(s string) string {
 	return strings.ToUpper(s[:1]) + s[1:]
 }
 
-func baseEvent(stats postgres.ConnectionStats, maxConn int, override bool, cluster, client, ns, db string) notify.Event {
+func baseEvent(stats postgres.ConnectionStats, limits connLimits, override bool, cluster, client, ns, db string) notify.Event {
 	return notify.Event{
 		Stats:                    stats,
-		MaxConnections:           maxConn,
+		MaxConnections:           limits.Max,
+		EffectiveMaxConnections:  limits.Effective,
 		MaxConnectionsIsOverride: override,
 		Cluster:                  cluster,
 		Client:                   client,
@@ -376,45 +558,118 @@ func baseEvent(stats postgres.ConnectionStats, maxConn int, override bool, clust
 	}
 }
 
-func collectLevelModeEvent(ev notify.Event, cfg *config.Config, stats postgres.ConnectionStats, maxConn int) *notify.Event {
+// collectLevelModeEvents checks total and active connections against the -threshold-levels percentages of the
+// effective capacity. They are separate conditions, each with its own level, hysteresis and resolved event.
+func collectLevelModeEvents(ev notify.Event, cfg *config.Config, stats postgres.ConnectionStats, limits connLimits) []notify.Event {
 	levels := config.ParseThresholdLevels(cfg.ThresholdLevels)
 	if len(levels) < 3 {
 		return nil
 	}
-	totalPercent := stats.Total * 100 / maxConn
-	activePercent := stats.Active * 100 / maxConn
-	totalLevel := levelFromPercent(totalPercent, levels)
-	activeLevel := levelFromPercent(activePercent, levels)
-	highestLevel := totalLevel
-	threshold := "total"
-	thresholdValue := 0
-	if activeLevel > totalLevel {
-		highestLevel = activeLevel
-		threshold = "active"
-		thresholdValue = (maxConn * levels[activeLevel-1]) / 100
-	} else if totalLevel > 0 {
-		thresholdValue = (maxConn * levels[totalLevel-1]) / 100
-	}
-	if highestLevel == 0 {
-		return nil
-	}
-	val := stats.Total
-	if threshold == "active" {
-		val = stats.Active
+	capacity := limits.Effective
+	var events []notify.Event
+	for _, m := range []struct {
+		threshold, subject string
+		val                int
+	}{
+		{"total", "Total connections", stats.Total},
+		{"active", "Active connections", stats.Active},
+	} {
+		if level := levelFromPercent(m.val*100/capacity, levels); level > 0 {
+			events = append(events, *levelEvent(ev, m.threshold, m.subject, m.val, capacity, limits.capacityName(), level, levels))
+		} else if be := levelBandEvent(ev, cfg, m.threshold, m.subject, m.val, capacity, limits.capacityName(), levels); be != nil {
+			events = append(events, *be)
+		}
 	}
+	return events
+}
+
+// levelEvent builds a 3-tier event: val reached level (1-based index into levels) of capacity.
+// subject starts the message (e.g. "Total connections"); capacityName names capacity in it (e.g. "max").
+func levelEvent(ev notify.Event, threshold, subject string, val, capacity int, capacityName string, level int, levels []int) *notify.Event {
 	e := ev
 	e.Threshold = threshold
-	e.ThresholdValue = thresholdValue
-	e.Level = levelToLabel(highestLevel)
-	e.Message = fmt.Sprintf("%s connections %d >= %d (%d%% of max) — %s", title(threshold), val, thresholdValue, levels[highestLevel-1], e.Level)
+	e.ThresholdValue = (capacity * levels[level-1]) / 100
+	e.Value = val
+	e.Level = levelToLabel(level)
+	e.Message = fmt.Sprintf("%s %d >= %d (%d%% of %s) — %s", subject, val, e.ThresholdValue, levels[level-1], capacityName, e.Level)
 	return &e
 }
 
-func collectExplicitThresholdEvents(ev notify.Event, cfg *config.Config, stats postgres.ConnectionStats, maxConn int) []notify.Event {
+// levelBandEvent returns the BelowThreshold event of a 3-tier check that is under the first level but within
+// -resolve-hysteresis of it, or nil.
+func levelBandEvent(ev notify.Event, cfg *config.Config, threshold, subject string, val, capacity int, capacityName string, levels []int) *notify.Event {
+	e := levelEvent(ev, threshold, subject, val, capacity, capacityName, 1, levels)
+	if val < cfg.ClearLevel(e.ThresholdValue) {
+		return nil
+	}
+	*e = observed(*e, val, true)
+	return e
+}
+
+// reaches reports whether val should produce an event for limit (> 0): at or above it, or below it but within
+// -resolve-hysteresis (an event marked with observed that keeps a firing alert from resolving).
+func reaches(cfg *config.Config, val, limit int) bool {
+	return limit > 0 && val >= cfg.ClearLevel(limit)
+}
+
+// observed sets the value e reports; below marks it as under its threshold (see notify.Event.BelowThreshold).
+func observed(e notify.Event, val int, below bool) notify.Event {
+	e.Value = val
+	if below {
+		e.BelowThreshold = true
+		e.Level = ""
+		e.Message = fmt.Sprintf("%s %d below %d (within resolve-hysteresis)", e.Threshold, val, e.ThresholdValue)
+	}
+	return e
+}
+
+// collectRoleEvents checks per-role connection counts: -threshold-role (count per role) and
+// -check-role-limits (levels against the role's own rolconnlimit). Roles are server-wide.
+func collectRoleEvents(ev notify.Event, cfg *config.Config, roles []postgres.RoleConnectionStats) []notify.Event {
+	var events []notify.Event
+	levels := cfg.RoleLevels()
+	for _, r := range roles {
+		e := ev
+		e.Role = r.Role
+		subject := fmt.Sprintf("Role %s connections", r.Role)
+		if reaches(cfg, r.Total, cfg.ThresholdRole) {
+			re := e
+			re.Threshold = "role"
+			re.ThresholdValue = cfg.ThresholdRole
+			re.Message = fmt.Sprintf("%s %d >= %d", subject, r.Total, cfg.ThresholdRole)
+			events = append(events, observed(re, r.Total, r.Total < cfg.ThresholdRole))
+		}
+		if !cfg.CheckRoleLimits || r.ConnLimit <= 0 {
+			continue
+		}
+		capacityName := fmt.Sprintf("rolconnlimit %d", r.ConnLimit)
+		if level := levelFromPercent(r.Total*100/r.ConnLimit, levels); level > 0 {
+			events = append(events, *levelEvent(e, "role_connlimit", subject, r.Total, r.ConnLimit, capacityName, level, levels))
+		} else if be := levelBandEvent(e, cfg, "role_connlimit", subject, r.Total, r.ConnLimit, capacityName, levels); be != nil {
+			events = append(events, *be)
+		}
+	}
+	return events
+}
+
+func collectRoleChecks(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, ev notify.Event) []notify.Event {
+	if cfg.ThresholdRole <= 0 && !cfg.CheckRoleLimits {
+		return nil
+	}
+	roles, err := postgres.RoleStats(ctx, pool)
+	if err != nil {
+		log.Printf("role stats: %v", err)
+		return unevaluated(ev, "role", "role_connlimit")
+	}
+	return collectRoleEvents(ev, cfg, roles)
+}
+
+func collectExplicitThresholdEvents(ev notify.Event, cfg *config.Config, stats postgres.ConnectionStats, limits connLimits) []notify.Event {
 	var events []notify.Event
 	levels := config.ParseThresholdLevels(config.DefaultThresholdLevels)
+	maxConn := limits.Effective
 	addLevel := maxConn > 0 && len(levels) >= 3
-	if cfg.ThresholdTotal > 0 && stats.Total >= cfg.ThresholdTotal {
+	if reaches(cfg, stats.Total, cfg.ThresholdTotal) {
 		e := ev
 		e.Threshold = "total"
 		e.ThresholdValue = cfg.ThresholdTotal
@@ -422,9 +677,9 @@ func collectExplicitThresholdEvents(ev notify.Event, cfg *config.Config, stats p
 		if addLevel {
 			e.Level = levelToLabel(levelFromPercent(stats.Total*100/maxConn, levels))
 		}
-		events = append(events, e)
+		events = append(events, observed(e, stats.Total, stats.Total < cfg.ThresholdTotal))
 	}
-	if cfg.ThresholdActive > 0 && stats.Active >= cfg.ThresholdActive {
+	if reaches(cfg, stats.Active, cfg.ThresholdActive) {
 		e := ev
 		e.Threshold = "active"
 		e.ThresholdValue = cfg.ThresholdActive
@@ -432,68 +687,330 @@ func collectExplicitThresholdEvents(ev notify.Event, cfg *config.Config, stats p
 		if addLevel {
 			e.Level = levelToLabel(levelFromPercent(stats.Active*100/maxConn, levels))
 		}
-		events = append(events, e)
+		events = append(events, observed(e, stats.Active, stats.Active < cfg.ThresholdActive))
 	}
 	return events
 }
 
-func collectEvents(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, stats postgres.ConnectionStats, maxConn int, cluster, client, ns, db string) []notify.Event {
+func collectEvents(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, stats postgres.ConnectionStats, limits connLimits, cluster, client, ns, db, datname string) []notify.Event {
 	var events []notify.Event
-	ev := baseEvent(stats, maxConn, cfg.TestMaxConnections > 0, cluster, client, ns, db)
+	ev := baseEvent(stats, limits, cfg.TestMaxConnections > 0, cluster, client, ns, db)
+	apps, appsErr := fetchApplications(ctx, pool, cfg, datname)
+	ev.TopApplications = topApplications(apps, cfg.TopApplications)
 
 	if cfg.ThresholdStale > 0 && cfg.StaleAge > 0 {
-		if e := collectStaleEvent(ctx, pool, cfg, ev); e != nil {
+		if e := collectStaleEvent(ctx, pool, cfg, ev, datname); e != nil {
 			events = append(events, *e)
 		}
 	}
-	if cfg.UsesLevelMode() && maxConn > 0 {
-		if e := collectLevelModeEvent(ev, cfg, stats, maxConn); e != nil {
-			events = append(events, *e)
-		}
-	} else {
-		events = append(events, collectExplicitThresholdEvents(ev, cfg, stats, maxConn)...)
+	switch {
+	case cfg.UsesLevelMode() && limits.Effective > 0:
+		events = append(events, collectLevelModeEvents(ev, cfg, stats, limits)...)
+	case cfg.UsesLevelMode():
+		events = append(events, unevaluated(ev, "total", "active")...) // max_connections could not be read
+	default:
+		events = append(events, collectExplicitThresholdEvents(ev, cfg, stats, limits)...)
 	}
-	if cfg.ThresholdIdle > 0 && stats.Idle >= cfg.ThresholdIdle {
+	if reaches(cfg, stats.Idle, cfg.ThresholdIdle) {
 		e := ev
 		e.Threshold = "idle"
 		e.ThresholdValue = cfg.ThresholdIdle
 		e.Message = fmt.Sprintf("Idle connections %d >= %d", stats.Idle, cfg.ThresholdIdle)
-		events = append(events, e)
+		events = append(events, observed(e, stats.Idle, stats.Idle < cfg.ThresholdIdle))
+	}
+	events = append(events, collectIdleInTransactionEvents(ctx, pool, cfg, ev, stats, datname)...)
+	events = append(events, collectLongRunningEvents(ctx, pool, cfg, ev, datname)...)
+	events = append(events, collectBlockingEvents(ctx, pool, cfg, ev, datname)...)
+	if appsErr != nil {
+		events = append(events, unevaluated(ev, "application")...)
+	} else {
+		events = append(events, collectApplicationEvents(ev, cfg, apps)...)
+	}
+	attachSnapshots(ctx, pool, cfg, events, datname)
+	return events
+}
+
+// attachSnapshots adds an offender snapshot (up to -snapshot-size sessions in datname) to events
+// whose threshold has no session list of its own: the sessions most likely responsible for it.
+// With -snapshot-size 0 no event carries sessions (messages still name the oldest offender).
+func attachSnapshots(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, events []notify.Event, datname string) {
+	if cfg.SnapshotSize <= 0 {
+		for i := range events {
+			events[i].Sessions = nil
+		}
+		return
+	}
+	for i := range events {
+		if len(events[i].Sessions) > 0 || events[i].BelowThreshold || events[i].Unevaluated {
+			continue
+		}
+		sessions, _, err := snapshotSessions(ctx, pool, cfg, events[i].Threshold, datname)
+		if err != nil {
+			log.Printf("snapshot (%s): %v", events[i].Threshold, err)
+			continue
+		}
+		events[i].Sessions = sessions
+	}
+}
+
+// snapshotSessions picks the sessions for a threshold: oldest connections for stale/total, longest-running
+// queries for active, longest idle for idle and idle in transaction. Other thresholds get none.
+func snapshotSessions(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, threshold, datname string) ([]postgres.Session, int, error) {
+	n := cfg.SnapshotSize
+	switch threshold {
+	case "stale":
+		return postgres.OldestSessions(ctx, pool, datname, cfg.StaleAge, n)
+	case "total":
+		return postgres.OldestSessions(ctx, pool, datname, 0, n)
+	case "active":
+		return postgres.LongRunningQueries(ctx, pool, datname, 0, n)
+	case "idle":
+		return postgres.IdleSessions(ctx, pool, datname, n)
+	case "idle_in_transaction", "idle_in_transaction_age":
+		return postgres.IdleInTransactionSessions(ctx, pool, datname, 0, n)
+	default:
+		return nil, 0, nil
+	}
+}
+
+// collectIdleInTransactionEvents checks -threshold-idle-in-transaction (count, including aborted)
+// and -idle-in-transaction-age (oldest session, seconds since state_change) in datname.
+func collectIdleInTransactionEvents(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, ev notify.Event, stats postgres.ConnectionStats, datname string) []notify.Event {
+	var events []notify.Event
+	count := stats.IdleInTransaction + stats.IdleInTransactionAborted
+	if reaches(cfg, count, cfg.ThresholdIdleInTransaction) {
+		e := ev
+		e.Threshold = "idle_in_transaction"
+		e.ThresholdValue = cfg.ThresholdIdleInTransaction
+		e.Message = fmt.Sprintf("Idle in transaction connections %d >= %d", count, cfg.ThresholdIdleInTransaction)
+		events = append(events, observed(e, count, count < cfg.ThresholdIdleInTransaction))
+	}
+	if cfg.IdleInTransactionAge <= 0 || count == 0 {
+		return events
 	}
-	if cfg.ForceNotification {
+	age, err := postgres.IdleInTransactionAge(ctx, pool, datname)
+	if err != nil {
+		log.Printf("idle in transaction age: %v", err)
+		return append(events, unevaluated(ev, "idle_in_transaction_age")...)
+	}
+	if reaches(cfg, age, cfg.IdleInTransactionAge) {
 		e := ev
-		e.Threshold = "test"
-		e.ThresholdValue = 0
-		e.Message = "Test notification — delivery check (force-notification)."
-		events = append(events, e)
+		e.Threshold = "idle_in_transaction_age"
+		e.ThresholdValue = cfg.IdleInTransactionAge
+		e.Message = fmt.Sprintf("Idle in transaction for %ds >= %ds (%d session(s) idle in transaction)", age, cfg.IdleInTransactionAge, count)
+		events = append(events, observed(e, age, age < cfg.IdleInTransactionAge))
 	}
 	return events
 }
 
-func collectStaleEvent(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, ev notify.Event) *notify.Event {
-	staleCount, err := postgres.StaleCount(ctx, pool, cfg.StaleAge)
+// fetchApplications returns per-application_name stats for datname when -top-applications or
+// -application-thresholds need them; nil otherwise. Errors are logged.
+func fetchApplications(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, datname string) ([]postgres.ApplicationConnectionStats, error) {
+	if cfg.TopApplications <= 0 && cfg.ApplicationThresholds == "" {
+		return nil, nil
+	}
+	apps, err := postgres.ApplicationStats(ctx, pool, datname)
 	if err != nil {
-		log.Printf("stale count: %v", err)
+		log.Printf("application stats: %v", err)
+		return nil, err
+	}
+	return apps, nil
+}
+
+// topApplications returns the first n entries of apps (already sorted busiest first).
+func topApplications(apps []postgres.ApplicationConnectionStats, n int) []postgres.ApplicationConnectionStats {
+	if n <= 0 {
+		return nil
+	}
+	if len(apps) > n {
+		return apps[:n]
+	}
+	return apps
+}
+
+// collectApplicationEvents checks -application-thresholds against the per-application counts.
+func collectApplicationEvents(ev notify.Event, cfg *config.Config, apps []postgres.ApplicationConnectionStats) []notify.Event {
+	thresholds, err := config.ParseApplicationThresholds(cfg.ApplicationThresholds)
+	if err != nil || len(thresholds) == 0 {
+		return nil
+	}
+	var events []notify.Event
+	for _, t := range thresholds {
+		for _, a := range apps {
+			if a.Application != t.Application {
+				continue
+			}
+			val := applicationMetric(a.ConnectionStats, t.Metric)
+			if !reaches(cfg, val, t.Value) {
+				continue
+			}
+			e := ev
+			e.Threshold = "application"
+			e.ThresholdValue = t.Value
+			e.Application = a.Application
+			e.Metric = t.Metric
+			e.Message = fmt.Sprintf("Application %s %s connections %d >= %d", a.Application, t.Metric, val, t.Value)
+			events = append(events, observed(e, val, val < t.Value))
+		}
+	}
+	return events
+}
+
+func applicationMetric(s postgres.ConnectionStats, metric string) int {
+	switch metric {
+	case "active":
+		return s.Active
+	case "idle":
+		return s.Idle
+	default:
+		return s.Total
+	}
+}
+
+// collectLongRunningEvents checks -threshold-query-age (query_start) and -threshold-transaction-age
+// (xact_start) in datname, next to the stale check (backend_start). Events list the oldest sessions.
+func collectLongRunningEvents(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, ev notify.Event, datname string) []notify.Event {
+	var events []notify.Event
+	if cfg.ThresholdQueryAge > 0 {
+		if e := longRunningEvent(ctx, pool, cfg, ev, datname, postgres.LongRunningQueries, "long_query", "Long-running queries", "running", cfg.ThresholdQueryAge); e != nil {
+			events = append(events, *e)
+		}
+	}
+	if cfg.ThresholdTransactionAge > 0 {
+		if e := longRunningEvent(ctx, pool, cfg, ev, datname, postgres.LongTransactions, "long_transaction", "Long transactions", "open", cfg.ThresholdTransactionAge); e != nil {
+			events = append(events, *e)
+		}
+	}
+	return events
+}
+
+// sessionQuery is a postgres query for sessions older than minSeconds (e.g. postgres.LongRunningQueries).
+type sessionQuery func(ctx context.Context, pool *pgxpool.Pool, database string, minSeconds, limit int) ([]postgres.Session, int, error)
+
+// longRunningEvent runs query for sessions older than limitSeconds. When there are none and -resolve-hysteresis is
+// set, it looks again down to the clear level so a firing alert stays active while the oldest session is close.
+func longRunningEvent(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, ev notify.Event, datname string, query sessionQuery, threshold, subject, verb string, limitSeconds int) *notify.Event {
+	limit := max(cfg.SnapshotSize, 1) // the message names the oldest session even with -snapshot-size 0
+	sessions, n, err := query(ctx, pool, datname, limitSeconds, limit)
+	if err == nil && n == 0 && cfg.ClearLevel(limitSeconds) < limitSeconds {
+		sessions, n, err = query(ctx, pool, datname, cfg.ClearLevel(limitSeconds), 1)
+	}
+	if err != nil {
+		log.Printf("%s: %v", strings.ToLower(subject), err)
+		return &unevaluated(ev, threshold)[0]
+	}
+	if n == 0 || len(sessions) == 0 {
 		return nil
 	}
-	if staleCount < cfg.ThresholdStale {
+	e := sessionsEvent(ev, threshold, subject, verb, limitSeconds, n, sessions)
+	e = observed(e, sessions[0].AgeSeconds, sessions[0].AgeSeconds < limitSeconds)
+	return &e
+}
+
+// sessionsEvent builds an event for n sessions older than limitSeconds; sessions holds the oldest ones.
+func sessionsEvent(ev notify.Event, threshold, subject, verb string, limitSeconds, n int, sessions []postgres.Session) notify.Event {
+	e := ev
+	e.Threshold = threshold
+	e.ThresholdValue = limitSeconds
+	e.Sessions = sessions
+	e.Message = fmt.Sprintf("%s (> %ds): %d", subject, limitSeconds, n)
+	if len(sessions) > 0 {
+		e.Message += fmt.Sprintf(", oldest pid %d %s %ds", sessions[0].PID, verb, sessions[0].AgeSeconds)
+	}
+	return e
+}
+
+// collectBlockingEvents checks -threshold-blocked (count) and -threshold-blocked-wait (longest wait)
+// in datname. Events name the root blocker and how many sessions wait behind it.
+func collectBlockingEvents(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, ev notify.Event, datname string) []notify.Event {
+	if cfg.ThresholdBlocked <= 0 && cfg.ThresholdBlockedWait <= 0 {
+		return nil
+	}
+	st, err := postgres.Blocking(ctx, pool, datname)
+	if err != nil {
+		log.Printf("blocking: %v", err)
+		return unevaluated(ev, "blocked", "blocked_wait")
+	}
+	var events []notify.Event
+	if reaches(cfg, st.Blocked, cfg.ThresholdBlocked) {
+		msg := fmt.Sprintf("Blocked sessions %d >= %d", st.Blocked, cfg.ThresholdBlocked)
+		events = append(events, blockingEvent(ev, "blocked", cfg.ThresholdBlocked, st.Blocked, msg, st))
+	}
+	if st.Blocked > 0 && reaches(cfg, st.LongestWaitSeconds, cfg.ThresholdBlockedWait) {
+		msg := fmt.Sprintf("Blocked session waiting %ds >= %ds (%d blocked)", st.LongestWaitSeconds, cfg.ThresholdBlockedWait, st.Blocked)
+		events = append(events, blockingEvent(ev, "blocked_wait", cfg.ThresholdBlockedWait, st.LongestWaitSeconds, msg, st))
+	}
+	return events
+}
+
+func blockingEvent(ev notify.Event, threshold string, limit, val int, msg string, st postgres.BlockingStats) notify.Event {
+	e := ev
+	e.Threshold = threshold
+	e.ThresholdValue = limit
+	e.Message = msg
+	if r := st.RootBlocker; r != nil {
+		e.Message += fmt.Sprintf("; root blocker pid %d (user %s, state %s, xact age %ds) blocks %d session(s)", r.PID, r.User, r.State, r.AgeSeconds, st.RootBlocked)
+		e.Sessions = []postgres.Session{*r}
+	}
+	return observed(e, val, val < limit)
+}
+
+// unevaluated returns an Unevaluated event for each threshold a check could not evaluate (a failed query), so
+// the tracker keeps their alerts instead of resolving them.
+func unevaluated(ev notify.Event, thresholds ...string) []notify.Event {
+	events := make([]notify.Event, len(thresholds))
+	for i, t := range thresholds {
+		events[i] = ev
+		events[i].Threshold = t
+		events[i].Unevaluated = true
+	}
+	return events
+}
+
+// forceEvent returns the test event sent with -force-notification (once per run, also in cluster-wide mode).
+func forceEvent(stats postgres.ConnectionStats, limits connLimits, cfg *config.Config, cluster, client, ns, db string) notify.Event {
+	e := baseEvent(stats, limits, cfg.TestMaxConnections > 0, cluster, client, ns, db)
+	e.Threshold = "test"
+	e.ThresholdValue = 0
+	e.Message = "Test notification — delivery check (force-notification)."
+	return e
+}
+
+// collectStaleEvent checks stale connections in datname (empty = the database of the connection URL).
+func collectStaleEvent(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, ev notify.Event, datname string) *notify.Event {
+	staleCount, err := postgres.StaleCountDatabase(ctx, pool, datname, cfg.StaleAge)
+	if err != nil {
+		log.Printf("stale count: %v", err)
+		return &unevaluated(ev, "stale")[0]
+	}
+	if !reaches(cfg, staleCount, cfg.ThresholdStale) {
 		return nil
 	}
 	e := ev
 	e.Threshold = "stale"
 	e.ThresholdValue = cfg.ThresholdStale
 	e.Message = fmt.Sprintf("Stale connections (open > %ds): %d >= %d", cfg.StaleAge, staleCount, cfg.ThresholdStale)
+	e = observed(e, staleCount, staleCount < cfg.ThresholdStale)
 	return &e
 }
 
-func sendEvents(ctx context.Context, senders []notify.Sender, cfg *config.Config, events []notify.Event) {
+// sendEvents sends events to every sender (each receiver a router picks, with routes) and returns those at least one
+// sender accepted; dry-run events are not delivered. Silences are applied by the tracker (see alert.Tracker.Evaluate).
+func sendEvents(ctx context.Context, senders []notify.Sender, cfg *config.Config, target string, events []notify.Event) []notify.Event {
+	var delivered []notify.Event
 	for _, ev := range events {
+		ev.Target = target
 		if cfg.DryRun {
 			log.Printf("[dry-run] would send: %s", ev.Message)
 			continue
 		}
+		routed := routedSenders(senders, ev)
+		if len(routed) == 0 {
+			log.Printf("notify: no route matches the %s event and there is no default receiver: %s", ev.Threshold, ev.Message)
+			continue
+		}
 		sent := 0
-		for _, s := range senders {
+		for _, s := range routed {
 			if err := s.Send(ctx, ev); err != nil {
 				log.Printf("notify: %v", err)
 			} else {
@@ -502,41 +1019,432 @@ func sendEvents(ctx context.Context, senders []notify.Sender, cfg *config.Config
 		}
 		if sent > 0 {
 			log.Printf("Notification sent: %s", ev.Message)
+			delivered = append(delivered, ev)
 		}
 	}
+	return delivered
 }
 
-func makeRunFunc(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, senders []notify.Sender, cluster, client, ns, db string) func() {
-	return func() {
-		stats, err := postgres.Stats(ctx, pool)
+// routedSenders replaces each router in senders by the senders it routes ev to, so every receiver's delivery counts
+// on its own: one failing receiver does not make the others send ev again.
+func routedSenders(senders []notify.Sender, ev notify.Event) []notify.Sender {
+	var out []notify.Sender
+	for _, s := range senders {
+		if r, ok := s.(*notify.Router); ok {
+			out = append(out, r.Senders(ev)...)
+		} else {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// newTracker returns the alert tracker of one target (empty in single-database mode): breached thresholds
+// wait for their -for / -for-checks rule before they notify, and ongoing alerts repeat after -repeat-interval.
+func newTracker(target string, cfg *config.Config) *alert.Tracker {
+	t := alert.NewTracker(target, func(threshold string) alert.Rule {
+		r := cfg.ForRule(threshold)
+		return alert.Rule{For: time.Duration(r.Seconds) * time.Second, Checks: r.Checks}
+	})
+	t.RepeatInterval = time.Duration(cfg.RepeatInterval) * time.Second
+	if cfg.StateFile != "" {
+		t.Store = &alert.Store{Path: cfg.StateFile, ReadOnly: cfg.DryRun}
+		if target == "" {
+			t.StateKey = stateKey(cfg)
+		}
+	}
+	return t
+}
+
+// stateKey is the state file section of the single-database mode: host:port/database of -db-url, or the
+// -kube-postgres resource and database (the URL then points at the local port-forward), so one-shot runs
+// watching different databases can share a state file.
+func stateKey(cfg *config.Config) string {
+	u, err := url.Parse(cfg.DBURL)
+	if err != nil {
+		return ""
+	}
+	database := strings.TrimPrefix(u.Path, "/")
+	if cfg.KubePostgres != "" {
+		return "kube:" + cfg.KubeContext + "/" + cfg.KubePostgres + "/" + database
+	}
+	return u.Host + "/" + database
+}
+
+// trackerSet keeps the alert trackers of the targets ("" in single-database mode) across configuration
+// reloads. The zero value is ready to use; it is safe for concurrent use by the targets.
+type trackerSet struct {
+	mu       sync.Mutex
+	byTarget map[string]*alert.Tracker
+}
+
+// tracker returns the tracker of target configured by cfg, continuing the alerts of the target's tracker
+// under the previous configuration.
+func (s *trackerSet) tracker(target string, cfg *config.Config) *alert.Tracker {
+	t := newTracker(target, cfg)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if prev := s.byTarget[target]; prev != nil {
+		t.Continue(prev)
+	}
+	if s.byTarget == nil {
+		s.byTarget = make(map[string]*alert.Tracker)
+	}
+	s.byTarget[target] = t
+	return t
+}
+
+func logPending(pending []*alert.Alert) {
+	for _, a := range pending {
+		log.Printf("Pending for %s (fires after %s): %s", time.Since(a.ActiveSince).Round(time.Second), a.Rule, a.Event.Message)
+	}
+}
+
+// makeRunFunc returns one check: stats, threshold events and notifications for the alerts tracker fires.
+// Each call is bounded by -check-timeout.
+func makeRunFunc(pool *pgxpool.Pool, cfg *config.Config, senders []notify.Sender, tracker *alert.Tracker, cluster, client, ns, db string) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ctx, cancel := checkContext(ctx, cfg)
+		defer cancel()
+		limits, err := readConnLimits(ctx, pool, cfg)
 		if err != nil {
+			log.Printf("max connections: %v", err)
+		}
+		stats, events, err := collectDatabaseEvents(ctx, pool, cfg, limits, cluster, client, ns, db)
+		switch {
+		case err != nil && isConnectError(err):
+			log.Printf("stats: %v", err)
+			events = connectFailureEvents(tracker.Target, cluster, client, ns, db, err)
+		case err != nil:
 			log.Printf("stats: %v", err)
 			return
+		default:
+			ev := baseEvent(stats, limits, cfg.TestMaxConnections > 0, cluster, client, ns, db)
+			events = append(events, collectRoleChecks(ctx, pool, cfg, ev)...)
+			events = append(events, collectPgBouncerEvents(ctx, cfg, cluster, client, ns)...)
+			if cfg.ForceNotification {
+				events = append(events, forceEvent(stats, limits, cfg, cluster, client, ns, db))
+			}
 		}
-		maxConn, _ := postgres.MaxConnections(ctx, pool)
-		if cfg.TestMaxConnections > 0 {
-			maxConn = cfg.TestMaxConnections
+		notifyEvents(ctx, cfg, senders, tracker, events)
+	}
+}
+
+// notifyEvents evaluates the events of one check in tracker and sends those due. Only delivered events count as
+// notified: the others are sent again on the next check.
+func notifyEvents(ctx context.Context, cfg *config.Config, senders []notify.Sender, tracker *alert.Tracker, events []notify.Event) {
+	var pending []*alert.Alert
+	mute := silencer(cfg, tracker.Target)
+	if err := tracker.Sync(func() { events, pending = tracker.Evaluate(events, mute) }); err != nil {
+		log.Printf("Alert state: %v", err)
+	}
+	logPending(pending)
+	if delivered := sendEvents(ctx, senders, cfg, tracker.Target, events); len(delivered) > 0 {
+		if err := tracker.Sync(func() { tracker.Delivered(delivered) }); err != nil {
+			log.Printf("Alert state: %v", err)
 		}
-		if cfg.DryRun {
-			if maxConn > 0 {
-				log.Printf("total=%d active=%d idle=%d max_connections=%d", stats.Total, stats.Active, stats.Idle, maxConn)
-			} else {
-				log.Printf("total=%d active=%d idle=%d", stats.Total, stats.Active, stats.Idle)
+	}
+}
+
+// collectDatabaseEvents fetches stats for the database in the URL, or for every database with -cluster-wide,
+// and returns the (summed) stats and the threshold events.
+func collectDatabaseEvents(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, limits connLimits, cluster, client, ns, db string) (postgres.ConnectionStats, []notify.Event, error) {
+	if !cfg.ClusterWide {
+		stats, err := postgres.Stats(ctx, pool)
+		if err != nil {
+			return stats, nil, err
+		}
+		logDryRunStats(cfg, "", stats, limits)
+		events := collectEvents(ctx, pool, cfg, stats, limits, cluster, client, ns, db, "")
+		budget := cfg.RemediateMaxKills
+		ev := baseEvent(stats, limits, cfg.TestMaxConnections > 0, cluster, client, ns, db)
+		return stats, append(events, remediate(ctx, pool, cfg, ev, "", &budget)...), nil
+	}
+	dbs, err := postgres.DatabaseStats(ctx, pool)
+	if err != nil {
+		return postgres.ConnectionStats{}, nil, err
+	}
+	var stats postgres.ConnectionStats
+	var events []notify.Event
+	budget := cfg.RemediateMaxKills
+	for _, d := range dbs {
+		logDryRunStats(cfg, d.Database, d.ConnectionStats, limits)
+		events = append(events, collectEvents(ctx, pool, cfg, d.ConnectionStats, limits, cluster, client, ns, d.Database, d.Database)...)
+		ev := baseEvent(d.ConnectionStats, limits, cfg.TestMaxConnections > 0, cluster, client, ns, d.Database)
+		events = append(events, remediate(ctx, pool, cfg, ev, d.Database, &budget)...)
+		stats = addStats(stats, d.ConnectionStats)
+	}
+	return stats, events, nil
+}
+
+// pgBouncerThresholds are the per-pool PgBouncer thresholds.
+var pgBouncerThresholds = []string{"pgbouncer_waiting", "pgbouncer_maxwait", "pgbouncer_clients", "pgbouncer_servers"}
+
+// collectPgBouncerEvents reads SHOW POOLS / SHOW CLIENTS from -pgbouncer-url and checks each pool against
+// the PgBouncer thresholds. A failed connection is the pgbouncer_connect_failure condition, so it is
+// deduplicated like a threshold and resolves once pgwd connects again.
+func collectPgBouncerEvents(ctx context.Context, cfg *config.Config, cluster, client, ns string) []notify.Event {
+	if cfg.PgBouncerURL == "" {
+		return nil
+	}
+	ev := notify.Event{Cluster: cluster, Client: client, Namespace: ns}
+	conn, err := pgbouncer.Connect(ctx, cfg.PgBouncerURL)
+	if err != nil {
+		log.Printf("pgbouncer: %v", err)
+		ev.Threshold, ev.Level = "pgbouncer_connect_failure", "danger"
+		ev.Message = "pgwd could not connect to the PgBouncer admin console. Check pgbouncer-url, connectivity, and admin_users/stats_users."
+		return append(unevaluated(ev, pgBouncerThresholds...), ev)
+	}
+	defer conn.Close(ctx)
+	pools, err := pgbouncer.Pools(ctx, conn)
+	if err != nil {
+		log.Printf("pgbouncer: show pools: %v", err)
+		return unevaluated(ev, pgBouncerThresholds...)
+	}
+	var clients []pgbouncer.Client
+	if cfg.PgBouncerThresholdWaiting > 0 || cfg.PgBouncerThresholdMaxWait > 0 {
+		if clients, err = pgbouncer.Clients(ctx, conn); err != nil {
+			log.Printf("pgbouncer: show clients: %v", err)
+		}
+	}
+	var events []notify.Event
+	for _, p := range pools {
+		if p.Database == pgbouncer.AdminDatabase {
+			continue
+		}
+		logDryRunPgBouncerPool(cfg, p)
+		events = append(events, collectPgBouncerPoolEvents(ev, cfg, p, clients)...)
+	}
+	return events
+}
+
+func collectPgBouncerPoolEvents(ev notify.Event, cfg *config.Config, p pgbouncer.Pool, clients []pgbouncer.Client) []notify.Event {
+	var events []notify.Event
+	waiting := oldestWaitingClient(clients, p)
+	if reaches(cfg, p.ClientWaiting, cfg.PgBouncerThresholdWaiting) {
+		msg := fmt.Sprintf("PgBouncer pool %s/%s waiting clients %d >= %d", p.Database, p.User, p.ClientWaiting, cfg.PgBouncerThresholdWaiting)
+		events = append(events, pgBouncerEvent(ev, "pgbouncer_waiting", cfg.PgBouncerThresholdWaiting, p.ClientWaiting, msg+waiting, p))
+	}
+	if reaches(cfg, p.MaxWaitSeconds, cfg.PgBouncerThresholdMaxWait) {
+		msg := fmt.Sprintf("PgBouncer pool %s/%s client waiting %ds >= %ds", p.Database, p.User, p.MaxWaitSeconds, cfg.PgBouncerThresholdMaxWait)
+		events = append(events, pgBouncerEvent(ev, "pgbouncer_maxwait", cfg.PgBouncerThresholdMaxWait, p.MaxWaitSeconds, msg+waiting, p))
+	}
+	if reaches(cfg, p.Clients(), cfg.PgBouncerThresholdClients) {
+		msg := fmt.Sprintf("PgBouncer pool %s/%s client connections %d >= %d (server connections %d)", p.Database, p.User, p.Clients(), cfg.PgBouncerThresholdClients, p.Servers())
+		events = append(events, pgBouncerEvent(ev, "pgbouncer_clients", cfg.PgBouncerThresholdClients, p.Clients(), msg, p))
+	}
+	if reaches(cfg, p.Servers(), cfg.PgBouncerThresholdServers) {
+		msg := fmt.Sprintf("PgBouncer pool %s/%s server connections %d >= %d (client connections %d)", p.Database, p.User, p.Servers(), cfg.PgBouncerThresholdServers, p.Clients())
+		events = append(events, pgBouncerEvent(ev, "pgbouncer_servers", cfg.PgBouncerThresholdServers, p.Servers(), msg, p))
+	}
+	return events
+}
+
+func pgBouncerEvent(ev notify.Event, threshold string, limit, val int, msg string, p pgbouncer.Pool) notify.Event {
+	e := ev
+	e.Threshold = threshold
+	e.ThresholdValue = limit
+	e.Message = msg
+	e.Database = p.Database
+	e.Role = p.User
+	e.PgBouncerPool = &p
+	return observed(e, val, val < limit)
+}
+
+// oldestWaitingClient describes the longest-waiting client of pool p from SHOW CLIENTS, e.g.
+// "; oldest waiting client billing-api 10.0.0.5:51234 waiting 12s"; "" when there is none.
+func oldestWaitingClient(clients []pgbouncer.Client, p pgbouncer.Pool) string {
+	var oldest *pgbouncer.Client
+	for i, c := range clients {
+		if c.Database != p.Database || c.User != p.User || c.State != "waiting" {
+			continue
+		}
+		if oldest == nil || c.WaitSeconds > oldest.WaitSeconds {
+			oldest = &clients[i]
+		}
+	}
+	if oldest == nil {
+		return ""
+	}
+	app := oldest.Application
+	if app == "" {
+		app = "(unnamed)"
+	}
+	return fmt.Sprintf("; oldest waiting client %s %s:%d waiting %ds", app, oldest.Addr, oldest.Port, oldest.WaitSeconds)
+}
+
+// logDryRunPgBouncerPool prints a pool's counts in dry-run mode.
+func logDryRunPgBouncerPool(cfg *config.Config, p pgbouncer.Pool) {
+	if !cfg.DryRun {
+		return
+	}
+	log.Printf("pgbouncer pool=%s/%s cl_active=%d cl_waiting=%d sv_active=%d sv_idle=%d sv_used=%d maxwait=%ds",
+		p.Database, p.User, p.ClientActive, p.ClientWaiting, p.ServerActive, p.ServerIdle, p.ServerUsed, p.MaxWaitSeconds)
+}
+
+// remediationScanLimit bounds how many candidate sessions are read per policy before the
+// allow/deny lists are applied.
+const remediationScanLimit = 1000
+
+// remediate applies the remediation policies in datname: sessions idle in transaction for
+// -remediate-idle-in-transaction-age and, with -remediate-stale, stale sessions. Sessions remediable rejects
+// are skipped; at most *budget sessions are acted on (decremented). With -dry-run nothing is signalled. Each
+// action (or failure) becomes a "remediation" event for the audit trail.
+func remediate(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, ev notify.Event, datname string, budget *int) []notify.Event {
+	if !cfg.RemediationEnabled() {
+		return nil
+	}
+	return remediateSessions(ctx, pool, cfg, ev, datname, budget, remediationPolicies(cfg))
+}
+
+// remediateSessions is remediate with the given policies.
+func remediateSessions(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, ev notify.Event, datname string, budget *int, policies []remediationPolicy) []notify.Event {
+	var events []notify.Event
+	seen := make(map[int]bool)
+	for _, p := range policies {
+		sessions, _, err := p.list(ctx, pool, datname, p.age, remediationScanLimit)
+		if err != nil {
+			log.Printf("remediation (%s): %v", p.reason, err)
+			continue
+		}
+		for _, s := range sessions {
+			if seen[s.PID] || !remediable(cfg, s) {
+				continue
 			}
+			seen[s.PID] = true
+			if *budget <= 0 {
+				log.Printf("remediation: max kills (%d) reached for this run; skipping pid %d (%s)", cfg.RemediateMaxKills, s.PID, p.reason)
+				continue
+			}
+			*budget--
+			events = append(events, remediationEvent(ctx, pool, cfg, ev, s, p))
 		}
-		events := collectEvents(ctx, pool, cfg, stats, maxConn, cluster, client, ns, db)
-		sendEvents(ctx, senders, cfg, events)
 	}
+	return events
+}
+
+// remediable reports whether remediation may act on s: allowed by the role and application lists, not of a
+// superuser or replication role unless -remediate-privileged, and running a query when the action is cancel
+// (pg_cancel_backend does nothing to an idle session).
+func remediable(cfg *config.Config, s postgres.Session) bool {
+	if s.Privileged && !cfg.RemediatePrivileged {
+		return false
+	}
+	if cfg.RemediateAction == "cancel" && s.State != "active" {
+		return false
+	}
+	return cfg.RemediationAllows(s.User, s.Application)
+}
+
+// remediationPolicy is one remediation rule: sessions returned by list older than age seconds.
+type remediationPolicy struct {
+	reason string // e.g. "idle in transaction"
+	age    int
+	list   func(ctx context.Context, pool *pgxpool.Pool, database string, minSeconds, limit int) ([]postgres.Session, int, error)
+}
+
+func remediationPolicies(cfg *config.Config) []remediationPolicy {
+	var policies []remediationPolicy
+	if cfg.RemediateIdleInTransactionAge > 0 {
+		policies = append(policies, remediationPolicy{"idle in transaction", cfg.RemediateIdleInTransactionAge, postgres.IdleInTransactionSessions})
+	}
+	if cfg.RemediateStale && cfg.StaleAge > 0 {
+		policies = append(policies, remediationPolicy{"stale", cfg.StaleAge, postgres.OldestSessions})
+	}
+	return policies
+}
+
+// remediationEvent signals session s (unless -dry-run) and returns the audit event.
+func remediationEvent(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, ev notify.Event, s postgres.Session, p remediationPolicy) notify.Event {
+	e := ev
+	e.Threshold = "remediation"
+	e.ThresholdValue = p.age
+	e.Role = s.User
+	e.Application = s.Application
+	e.Sessions = []postgres.Session{s}
+	app := s.Application
+	if app == "" {
+		app = "(unnamed)"
+	}
+	detail := fmt.Sprintf("pid %d (user %s, application %s, %s %ds > %ds)", s.PID, s.User, app, p.reason, s.AgeSeconds, p.age)
+	if cfg.DryRun {
+		e.Message = fmt.Sprintf("Would %s %s", cfg.RemediateAction, detail)
+		return e
+	}
+	signal := postgres.TerminateBackend
+	if cfg.RemediateAction == "cancel" {
+		signal = postgres.CancelBackend
+	}
+	ok, err := signal(ctx, pool, s)
+	switch {
+	case err != nil:
+		e.Level = "alert"
+		e.Message = fmt.Sprintf("Failed to %s %s: %v", cfg.RemediateAction, detail, err)
+	case !ok:
+		e.Message = fmt.Sprintf("Did not %s %s: session gone or changed state since it was listed", cfg.RemediateAction, detail)
+	default:
+		e.Message = fmt.Sprintf("%s %s", remediationVerb(cfg.RemediateAction), detail)
+	}
+	return e
+}
+
+func remediationVerb(action string) string {
+	if action == "cancel" {
+		return "Cancelled query of"
+	}
+	return "Terminated"
+}
+
+// addStats sums connection counts (cluster-wide totals for the force-notification test event).
+func addStats(a, b postgres.ConnectionStats) postgres.ConnectionStats {
+	return postgres.ConnectionStats{
+		Total:                    a.Total + b.Total,
+		Active:                   a.Active + b.Active,
+		Idle:                     a.Idle + b.Idle,
+		IdleInTransaction:        a.IdleInTransaction + b.IdleInTransaction,
+		IdleInTransactionAborted: a.IdleInTransactionAborted + b.IdleInTransactionAborted,
+		Excluded:                 a.Excluded + b.Excluded,
+	}
+}
+
+// logDryRunStats prints the counts in dry-run mode; database is set in cluster-wide mode.
+func logDryRunStats(cfg *config.Config, database string, stats postgres.ConnectionStats, limits connLimits) {
+	if !cfg.DryRun {
+		return
+	}
+	prefix := ""
+	if database != "" {
+		prefix = "database=" + database + " "
+	}
+	line := fmt.Sprintf("%stotal=%d active=%d idle=%d", prefix, stats.Total, stats.Active, stats.Idle)
+	if n := stats.IdleInTransaction + stats.IdleInTransactionAborted; n > 0 {
+		line += fmt.Sprintf(" idle_in_transaction=%d", n)
+	}
+	if stats.Excluded > 0 {
+		line += fmt.Sprintf(" excluded=%d", stats.Excluded)
+	}
+	if limits.Max > 0 {
+		line += fmt.Sprintf(" max_connections=%d", limits.Max)
+	}
+	if limits.Effective < limits.Max {
+		line += fmt.Sprintf(" effective_max_connections=%d", limits.Effective)
+	}
+	log.Print(line)
 }
 
 func main() {
 	handleVersion()
+	handleSilence()
 
-	cfg := config.FromEnv()
-	if parseFlags(&cfg) {
+	st, err := loadSettings(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if st.showVersion {
 		printVersion()
 		os.Exit(0)
 	}
+	cfg := st.cfg
 	if cfg.ValidateK8sAccess {
 		ctx := context.Background()
 		if err := kube.ValidateKubernetesAccess(ctx, cfg.KubeContext); err != nil {
@@ -544,15 +1452,35 @@ func main() {
 		}
 		os.Exit(0)
 	}
-	validateConfig(&cfg)
+	if err := st.validate(); err != nil {
+		log.Fatal(err)
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	kubeCleanup := setupKube(ctx, &cfg)
+	serveWithReload(ctx, st)
+}
+
+// serve runs the checks for one configuration until ctx is done (or once when -interval is 0):
+// every target of st concurrently, or the single database of -db-url. Alerts continue in trackers.
+// It returns an error when it cannot start: port-forwards, or the first connection in single-database mode.
+func serve(ctx context.Context, st settings, trackers *trackerSet) error {
+	if len(st.targets) > 0 {
+		return runTargets(ctx, &st.cfg, st.targets, trackers)
+	}
+	cfg := st.cfg
+
+	kubeCleanup, err := setupKube(ctx, &cfg)
+	if err != nil {
+		return err
+	}
 	defer kubeCleanup()
 
-	kubeLokiCleanup := setupKubeLoki(ctx, &cfg)
+	kubeLokiCleanup, err := setupKubeLoki(ctx, &cfg)
+	if err != nil {
+		return err
+	}
 	defer kubeLokiCleanup()
 
 	runCluster, runClient, runNamespace, runDatabase := runContextStrings(ctx, &cfg)
@@ -560,28 +1488,42 @@ func main() {
 
 	pool, err := postgres.Pool(ctx, cfg.DBURL)
 	if err != nil {
-		notifyConnectFailure(ctx, senders, &cfg, runCluster, runClient, runNamespace, runDatabase, err)
-		log.Fatal("postgres connect failed (check database URL, connectivity, and credentials)")
+		notifyConnectFailure(ctx, senders, &cfg, "", runCluster, runClient, runNamespace, runDatabase, err)
+		return fmt.Errorf("postgres connect failed (check database URL, connectivity, and credentials): %w", err)
 	}
 	defer pool.Close()
 
 	if err := applyThresholdDefaults(ctx, pool, &cfg); err != nil {
-		notifyConnectFailure(ctx, senders, &cfg, runCluster, runClient, runNamespace, runDatabase, err)
-		log.Fatal(err)
+		notifyConnectFailure(ctx, senders, &cfg, "", runCluster, runClient, runNamespace, runDatabase, err)
+		return err
 	}
-	run := makeRunFunc(ctx, pool, &cfg, senders, runCluster, runClient, runNamespace, runDatabase)
-	run()
-	if cfg.Interval <= 0 {
+	run := makeRunFunc(pool, &cfg, senders, trackers.tracker("", &cfg), runCluster, runClient, runNamespace, runDatabase)
+	every(ctx, cfg.Interval, func() { run(ctx) })
+	return nil
+}
+
+// checkContext bounds one check by -check-timeout (no limit when 0).
+func checkContext(ctx context.Context, cfg *config.Config) (context.Context, context.CancelFunc) {
+	if cfg.CheckTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(cfg.CheckTimeout)*time.Second)
+}
+
+// every calls fn once, then every interval seconds until ctx is done; interval <= 0 means once.
+func every(ctx context.Context, interval int, fn func()) {
+	fn()
+	if interval <= 0 {
 		return
 	}
-	ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Second)
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			run()
+			fn()
 		}
 	}
 }
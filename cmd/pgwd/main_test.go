@@ -0,0 +1,447 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hrodrig/pgwd/internal/config"
+	"github.com/hrodrig/pgwd/internal/notify"
+	"github.com/hrodrig/pgwd/internal/pgbouncer"
+	"github.com/hrodrig/pgwd/internal/postgres"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// summary renders the fields of ev the tests compare: "threshold subject[/metric]=value [level] [below]".
+func summary(ev notify.Event) string {
+	subject := ev.Role + ev.Application
+	if ev.Metric != "" {
+		subject += "/" + ev.Metric
+	}
+	s := fmt.Sprintf("%s %s=%d", ev.Threshold, subject, ev.Value)
+	if ev.Level != "" {
+		s += " " + ev.Level
+	}
+	if ev.BelowThreshold {
+		s += " below"
+	}
+	return s
+}
+
+func summaries(events []notify.Event) []string {
+	out := make([]string, len(events))
+	for i, ev := range events {
+		out[i] = summary(ev)
+	}
+	return out
+}
+
+func TestReaches(t *testing.T) {
+	tests := []struct {
+		hysteresis, val, limit int
+		want                   bool
+	}{
+		{0, 10, 0, false}, // threshold off
+		{0, 100, 100, true},
+		{0, 99, 100, false},
+		{10, 90, 100, true}, // within the hysteresis band
+		{10, 89, 100, false},
+	}
+	for _, tt := range tests {
+		cfg := &config.Config{ResolveHysteresis: tt.hysteresis}
+		if got := reaches(cfg, tt.val, tt.limit); got != tt.want {
+			t.Errorf("reaches(hysteresis %d, %d, %d) = %v, want %v", tt.hysteresis, tt.val, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestLevelEvent(t *testing.T) {
+	levels := []int{75, 85, 95}
+	e := levelEvent(notify.Event{Database: "app"}, "total", "Total connections", 90, 100, "max", 2, levels)
+	if e.Threshold != "total" || e.ThresholdValue != 85 || e.Value != 90 || e.Level != "alert" || e.Database != "app" {
+		t.Errorf("levelEvent = %+v", e)
+	}
+	if want := "Total connections 90 >= 85 (85% of max) — alert"; e.Message != want {
+		t.Errorf("message = %q, want %q", e.Message, want)
+	}
+}
+
+func TestLevelBandEvent(t *testing.T) {
+	levels := []int{75, 85, 95}
+	tests := []struct {
+		hysteresis, val int
+		want            string // "" = no event
+	}{
+		{0, 74, ""},
+		{10, 70, "total =70 below"}, // clear level 75 - 7 = 68
+		{10, 67, ""},
+	}
+	for _, tt := range tests {
+		cfg := &config.Config{ResolveHysteresis: tt.hysteresis}
+		e := levelBandEvent(notify.Event{}, cfg, "total", "Total connections", tt.val, 100, "max", levels)
+		got := ""
+		if e != nil {
+			got = summary(*e)
+		}
+		if got != tt.want {
+			t.Errorf("levelBandEvent(hysteresis %d, %d) = %q, want %q", tt.hysteresis, tt.val, got, tt.want)
+		}
+	}
+}
+
+func TestCollectRoleEvents(t *testing.T) {
+	role := func(name string, total, connLimit int) postgres.RoleConnectionStats {
+		return postgres.RoleConnectionStats{Role: name, ConnLimit: connLimit, ConnectionStats: postgres.ConnectionStats{Total: total}}
+	}
+	tests := []struct {
+		name  string
+		cfg   config.Config
+		roles []postgres.RoleConnectionStats
+		want  []string
+	}{
+		{"count per role", config.Config{ThresholdRole: 10}, []postgres.RoleConnectionStats{role("web", 12, -1), role("batch", 3, -1)},
+			[]string{"role web=12"}},
+		{"role within hysteresis", config.Config{ThresholdRole: 10, ResolveHysteresis: 20}, []postgres.RoleConnectionStats{role("web", 9, -1)},
+			[]string{"role web=9 below"}},
+		{"rolconnlimit levels", config.Config{CheckRoleLimits: true}, []postgres.RoleConnectionStats{role("web", 19, 20), role("batch", 16, 20), role("api", 5, 20)},
+			[]string{"role_connlimit web=19 danger", "role_connlimit batch=16 attention"}},
+		{"no rolconnlimit", config.Config{CheckRoleLimits: true}, []postgres.RoleConnectionStats{role("web", 500, -1)}, []string{}},
+		{"rolconnlimit band", config.Config{CheckRoleLimits: true, ResolveHysteresis: 10}, []postgres.RoleConnectionStats{role("web", 14, 20)},
+			[]string{"role_connlimit web=14 below"}},
+		{"both checks", config.Config{ThresholdRole: 10, CheckRoleLimits: true}, []postgres.RoleConnectionStats{role("web", 18, 20)},
+			[]string{"role web=18", "role_connlimit web=18 alert"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := summaries(collectRoleEvents(notify.Event{}, &tt.cfg, tt.roles))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("collectRoleEvents = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectApplicationEvents(t *testing.T) {
+	apps := []postgres.ApplicationConnectionStats{
+		{Application: "billing-api", ConnectionStats: postgres.ConnectionStats{Total: 60, Active: 5, Idle: 55}},
+		{Application: "web", ConnectionStats: postgres.ConnectionStats{Total: 80, Active: 30, Idle: 50}},
+	}
+	tests := []struct {
+		name       string
+		thresholds string
+		hysteresis int
+		want       []string
+	}{
+		{"idle over", "billing-api:idle=50,web:total=100", 0, []string{"application billing-api/idle=55"}},
+		{"active", "web:active=30", 0, []string{"application web/active=30"}},
+		{"two metrics", "web:total=70,web:idle=40", 0, []string{"application web/total=80", "application web/idle=50"}},
+		{"within hysteresis", "web:total=100", 25, []string{"application web/total=80 below"}},
+		{"unknown application", "reports:total=1", 0, []string{}},
+		{"invalid thresholds", "web", 0, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{ApplicationThresholds: tt.thresholds, ResolveHysteresis: tt.hysteresis}
+			got := summaries(collectApplicationEvents(notify.Event{}, cfg, apps))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("collectApplicationEvents = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectPgBouncerPoolEvents(t *testing.T) {
+	pool := pgbouncer.Pool{Database: "app", User: "web", ClientActive: 10, ClientWaiting: 4, ServerActive: 5, MaxWaitSeconds: 12}
+	clients := []pgbouncer.Client{{User: "web", Database: "app", State: "waiting", Addr: "10.0.0.5", Port: 51234, Application: "billing-api", WaitSeconds: 12}}
+	tests := []struct {
+		name string
+		cfg  config.Config
+		want []string
+	}{
+		{"waiting and maxwait", config.Config{PgBouncerThresholdWaiting: 3, PgBouncerThresholdMaxWait: 10},
+			[]string{"pgbouncer_waiting web=4", "pgbouncer_maxwait web=12"}},
+		{"clients and servers", config.Config{PgBouncerThresholdClients: 14, PgBouncerThresholdServers: 6},
+			[]string{"pgbouncer_clients web=14"}},
+		{"servers within hysteresis", config.Config{PgBouncerThresholdServers: 6, ResolveHysteresis: 20},
+			[]string{"pgbouncer_servers web=5 below"}},
+		{"off", config.Config{}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := collectPgBouncerPoolEvents(notify.Event{Cluster: "prod"}, &tt.cfg, pool, clients)
+			if got := summaries(events); !slices.Equal(got, tt.want) {
+				t.Errorf("collectPgBouncerPoolEvents = %q, want %q", got, tt.want)
+			}
+			for _, e := range events {
+				if e.Database != "app" || e.Cluster != "prod" || e.PgBouncerPool == nil || e.PgBouncerPool.User != "web" {
+					t.Errorf("event %+v should carry the pool", e)
+				}
+			}
+		})
+	}
+	events := collectPgBouncerPoolEvents(notify.Event{}, &config.Config{PgBouncerThresholdWaiting: 3}, pool, clients)
+	if want := "PgBouncer pool app/web waiting clients 4 >= 3; oldest waiting client billing-api 10.0.0.5:51234 waiting 12s"; events[0].Message != want {
+		t.Errorf("message = %q, want %q", events[0].Message, want)
+	}
+}
+
+func TestOldestWaitingClient(t *testing.T) {
+	pool := pgbouncer.Pool{Database: "app", User: "web"}
+	waiting := func(user, db, app string, wait int) pgbouncer.Client {
+		return pgbouncer.Client{User: user, Database: db, State: "waiting", Addr: "10.0.0.5", Port: 51234, Application: app, WaitSeconds: wait}
+	}
+	active := waiting("web", "app", "web", 30)
+	active.State = "active"
+	tests := []struct {
+		name    string
+		clients []pgbouncer.Client
+		want    string
+	}{
+		{"longest wait", []pgbouncer.Client{waiting("web", "app", "web", 3), waiting("web", "app", "billing-api", 12)},
+			"; oldest waiting client billing-api 10.0.0.5:51234 waiting 12s"},
+		{"unnamed", []pgbouncer.Client{waiting("web", "app", "", 2)}, "; oldest waiting client (unnamed) 10.0.0.5:51234 waiting 2s"},
+		{"other pools and states", []pgbouncer.Client{waiting("batch", "app", "etl", 50), waiting("web", "reports", "web", 50), active}, ""},
+		{"none", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := oldestWaitingClient(tt.clients, pool); got != tt.want {
+			t.Errorf("%s: oldestWaitingClient = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRemediationPolicies(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+		want []string
+	}{
+		{"off", config.Config{}, nil},
+		{"idle in transaction", config.Config{RemediateIdleInTransactionAge: 60}, []string{"idle in transaction 60"}},
+		{"stale without age", config.Config{RemediateStale: true}, nil},
+		{"both", config.Config{RemediateIdleInTransactionAge: 60, RemediateStale: true, StaleAge: 3600},
+			[]string{"idle in transaction 60", "stale 3600"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, p := range remediationPolicies(&tt.cfg) {
+			got = append(got, fmt.Sprintf("%s %d", p.reason, p.age))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: remediationPolicies = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// listing returns a remediationPolicy list function that returns sessions.
+func listing(sessions ...postgres.Session) func(context.Context, *pgxpool.Pool, string, int, int) ([]postgres.Session, int, error) {
+	return func(context.Context, *pgxpool.Pool, string, int, int) ([]postgres.Session, int, error) {
+		return sessions, len(sessions), nil
+	}
+}
+
+func TestRemediateSessions_budget(t *testing.T) {
+	session := func(pid int, user string) postgres.Session {
+		return postgres.Session{PID: pid, User: user, Application: "web", State: "idle in transaction", AgeSeconds: 90}
+	}
+	root := session(5, "postgres")
+	root.Privileged = true
+	policies := []remediationPolicy{
+		{"idle in transaction", 60, listing(session(1, "app"), session(2, "app"), root)},
+		{"stale", 3600, listing(session(2, "app"), session(3, "batch"), session(4, "app"))},
+	}
+	cfg := &config.Config{DryRun: true, RemediateAction: "terminate", RemediateMaxKills: 2, RemediateExcludeRoles: "batch"}
+	budget := cfg.RemediateMaxKills
+	events := remediateSessions(context.Background(), nil, cfg, notify.Event{}, "", &budget, policies)
+	var pids []int
+	for _, e := range events {
+		pids = append(pids, e.Sessions[0].PID)
+	}
+	if !slices.Equal(pids, []int{1, 2}) || budget != 0 {
+		t.Fatalf("remediated pids %v with budget %d left, want [1 2] and 0", pids, budget)
+	}
+	if want := "Would terminate pid 1 (user app, application web, idle in transaction 90s > 60s)"; events[0].Message != want {
+		t.Errorf("message = %q, want %q", events[0].Message, want)
+	}
+	if more := remediateSessions(context.Background(), nil, cfg, notify.Event{}, "other", &budget, policies); len(more) != 0 {
+		t.Errorf("a spent budget should stop remediation in the next database, got %q", summaries(more))
+	}
+
+	budget = 10
+	events = remediateSessions(context.Background(), nil, cfg, notify.Event{}, "", &budget, policies)
+	for _, e := range events {
+		if s := e.Sessions[0]; s.Privileged || s.User == "batch" {
+			t.Errorf("pid %d of %s should be skipped", s.PID, s.User)
+		}
+	}
+	if len(events) != 3 || budget != 7 {
+		t.Errorf("remediated %d sessions with budget %d left, want 3 (pids 1, 2, 4) and 7", len(events), budget)
+	}
+}
+
+func TestNewConnLimits(t *testing.T) {
+	tests := []struct {
+		max, superuser, reserved int
+		want                     connLimits
+		capacityName             string
+	}{
+		{100, 0, 0, connLimits{Max: 100, Effective: 100}, "max"},
+		{100, 3, 0, connLimits{Max: 100, Effective: 97}, "effective max"},
+		{100, 3, 5, connLimits{Max: 100, Effective: 92}, "effective max"},
+		{3, 3, 0, connLimits{Max: 3, Effective: 1}, "effective max"}, // never 0
+	}
+	for _, tt := range tests {
+		got := newConnLimits(tt.max, tt.superuser, tt.reserved)
+		if got != tt.want || got.capacityName() != tt.capacityName {
+			t.Errorf("newConnLimits(%d, %d, %d) = %+v (%s), want %+v (%s)", tt.max, tt.superuser, tt.reserved, got, got.capacityName(), tt.want, tt.capacityName)
+		}
+	}
+}
+
+func TestBuildSenders_without_routes(t *testing.T) {
+	cfg := &config.Config{
+		SlackWebhook: "https://hooks.example/slack", AlertmanagerURL: "http://am-0:9093, http://am-1:9093",
+		ExecCommand: "true", ExecTimeout: 10, RepeatInterval: 600,
+	}
+	senders := buildSenders(cfg)
+	if len(senders) != 3 {
+		t.Fatalf("buildSenders = %d senders, want slack, alertmanager and exec", len(senders))
+	}
+	if s, ok := senders[0].(*notify.Slack); !ok || s.WebhookURL != cfg.SlackWebhook {
+		t.Errorf("senders[0] = %#v, want the Slack webhook", senders[0])
+	}
+	if am, ok := senders[1].(*notify.Alertmanager); !ok || len(am.URLs) != 2 || am.EndsAfter != 20*time.Minute {
+		t.Errorf("senders[1] = %#v, want two Alertmanagers with endsAt twice the repeat interval", senders[1])
+	}
+	if e, ok := senders[2].(*notify.Exec); !ok || e.Timeout != 10*time.Second {
+		t.Errorf("senders[2] = %#v, want exec with the top-level timeout", senders[2])
+	}
+}
+
+func TestBuildSenders_routes(t *testing.T) {
+	cfg := &config.Config{
+		SlackWebhook: "https://hooks.example/default",
+		Receivers: []config.Receiver{
+			{Name: "pager", PagerDutyRoutingKey: "R0UT1NG"},
+			{Name: "ops", SlackWebhook: "https://hooks.example/ops", ExecCommand: "true", ExecTimeout: 3},
+		},
+		Routes: []config.Route{
+			{Match: config.RouteMatch{Level: "danger"}, Receivers: []string{"pager", "ops"}, Continue: true},
+			{Match: config.RouteMatch{Threshold: "stale|idle", Database: "app"}, Receivers: []string{"ops"}},
+		},
+		ExecTimeout: 10,
+	}
+	senders := buildSenders(cfg)
+	router, ok := senders[0].(*notify.Router)
+	if len(senders) != 1 || !ok {
+		t.Fatalf("buildSenders = %#v, want one router", senders)
+	}
+	if len(router.Default) != 1 || router.Default[0].(*notify.Slack).WebhookURL != "https://hooks.example/default" {
+		t.Errorf("default = %#v, want the top-level Slack webhook", router.Default)
+	}
+	if len(router.Routes) != 2 {
+		t.Fatalf("routes = %d, want 2", len(router.Routes))
+	}
+	checkDangerRoute(t, router.Routes[0])
+	checkStaleRoute(t, router.Routes[1])
+}
+
+func checkDangerRoute(t *testing.T, danger notify.Route) {
+	t.Helper()
+	if len(danger.Senders) != 3 || !danger.Continue || !danger.Level.MatchString("danger") || danger.Level.MatchString("dangerous") || danger.Threshold != nil {
+		t.Errorf("route 0 = %+v, want pager and ops for level danger, continuing", danger)
+	}
+	if _, ok := danger.Senders[0].(*notify.PagerDuty); !ok {
+		t.Errorf("route 0 senders[0] = %#v, want PagerDuty", danger.Senders[0])
+	}
+	if e, ok := danger.Senders[2].(*notify.Exec); !ok || e.Timeout != 3*time.Second {
+		t.Errorf("route 0 senders[2] = %#v, want the receiver's exec timeout", danger.Senders[2])
+	}
+}
+
+func checkStaleRoute(t *testing.T, stale notify.Route) {
+	t.Helper()
+	if len(stale.Senders) != 2 || stale.Continue || !stale.Threshold.MatchString("idle") || stale.Threshold.MatchString("idle_in_transaction") ||
+		!stale.Database.MatchString("app") || stale.Level != nil {
+		t.Errorf("route 1 = %+v, want ops for stale|idle in app", stale)
+	}
+	if !strings.HasPrefix(stale.Senders[0].(*notify.Slack).WebhookURL, "https://hooks.example/ops") {
+		t.Errorf("route 1 senders[0] = %#v, want the ops webhook", stale.Senders[0])
+	}
+}
+
+// fakeSender records the events it is sent and fails them with err.
+type fakeSender struct {
+	events []string
+	err    error
+}
+
+func (f *fakeSender) Send(_ context.Context, ev notify.Event) error {
+	f.events = append(f.events, ev.Threshold)
+	return f.err
+}
+
+func TestSendEvents_routes_per_receiver(t *testing.T) {
+	ok, failing := &fakeSender{}, &fakeSender{err: errors.New("smtp: connection refused")}
+	router := &notify.Router{Routes: []notify.Route{{Level: regexp.MustCompile("^(?:danger)$"), Senders: []notify.Sender{failing, ok}}}}
+	events := []notify.Event{{Threshold: "total", Level: "danger"}, {Threshold: "idle", Level: "attention"}}
+	delivered := sendEvents(context.Background(), []notify.Sender{router}, &config.Config{}, "billing", events)
+	if len(delivered) != 1 || delivered[0].Threshold != "total" || delivered[0].Target != "billing" {
+		t.Errorf("delivered = %+v, want the danger event the working receiver accepted", delivered)
+	}
+	if !slices.Equal(ok.events, []string{"total"}) || !slices.Equal(failing.events, []string{"total"}) {
+		t.Errorf("ok got %q, failing got %q; want the danger event once each", ok.events, failing.events)
+	}
+	if delivered := sendEvents(context.Background(), []notify.Sender{failing}, &config.Config{}, "", events[:1]); len(delivered) != 0 {
+		t.Errorf("delivered = %+v, want none when every sender fails", delivered)
+	}
+}
+
+func TestConnectFailureEvent(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{errors.New("dial tcp 10.0.0.5:5432: connect: connection refused"), "connect_failure"},
+		{errors.New("FATAL: sorry, too many clients already (SQLSTATE 53300)"), "too_many_clients"},
+	}
+	for _, tt := range tests {
+		e := connectFailureEvent("billing", "prod", "vm-1", "", "app", tt.err)
+		if e.Threshold != tt.want || e.Target != "billing" || e.Database != "app" {
+			t.Errorf("connectFailureEvent(%v) = %+v, want %s", tt.err, e, tt.want)
+		}
+	}
+}
+
+func TestIsConnectError(t *testing.T) {
+	if isConnectError(errors.New("permission denied for table pg_stat_activity")) {
+		t.Error("a failed query is not a connect error")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	pool, err := postgres.Pool(ctx, "postgres://pgwd@127.0.0.1:1/app?connect_timeout=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	if _, err := postgres.Stats(ctx, pool); !isConnectError(err) {
+		t.Errorf("isConnectError(%v) = false, want true for an unreachable server", err)
+	}
+}
+
+func TestNotifyEvents_connect_failure_once(t *testing.T) {
+	sender := &fakeSender{}
+	tracker := newTracker("billing", &config.Config{})
+	for range 3 {
+		notifyEvents(context.Background(), &config.Config{}, []notify.Sender{sender}, tracker,
+			connectFailureEvents("billing", "", "", "", "app", errors.New("connection refused")))
+	}
+	if !slices.Equal(sender.events, []string{"connect_failure"}) {
+		t.Errorf("sent %q, want one connect_failure while the target stays down", sender.events)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hrodrig/pgwd/internal/config"
+)
+
+// settings is one loaded configuration: the base config and the targets from the config file or
+// -targets (none = monitor -db-url only).
+type settings struct {
+	cfg         config.Config
+	targets     []config.Target
+	file        *config.File // nil without -config
+	showVersion bool
+}
+
+// loadSettings builds the configuration from defaults < -config file < PGWD_* env < command-line flags (args),
+// then reads the targets. Used at startup and on SIGHUP; validation is separate (settings.validate).
+func loadSettings(fs *flag.FlagSet, args []string) (settings, error) {
+	var st settings
+	cfg := config.Defaults()
+	if path := configPath(args); path != "" {
+		file, err := config.LoadFile(path)
+		if err != nil {
+			return st, err
+		}
+		if err := file.Apply(&cfg); err != nil {
+			return st, err
+		}
+		st.file = file
+	}
+	cfg.ApplyEnv()
+	showVersion, err := parseFlags(fs, args, &cfg)
+	if err != nil {
+		return st, err
+	}
+	st.cfg, st.showVersion = cfg, showVersion
+	if showVersion || cfg.ValidateK8sAccess {
+		return st, nil
+	}
+	st.targets, err = loadTargets(&cfg, st.file)
+	return st, err
+}
+
+// configPath returns the -config value from args (the flags are not parsed yet), else PGWD_CONFIG.
+func configPath(args []string) string {
+	path := os.Getenv("PGWD_CONFIG")
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			path = value
+		} else if i+1 < len(args) {
+			path = args[i+1]
+		}
+	}
+	return path
+}
+
+// loadTargets returns the targets of the config file or of -targets; using both is an error.
+func loadTargets(cfg *config.Config, file *config.File) ([]config.Target, error) {
+	targets, err := file.Targets(*cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TargetsFile == "" {
+		return targets, nil
+	}
+	if len(targets) > 0 {
+		return nil, fmt.Errorf("targets are listed in %s and in -targets %s; use one", file.Path, cfg.TargetsFile)
+	}
+	return config.LoadTargets(cfg.TargetsFile, *cfg)
+}
+
+// validate checks the base config, or each target when there are targets. Errors for settings from the
+// config file name its line.
+func (st settings) validate() error {
+	if len(st.targets) == 0 {
+		warnDeprecatedThresholds(&st.cfg)
+		return st.file.Annotate(st.cfg.Validate())
+	}
+	for i := range st.targets {
+		t := &st.targets[i]
+		warnDeprecatedThresholds(&t.Config)
+		if err := t.Validate(); err != nil {
+			return fmt.Errorf("target %s: %w", t.Name, st.file.AnnotateTarget(i, err))
+		}
+	}
+	return config.ValidateTargets(st.targets)
+}
+
+// reloadSettings loads and validates the configuration again with the original command line (SIGHUP).
+func reloadSettings() (settings, error) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	st, err := loadSettings(fs, os.Args[1:])
+	if err != nil {
+		return st, err
+	}
+	return st, st.validate()
+}
+
+// serveWithReload runs serve and, on SIGHUP, restarts it with the reloaded configuration. When the new
+// configuration is invalid, the error is logged and the running one is kept. Alerts of the targets carry
+// over to the new configuration. When serve cannot start (e.g. the database is unreachable), pgwd exits on
+// the first start; after a reload it logs the error and starts the previous configuration again after its
+// interval, until one starts or another SIGHUP brings a new configuration.
+func serveWithReload(ctx context.Context, st settings) {
+	var trackers trackerSet
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	running := st // the configuration serve last ran with
+	for first := true; ; first = false {
+		next, err := serveUntilReload(ctx, hup, st, &trackers)
+		switch {
+		case next != nil:
+			running, st = st, *next
+		case err == nil || ctx.Err() != nil:
+			return
+		case first:
+			log.Fatal(err)
+		default:
+			retry := time.Duration(max(running.cfg.Interval, 1)) * time.Second
+			log.Printf("reload: %v; starting the previous configuration again in %s", err, retry)
+			st = running
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retry):
+			}
+		}
+	}
+}
+
+// serveUntilReload runs serve with st until it ends (with its error), ctx is done, or a SIGHUP brings a valid
+// new configuration, which it returns once serve has stopped.
+func serveUntilReload(ctx context.Context, hup <-chan os.Signal, st settings, trackers *trackerSet) (*settings, error) {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- serve(runCtx, st, trackers) }()
+	for {
+		select {
+		case err := <-done:
+			return nil, err
+		case <-ctx.Done():
+			cancel()
+			<-done
+			return nil, nil
+		case <-hup:
+			next, err := reloadSettings()
+			if err != nil {
+				log.Printf("reload: %v; keeping the current configuration", err)
+				continue
+			}
+			log.Printf("reload: configuration reloaded")
+			cancel()
+			<-done
+			return &next, nil
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hrodrig/pgwd/internal/config"
+)
+
+func TestServeUntilReload_start_error(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.DBURL = "postgres://pgwd@127.0.0.1:1/app?connect_timeout=2"
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	next, err := serveUntilReload(ctx, nil, settings{cfg: cfg}, &trackerSet{})
+	if next != nil || err == nil || !strings.Contains(err.Error(), "127.0.0.1") {
+		t.Errorf("serveUntilReload = %v, %v; want the connect error so the caller can keep the previous configuration", next, err)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hrodrig/pgwd/internal/config"
+	"github.com/hrodrig/pgwd/internal/notify"
+	"github.com/hrodrig/pgwd/internal/silence"
+)
+
+const silenceUsage = `usage: pgwd silence add -match name=value [-match ...] (-end TIME | -duration D | -schedule CRON -duration D) -comment TEXT
+       pgwd silence list [-all]
+       pgwd silence expire ID [ID ...]
+
+Matchers name target, database, threshold or level; name=~regex matches a regular expression.
+TIME is RFC 3339 or "2006-01-02 15:04" (local time). Every subcommand takes -silence-file (PGWD_SILENCE_FILE,
+or silence_file in -config).`
+
+// handleSilence runs `pgwd silence ...` and exits when os.Args names that subcommand.
+func handleSilence() {
+	if len(os.Args) < 2 || os.Args[1] != "silence" {
+		return
+	}
+	if err := runSilence(os.Args[2:], os.Stdout, time.Now().Truncate(time.Second)); err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, "pgwd silence:", err)
+		os.Exit(2)
+	}
+	os.Exit(0)
+}
+
+// runSilence runs one `pgwd silence` subcommand (args without "silence") at now.
+func runSilence(args []string, out io.Writer, now time.Time) error {
+	if len(args) == 0 {
+		return errors.New(silenceUsage)
+	}
+	switch args[0] {
+	case "add":
+		return silenceAdd(args[1:], out, now)
+	case "list":
+		return silenceList(args[1:], out, now)
+	case "expire":
+		return silenceExpire(args[1:], out, now)
+	default:
+		return fmt.Errorf("unknown subcommand %q\n%s", args[0], silenceUsage)
+	}
+}
+
+// silenceFlags returns the flag set of a subcommand with -config and -silence-file, and a function that returns the
+// silence file after parsing: -silence-file, else PGWD_SILENCE_FILE, else silence_file in the config file.
+func silenceFlags(name string) (*flag.FlagSet, func() (*silence.File, error)) {
+	fs := flag.NewFlagSet("pgwd silence "+name, flag.ContinueOnError)
+	path := fs.String("silence-file", "", "JSON file of silences (PGWD_SILENCE_FILE)")
+	configFile := fs.String("config", os.Getenv("PGWD_CONFIG"), "YAML config file to read silence_file from (PGWD_CONFIG)")
+	return fs, func() (*silence.File, error) {
+		if *path != "" {
+			return &silence.File{Path: *path}, nil
+		}
+		cfg := config.Defaults()
+		if *configFile != "" {
+			file, err := config.LoadFile(*configFile)
+			if err != nil {
+				return nil, err
+			}
+			if err := file.Apply(&cfg); err != nil {
+				return nil, err
+			}
+		}
+		cfg.ApplyEnv()
+		if cfg.SilenceFile == "" {
+			return nil, errors.New("no silence file: set -silence-file, PGWD_SILENCE_FILE or silence_file in -config")
+		}
+		return &silence.File{Path: cfg.SilenceFile}, nil
+	}
+}
+
+// matcherList is the repeatable -match flag.
+type matcherList []silence.Matcher
+
+func (l *matcherList) String() string { return fmt.Sprint(*l) }
+
+func (l *matcherList) Set(s string) error {
+	m, err := silence.ParseMatcher(s)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, m)
+	return nil
+}
+
+func silenceAdd(args []string, out io.Writer, now time.Time) error {
+	fs, silenceFile := silenceFlags("add")
+	var matchers matcherList
+	fs.Var(&matchers, "match", "Label matcher name=value or name=~regex on target, database, threshold or level (repeatable)")
+	start := fs.String("start", "", "Start time (default now)")
+	end := fs.String("end", "", "End time")
+	duration := fs.Duration("duration", 0, "Length of the silence from -start, or of each window with -schedule (e.g. 2h)")
+	schedule := fs.String("schedule", "", `Recurring window start as a cron expression, e.g. "0 2 * * sun" (local time)`)
+	comment := fs.String("comment", "", "Why the silence exists (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	s := silence.Silence{ID: silence.NewID(), Matchers: matchers, StartsAt: now, Schedule: *schedule, Comment: *comment, CreatedAt: now}
+	var err error
+	if *start != "" {
+		if s.StartsAt, err = parseSilenceTime(*start); err != nil {
+			return err
+		}
+	}
+	if *end != "" {
+		if s.EndsAt, err = parseSilenceTime(*end); err != nil {
+			return err
+		}
+	}
+	switch {
+	case *schedule != "":
+		s.Duration = duration.String()
+	case *end != "" && *duration != 0:
+		return errors.New("use -end or -duration, not both")
+	case *duration != 0:
+		s.EndsAt = s.StartsAt.Add(*duration)
+	}
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	file, err := silenceFile()
+	if err != nil {
+		return err
+	}
+	if err := file.Update(func(silences []silence.Silence) ([]silence.Silence, error) {
+		return append(silences, s), nil
+	}); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, s.ID)
+	return nil
+}
+
+func silenceList(args []string, out io.Writer, now time.Time) error {
+	fs, silenceFile := silenceFlags("list")
+	all := fs.Bool("all", false, "Include expired silences")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	file, err := silenceFile()
+	if err != nil {
+		return err
+	}
+	silences, err := file.Load()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATE\tMATCHERS\tSTARTS\tENDS\tSCHEDULE\tCOMMENT")
+	for i := range silences {
+		s := &silences[i]
+		if s.Expired(now) && !*all {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.ID, silenceState(s, now), matcherString(s.Matchers),
+			formatSilenceTime(s.StartsAt), formatSilenceTime(s.EndsAt), scheduleString(s), s.Comment)
+	}
+	return w.Flush()
+}
+
+func silenceExpire(args []string, out io.Writer, now time.Time) error {
+	fs, silenceFile := silenceFlags("expire")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("expire: silence ID required")
+	}
+	file, err := silenceFile()
+	if err != nil {
+		return err
+	}
+	err = file.Update(func(silences []silence.Silence) ([]silence.Silence, error) {
+		for _, id := range fs.Args() {
+			i := slices.IndexFunc(silences, func(s silence.Silence) bool { return s.ID == id })
+			if i < 0 {
+				return nil, fmt.Errorf("expire: no silence %q", id)
+			}
+			if s := &silences[i]; !s.Expired(now) {
+				if s.StartsAt.After(now) {
+					s.StartsAt = now
+				}
+				s.EndsAt = now
+			}
+		}
+		return silences, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range fs.Args() {
+		fmt.Fprintln(out, "expired", id)
+	}
+	return nil
+}
+
+// silencer reads -silence-file once and returns whether an event of target is muted by an active silence; muted
+// events are logged. Without a silence file it returns nil, and an unreadable one is logged and mutes nothing.
+func silencer(cfg *config.Config, target string) func(notify.Event) bool {
+	if cfg.SilenceFile == "" {
+		return nil
+	}
+	silences, err := (&silence.File{Path: cfg.SilenceFile}).Load()
+	if err != nil {
+		log.Printf("silences: %v", err)
+		return nil
+	}
+	now := time.Now()
+	return func(ev notify.Event) bool {
+		s := silence.Find(silences, silence.Labels(target, ev), now)
+		if s != nil {
+			log.Printf("Silenced by %s (%s): %s", s.ID, s.Comment, ev.Message)
+		}
+		return s != nil
+	}
+}
+
+// dropSilenced returns events without those muted by an active silence in -silence-file (see silencer).
+func dropSilenced(cfg *config.Config, target string, events []notify.Event) []notify.Event {
+	if len(events) == 0 {
+		return events
+	}
+	if mute := silencer(cfg, target); mute != nil {
+		return slices.DeleteFunc(events, mute)
+	}
+	return events
+}
+
+// parseSilenceTime parses RFC 3339 or "2006-01-02 15:04" in local time.
+func parseSilenceTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: want RFC 3339 or 2006-01-02 15:04", s)
+	}
+	return t, nil
+}
+
+func formatSilenceTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04 MST")
+}
+
+// silenceState is the STATE column of silence list: expired, pending (not started), active, or scheduled
+// (recurring, between windows).
+func silenceState(s *silence.Silence, now time.Time) string {
+	switch {
+	case s.Expired(now):
+		return "expired"
+	case now.Before(s.StartsAt):
+		return "pending"
+	case s.Active(now):
+		return "active"
+	default:
+		return "scheduled"
+	}
+}
+
+func matcherString(ms []silence.Matcher) string {
+	parts := make([]string, len(ms))
+	for i, m := range ms {
+		parts[i] = m.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func scheduleString(s *silence.Silence) string {
+	if s.Schedule == "" {
+		return "-"
+	}
+	return fmt.Sprintf("%q for %s", s.Schedule, s.Duration)
+}
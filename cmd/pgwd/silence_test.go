@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hrodrig/pgwd/internal/config"
+	"github.com/hrodrig/pgwd/internal/notify"
+)
+
+// silenceCmd runs `pgwd silence args...` on file at now and returns its output.
+func silenceCmd(t *testing.T, file string, now time.Time, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	if len(args) > 0 {
+		args = append([]string{args[0], "-silence-file", file}, args[1:]...)
+	}
+	err := runSilence(args, &out, now)
+	return out.String(), err
+}
+
+func TestRunSilence_add_list_expire(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "silences.json")
+	now := time.Now().Truncate(time.Second)
+	out, err := silenceCmd(t, file, now, "add", "-match", "database=app", "-match", "threshold=~stale|idle", "-duration", "2h", "-comment", "pg 17 upgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := strings.TrimSpace(out)
+	if out, _ = silenceCmd(t, file, now, "list"); !strings.Contains(out, id) || !strings.Contains(out, "active") ||
+		!strings.Contains(out, "database=app,threshold=~stale|idle") || !strings.Contains(out, "pg 17 upgrade") {
+		t.Errorf("list:\n%s", out)
+	}
+	if out, err = silenceCmd(t, file, now.Add(time.Minute), "expire", id); err != nil || out != "expired "+id+"\n" {
+		t.Errorf("expire = %q, %v", out, err)
+	}
+	later := now.Add(2 * time.Minute)
+	if out, _ = silenceCmd(t, file, later, "list"); strings.Contains(out, id) {
+		t.Errorf("list should hide the expired silence:\n%s", out)
+	}
+	if out, _ = silenceCmd(t, file, later, "list", "-all"); !strings.Contains(out, id) || !strings.Contains(out, "expired") {
+		t.Errorf("list -all should show the expired silence:\n%s", out)
+	}
+}
+
+func TestRunSilence_errors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "silences.json")
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"no subcommand", nil, "usage"},
+		{"unknown subcommand", []string{"mute"}, `unknown subcommand "mute"`},
+		{"bad matcher", []string{"add", "-match", "host=db-1", "-duration", "1h", "-comment", "x"}, "host"},
+		{"missing comment", []string{"add", "-match", "database=app", "-duration", "1h"}, "comment is required"},
+		{"end and duration", []string{"add", "-match", "database=app", "-end", "2030-01-01 00:00", "-duration", "1h", "-comment", "x"}, "not both"},
+		{"expire without id", []string{"expire"}, "silence ID required"},
+		{"expire unknown id", []string{"expire", "nope"}, `no silence "nope"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := silenceCmd(t, file, time.Now(), tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("runSilence(%q) error = %v, want containing %q", tt.args, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDropSilenced(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "silences.json")
+	if _, err := silenceCmd(t, file, time.Now(), "add", "-match", "target=billing", "-match", "threshold=total", "-duration", "1h", "-comment", "load test"); err != nil {
+		t.Fatal(err)
+	}
+	total := notify.Event{Threshold: "total", Database: "app"}
+	stale := notify.Event{Threshold: "stale", Database: "app"}
+	tests := []struct {
+		name   string
+		cfg    config.Config
+		target string
+		want   []string
+	}{
+		{"matching target", config.Config{SilenceFile: file}, "billing", []string{"stale"}},
+		{"other target", config.Config{SilenceFile: file}, "orders", []string{"total", "stale"}},
+		{"no silence file", config.Config{}, "billing", []string{"total", "stale"}},
+		{"unreadable silence file", config.Config{SilenceFile: t.TempDir()}, "billing", []string{"total", "stale"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, e := range dropSilenced(&tt.cfg, tt.target, []notify.Event{total, stale}) {
+				got = append(got, e.Threshold)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("dropSilenced = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/hrodrig/pgwd/internal/config"
+	"github.com/hrodrig/pgwd/internal/postgres"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// runTargets monitors the targets concurrently until ctx is done (or once when -interval is 0). Each target has
+// its own pool, notifiers and goroutine, and each check is bounded by its -check-timeout, so a hung database only
+// delays its own checks. Targets are validated by the caller. It returns an error when a port-forward cannot start.
+func runTargets(ctx context.Context, base *config.Config, targets []config.Target, trackers *trackerSet) error {
+	kubeLokiCleanup, err := setupKubeLoki(ctx, base)
+	if err != nil {
+		return err
+	}
+	defer kubeLokiCleanup()
+	for i := range targets {
+		t := &targets[i]
+		if t.KubeLoki != "" && t.LokiURL == "" {
+			t.LokiURL = base.LokiURL // one Loki port-forward (process-wide -kube-loki) shared by all targets
+		}
+		kubeCleanup, err := setupKube(ctx, &t.Config)
+		if err != nil {
+			return fmt.Errorf("target %s: %w", t.Name, err)
+		}
+		defer kubeCleanup()
+	}
+	log.Printf("Monitoring %d target(s)", len(targets))
+	var wg sync.WaitGroup
+	for i := range targets {
+		wg.Go(func() { runTarget(ctx, &targets[i], base.Interval, trackers) })
+	}
+	wg.Wait()
+	return nil
+}
+
+// runTarget checks one target now and then every interval seconds (once when interval <= 0). Unlike the
+// single-database mode, a failed connection does not exit: it is retried on every tick. Like a failed connection
+// of a later check, it is the connect_failure condition of the target's tracker, so it is notified like a
+// threshold (repeats, silences) and resolves once pgwd connects again.
+func runTarget(ctx context.Context, t *config.Target, interval int, trackers *trackerSet) {
+	cfg := &t.Config
+	cluster, client, ns, db := runContextStrings(ctx, cfg)
+	senders := buildSenders(cfg)
+	tracker := trackers.tracker(t.Name, cfg)
+	var pool *pgxpool.Pool
+	defer func() {
+		if pool != nil {
+			pool.Close()
+		}
+	}()
+
+	var run func(context.Context)
+	every(ctx, interval, func() {
+		if run == nil {
+			if err := connectTarget(ctx, cfg, &pool); err != nil {
+				log.Printf("target %s: postgres connect failed (check database URL): %v", t.Name, err)
+				notifyEvents(ctx, cfg, senders, tracker, connectFailureEvents(t.Name, cluster, client, ns, db, err))
+				return
+			}
+			run = makeRunFunc(pool, cfg, senders, tracker, cluster, client, ns, db)
+		}
+		run(ctx)
+	})
+}
+
+// connectTarget opens *pool when it is nil and applies the threshold defaults, which need the server's
+// max_connections. The pool is kept on error so the next attempt reuses it.
+func connectTarget(ctx context.Context, cfg *config.Config, pool **pgxpool.Pool) error {
+	if *pool == nil {
+		p, err := postgres.Pool(ctx, cfg.DBURL)
+		if err != nil {
+			return err
+		}
+		*pool = p
+	}
+	return applyTargetDefaults(ctx, *pool, cfg)
+}
+
+// applyTargetDefaults is applyThresholdDefaults bounded by the target's -check-timeout.
+func applyTargetDefaults(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config) error {
+	ctx, cancel := checkContext(ctx, cfg)
+	defer cancel()
+	return applyThresholdDefaults(ctx, pool, cfg)
+}
@@ -0,0 +1,325 @@
+// Package alert keeps threshold alerts across checks, like Prometheus alert rules: a breached threshold is
+// pending until it has been breached for long enough (its Rule), then firing until a check no longer reports
+// it, when the tracker sends a resolved event.
+package alert
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hrodrig/pgwd/internal/notify"
+)
+
+// State is where an alert is in its life cycle.
+type State string
+
+const (
+	Inactive State = "inactive" // not breached
+	Pending  State = "pending"  // breached, but not for long enough yet
+	Firing   State = "firing"   // breached for at least its Rule
+)
+
+// Rule is how long a threshold must stay breached before its alert fires. The zero Rule fires on the first breach.
+type Rule struct {
+	For    time.Duration // breached continuously for at least this long (time since the first breached check)
+	Checks int           // and in at least this many consecutive checks
+}
+
+func (r Rule) String() string {
+	switch {
+	case r.For > 0 && r.Checks > 1:
+		return fmt.Sprintf("%s and %d checks", r.For, r.Checks)
+	case r.Checks > 1:
+		return fmt.Sprintf("%d checks", r.Checks)
+	default:
+		return r.For.String()
+	}
+}
+
+// Alert is one breached condition, identified by its Fingerprint. The JSON form is what a Store persists; Rule is
+// not stored because it comes from the configuration on every check.
+type Alert struct {
+	Fingerprint string       `json:"fingerprint"`
+	State       State        `json:"state"`
+	Rule        Rule         `json:"-"`
+	ActiveSince time.Time    `json:"active_since"` // first check of the current breach
+	Checks      int          `json:"checks"`       // consecutive breached checks, including this one
+	Peak        int          `json:"peak"`         // highest Value since ActiveSince
+	Event       notify.Event `json:"event"`        // the latest breached event for the condition, without sessions
+	// LastNotified is when the alert was last delivered (zero until a notifier accepts it) and NotifiedLevel the
+	// level it was delivered with.
+	LastNotified  time.Time `json:"last_notified,omitzero"`
+	NotifiedLevel string    `json:"notified_level,omitempty"`
+	// ResolvedAt is the first check that found a firing alert clear; the alert is kept until its resolved event
+	// is delivered.
+	ResolvedAt time.Time `json:"resolved_at,omitzero"`
+}
+
+// Tracker holds the alerts of one target between checks. It is not safe for concurrent use.
+type Tracker struct {
+	// Target names the monitored target in fingerprints (empty in single-database mode).
+	Target string
+	// Rule returns the rule for a threshold (e.g. "total"); nil means every threshold fires on the first breach.
+	Rule func(threshold string) Rule
+	// RepeatInterval re-sends a firing alert whose level has not changed after this long; 0 means never.
+	RepeatInterval time.Duration
+	// Now returns the current time; nil means time.Now.
+	Now func() time.Time
+	// Store, when set, keeps the alerts on disk between runs (see Sync); nil keeps them in memory only.
+	Store *Store
+	// StateKey is the section of Store holding the alerts; empty means Target.
+	StateKey string
+
+	alerts map[string]*Alert
+}
+
+// NewTracker returns an empty Tracker for target using rule.
+func NewTracker(target string, rule func(threshold string) Rule) *Tracker {
+	return &Tracker{Target: target, Rule: rule}
+}
+
+// Continue takes over the alerts of prev, the tracker of the same target before a configuration reload, so the
+// reload neither notifies firing alerts again nor restarts pending ones.
+func (t *Tracker) Continue(prev *Tracker) {
+	t.alerts = prev.alerts
+}
+
+// Sync runs fn (typically a call to Evaluate) with the tracker's alerts loaded from Store and saves them afterwards,
+// holding the store's lock throughout, so one-shot runs and concurrent processes continue the same alerts. Without a
+// Store it just runs fn. When the store cannot be locked, read or written, fn still runs on the alerts in memory and
+// the error is returned.
+func (t *Tracker) Sync(fn func()) error {
+	if t.Store == nil {
+		fn()
+		return nil
+	}
+	key := t.StateKey
+	if key == "" {
+		key = t.Target
+	}
+	ran := false
+	err := t.Store.Update(key, func(alerts map[string]*Alert) map[string]*Alert {
+		t.alerts = alerts
+		fn()
+		ran = true
+		return t.alerts
+	})
+	if !ran {
+		fn()
+	}
+	return err
+}
+
+// Evaluate updates the alerts with the events of one check. It returns the events to notify and the alerts still
+// pending. Events to notify are those of firing alerts until one is delivered (see Delivered), then when they
+// change level (escalation or de-escalation) or are due for RepeatInterval; a resolved event for each notified
+// firing alert without a breached event in this check, until it is delivered; and events that are not threshold
+// conditions (test, remediation) unchanged. An event marked
+// BelowThreshold keeps a firing alert from resolving but is not sent; one marked Unevaluated keeps the alerts of
+// its threshold as they are; other alerts that are not firing and have no breached event become inactive.
+//
+// Events mute reports (silences; nil mutes nothing) are left out of send. Like undelivered events they do not
+// count as notified: a firing alert is announced once it is no longer muted, and its resolved event waits as well.
+func (t *Tracker) Evaluate(events []notify.Event, mute func(notify.Event) bool) (send []notify.Event, pending []*Alert) {
+	if t.alerts == nil {
+		t.alerts = make(map[string]*Alert)
+	}
+	now := t.now()
+	seen := make(map[string]bool, len(events))
+	var unknown []notify.Event
+	for _, ev := range events {
+		if ev.Unevaluated {
+			unknown = append(unknown, ev)
+			continue
+		}
+		if !IsCondition(ev.Threshold) {
+			send = append(send, ev)
+			continue
+		}
+		a := t.update(ev, now)
+		if a == nil {
+			continue
+		}
+		seen[a.Fingerprint] = true
+		switch {
+		case a.State == Pending:
+			pending = append(pending, a)
+		case !ev.BelowThreshold && a.notifyDue(ev, now, t.RepeatInterval):
+			send = append(send, ev)
+		}
+	}
+	send = append(send, t.resolve(seen, unknown, now)...)
+	if mute != nil {
+		send = slices.DeleteFunc(send, mute)
+	}
+	return send, pending
+}
+
+// update applies one condition event to its alert and returns the alert, or nil when ev is below its threshold
+// and the alert is not firing.
+func (t *Tracker) update(ev notify.Event, now time.Time) *Alert {
+	fp := Fingerprint(t.Target, ev)
+	a := t.alerts[fp]
+	if a != nil {
+		a.ResolvedAt = time.Time{} // breached again before its resolved event was delivered
+	}
+	if ev.BelowThreshold {
+		if a != nil && a.State == Firing {
+			return a
+		}
+		return nil
+	}
+	if a == nil {
+		a = &Alert{Fingerprint: fp, State: Pending, ActiveSince: now}
+		t.alerts[fp] = a
+	}
+	a.Checks++
+	a.Peak = max(a.Peak, ev.Value)
+	a.Event = ev
+	a.Event.Sessions, a.Event.TopApplications = nil, nil // they describe one check, not the condition
+	a.Rule = t.rule(ev.Threshold)
+	if a.State == Pending && a.due(now) {
+		a.State = Firing
+	}
+	return a
+}
+
+// resolve handles the alerts not seen in this check, except those of unknown (Unevaluated) thresholds: it returns
+// a resolved event for each firing alert that was notified, keeping the alert until Delivered drops it, and drops
+// the others (pending, or firing but never delivered, so there is nothing to resolve).
+func (t *Tracker) resolve(seen map[string]bool, unknown []notify.Event, now time.Time) []notify.Event {
+	var resolved []notify.Event
+	for _, fp := range slices.Sorted(maps.Keys(t.alerts)) {
+		a := t.alerts[fp]
+		if seen[fp] || a.unevaluated(unknown) {
+			continue
+		}
+		if a.State == Firing && !a.LastNotified.IsZero() {
+			resolved = append(resolved, a.resolved(now))
+			continue
+		}
+		delete(t.alerts, fp)
+	}
+	return resolved
+}
+
+// Delivered records the events of Evaluate that at least one notifier accepted: a firing alert's LastNotified and
+// NotifiedLevel, and the end of a resolved alert. Events that were not delivered (every notifier failed, dry-run,
+// silenced) are sent again by the next Evaluate.
+func (t *Tracker) Delivered(events []notify.Event) {
+	now := t.now()
+	for _, ev := range events {
+		if !IsCondition(ev.Threshold) {
+			continue
+		}
+		fp := Fingerprint(t.Target, ev)
+		a := t.alerts[fp]
+		switch {
+		case a == nil:
+		case ev.Resolved:
+			if !a.ResolvedAt.IsZero() {
+				delete(t.alerts, fp)
+			}
+		default:
+			a.LastNotified = now
+			a.NotifiedLevel = ev.Level
+		}
+	}
+}
+
+func (t *Tracker) rule(threshold string) Rule {
+	if t.Rule == nil {
+		return Rule{}
+	}
+	return t.Rule(threshold)
+}
+
+func (t *Tracker) now() time.Time {
+	if t.Now == nil {
+		return time.Now()
+	}
+	return t.Now()
+}
+
+// notifyDue reports whether a firing alert's event is sent: until it has been delivered once, when ev's level
+// differs from the last one delivered, and then every repeat (never when repeat is 0).
+func (a *Alert) notifyDue(ev notify.Event, now time.Time, repeat time.Duration) bool {
+	return a.LastNotified.IsZero() || ev.Level != a.NotifiedLevel || (repeat > 0 && now.Sub(a.LastNotified) >= repeat)
+}
+
+// unevaluated reports whether one of the Unevaluated events in unknown covers the alert: same threshold (any
+// without one) and, when the event names one, same database.
+func (a *Alert) unevaluated(unknown []notify.Event) bool {
+	for _, u := range unknown {
+		if (u.Threshold == "" || u.Threshold == a.Event.Threshold) && (u.Database == "" || u.Database == a.Event.Database) {
+			return true
+		}
+	}
+	return false
+}
+
+// due reports whether the breach has lasted long enough for the alert's rule.
+func (a *Alert) due(now time.Time) bool {
+	return now.Sub(a.ActiveSince) >= a.Rule.For && a.Checks >= a.Rule.Checks
+}
+
+// resolved returns the event that ends a firing alert: its last breached event with the duration (up to the first
+// clear check) and peak.
+func (a *Alert) resolved(now time.Time) notify.Event {
+	if a.ResolvedAt.IsZero() {
+		a.ResolvedAt = now
+	}
+	ev := a.Event
+	ev.Resolved = true
+	ev.Duration = a.ResolvedAt.Sub(a.ActiveSince)
+	ev.Peak = a.Peak
+	ev.Message = fmt.Sprintf("Resolved: %s back below %d", subject(ev), ev.ThresholdValue)
+	switch ev.Threshold {
+	case "connect_failure", "too_many_clients":
+		ev.Message = "Resolved: pgwd connects to Postgres again"
+	case "pgbouncer_connect_failure":
+		ev.Message = "Resolved: pgwd connects to the PgBouncer admin console again"
+	}
+	return ev
+}
+
+// subject names what an event is about, e.g. "total", "role billing" or "pgbouncer_waiting pool app/web".
+func subject(ev notify.Event) string {
+	s := ev.Threshold
+	switch {
+	case ev.PgBouncerPool != nil:
+		s += fmt.Sprintf(" pool %s/%s", ev.PgBouncerPool.Database, ev.PgBouncerPool.User)
+	case ev.Role != "":
+		s += " role " + ev.Role
+	case ev.Application != "":
+		s += " application " + ev.Application + " " + ev.Metric
+	}
+	return s
+}
+
+// Fingerprint identifies the condition an event reports, independent of its values and level: target, database,
+// threshold and the role, application (and its metric) or PgBouncer pool it is about.
+func Fingerprint(target string, ev notify.Event) string {
+	parts := []string{target, ev.Database, ev.Threshold, ev.Role, ev.Application}
+	if ev.Metric != "" {
+		parts = append(parts, ev.Metric)
+	}
+	if p := ev.PgBouncerPool; p != nil {
+		parts = append(parts, p.Database+"/"+p.User)
+	}
+	return strings.Join(parts, "|")
+}
+
+// IsCondition reports whether threshold is a condition that stays breached across checks (total, idle,
+// stale, connect_failure, ...), as opposed to one-off events: test notifications and remediation actions.
+func IsCondition(threshold string) bool {
+	switch threshold {
+	case "test", "remediation":
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,396 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hrodrig/pgwd/internal/notify"
+	"github.com/hrodrig/pgwd/internal/pgbouncer"
+	"github.com/hrodrig/pgwd/internal/postgres"
+)
+
+// clock is a fake Tracker.Now advanced by tick.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func (c *clock) tick(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestTracker(rule Rule) (*Tracker, *clock) {
+	c := &clock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tr := NewTracker("prod", func(string) Rule { return rule })
+	tr.Now = c.now
+	return tr, c
+}
+
+// evaluate runs one check whose events are all delivered.
+func evaluate(tr *Tracker, events []notify.Event, mute func(notify.Event) bool) ([]notify.Event, []*Alert) {
+	send, pending := tr.Evaluate(events, mute)
+	tr.Delivered(send)
+	return send, pending
+}
+
+func totalEvent() notify.Event {
+	return notify.Event{Threshold: "total", ThresholdValue: 80, Database: "app", Message: "Total connections 90 >= 80"}
+}
+
+func TestEvaluate_zero_rule_fires_immediately(t *testing.T) {
+	tr := NewTracker("", nil)
+	send, pending := evaluate(tr, []notify.Event{totalEvent()}, nil)
+	if len(send) != 1 || len(pending) != 0 {
+		t.Fatalf("got send=%d pending=%d, want 1, 0", len(send), len(pending))
+	}
+}
+
+func TestEvaluate_for_duration(t *testing.T) {
+	tr, c := newTestTracker(Rule{For: 2 * time.Minute})
+	for i, want := range []int{0, 0, 1} {
+		send, pending := evaluate(tr, []notify.Event{totalEvent()}, nil)
+		if len(send) != want || len(pending) != 1-want {
+			t.Fatalf("check %d: send=%d pending=%d, want send=%d", i, len(send), len(pending), want)
+		}
+		c.tick(time.Minute)
+	}
+}
+
+func TestEvaluate_for_checks(t *testing.T) {
+	tr, _ := newTestTracker(Rule{Checks: 3})
+	for i, want := range []int{0, 0, 1} {
+		send, pending := evaluate(tr, []notify.Event{totalEvent()}, nil)
+		if len(send) != want {
+			t.Fatalf("check %d: send=%d, want %d", i, len(send), want)
+		}
+		if want == 0 && (len(pending) != 1 || pending[0].Checks != i+1 || pending[0].State != Pending) {
+			t.Fatalf("check %d: pending=%+v", i, pending)
+		}
+	}
+}
+
+func TestEvaluate_clear_check_resets(t *testing.T) {
+	tr, c := newTestTracker(Rule{For: time.Minute})
+	evaluate(tr, []notify.Event{totalEvent()}, nil)
+	c.tick(time.Minute)
+	evaluate(tr, nil, nil) // one check below the threshold: the breach is not continuous
+	c.tick(time.Minute)
+	if send, _ := evaluate(tr, []notify.Event{totalEvent()}, nil); len(send) != 0 {
+		t.Fatal("alert should be pending again after a clear check")
+	}
+	c.tick(time.Minute)
+	if send, _ := evaluate(tr, []notify.Event{totalEvent()}, nil); len(send) != 1 {
+		t.Fatal("alert should fire after a minute breached again")
+	}
+}
+
+func TestEvaluate_dedup_and_repeat(t *testing.T) {
+	tr, c := newTestTracker(Rule{})
+	tr.RepeatInterval = 10 * time.Minute
+	ev := totalEvent()
+	ev.Level = "alert"
+	steps := []struct {
+		advance time.Duration
+		level   string
+		want    int
+	}{
+		{0, "alert", 1},               // starts firing
+		{time.Minute, "alert", 0},     // same level: deduplicated
+		{time.Minute, "danger", 1},    // escalation: right away
+		{time.Minute, "danger", 0},    // deduplicated
+		{time.Minute, "alert", 1},     // de-escalation: right away
+		{9 * time.Minute, "alert", 0}, // 9m since the last one
+		{time.Minute, "alert", 1},     // repeat interval
+	}
+	for i, st := range steps {
+		c.tick(st.advance)
+		ev.Level = st.level
+		if send, _ := evaluate(tr, []notify.Event{ev}, nil); len(send) != st.want {
+			t.Fatalf("step %d (%s): send=%d, want %d", i, st.level, len(send), st.want)
+		}
+	}
+}
+
+func TestEvaluate_no_repeat(t *testing.T) {
+	tr, c := newTestTracker(Rule{})
+	evaluate(tr, []notify.Event{totalEvent()}, nil)
+	c.tick(24 * time.Hour)
+	if send, _ := evaluate(tr, []notify.Event{totalEvent()}, nil); len(send) != 0 {
+		t.Errorf("RepeatInterval 0 should never re-send, got %+v", send)
+	}
+}
+
+func TestEvaluate_one_off_events_pass_through(t *testing.T) {
+	tr, _ := newTestTracker(Rule{Checks: 5})
+	events := []notify.Event{{Threshold: "test"}, {Threshold: "remediation"}, totalEvent()}
+	send, pending := evaluate(tr, events, nil)
+	if len(send) != 2 || send[0].Threshold != "test" || send[1].Threshold != "remediation" || len(pending) != 1 {
+		t.Fatalf("send=%+v pending=%d", send, len(pending))
+	}
+}
+
+func TestEvaluate_fingerprints_are_independent(t *testing.T) {
+	tr, c := newTestTracker(Rule{For: time.Minute})
+	roleA := notify.Event{Threshold: "role", Role: "a"}
+	roleB := notify.Event{Threshold: "role", Role: "b"}
+	evaluate(tr, []notify.Event{roleA}, nil)
+	c.tick(time.Minute)
+	send, pending := evaluate(tr, []notify.Event{roleA, roleB}, nil)
+	if len(send) != 1 || send[0].Role != "a" || len(pending) != 1 || pending[0].Event.Role != "b" {
+		t.Fatalf("send=%+v pending=%+v", send, pending)
+	}
+}
+
+func TestEvaluate_application_metrics_are_independent(t *testing.T) {
+	tr, _ := newTestTracker(Rule{})
+	idle := notify.Event{Threshold: "application", Application: "web", Metric: "idle", ThresholdValue: 40, Value: 50}
+	total := notify.Event{Threshold: "application", Application: "web", Metric: "total", ThresholdValue: 70, Value: 80}
+	if send, _ := evaluate(tr, []notify.Event{idle, total}, nil); len(send) != 2 {
+		t.Fatalf("got %d events, want both metrics firing", len(send))
+	}
+	send, _ := evaluate(tr, []notify.Event{idle}, nil)
+	if len(send) != 1 || !send[0].Resolved || send[0].Metric != "total" || send[0].Peak != 80 {
+		t.Fatalf("send = %+v, want only total resolved", send)
+	}
+	if want := "Resolved: application application web total back below 70"; send[0].Message != want {
+		t.Errorf("message = %q, want %q", send[0].Message, want)
+	}
+}
+
+func TestEvaluate_resolved_with_duration_and_peak(t *testing.T) {
+	tr, c := newTestTracker(Rule{})
+	for _, v := range []int{85, 95, 90} {
+		ev := totalEvent()
+		ev.Value = v
+		ev.Sessions = []postgres.Session{{PID: 1}}
+		evaluate(tr, []notify.Event{ev}, nil)
+		c.tick(time.Minute)
+	}
+	send, _ := evaluate(tr, nil, nil)
+	if len(send) != 1 {
+		t.Fatalf("got %d events, want one resolved event", len(send))
+	}
+	r := send[0]
+	if !r.Resolved || r.Duration != 3*time.Minute || r.Peak != 95 || r.Threshold != "total" || r.Database != "app" {
+		t.Errorf("resolved event: %+v", r)
+	}
+	if r.Message != "Resolved: total back below 80" || r.Sessions != nil {
+		t.Errorf("resolved message/sessions: %q %v", r.Message, r.Sessions)
+	}
+	if send, _ := evaluate(tr, nil, nil); len(send) != 0 {
+		t.Errorf("resolved should be sent once, got %+v", send)
+	}
+}
+
+func TestEvaluate_hysteresis_band(t *testing.T) {
+	tr, c := newTestTracker(Rule{})
+	evaluate(tr, []notify.Event{totalEvent()}, nil)
+	band := totalEvent()
+	band.Value, band.BelowThreshold = 75, true
+	for range 2 {
+		c.tick(time.Minute)
+		if send, _ := evaluate(tr, []notify.Event{band}, nil); len(send) != 0 {
+			t.Fatalf("below-threshold event should keep the alert firing without notifying, got %+v", send)
+		}
+	}
+	c.tick(time.Minute)
+	send, _ := evaluate(tr, nil, nil)
+	if len(send) != 1 || !send[0].Resolved || send[0].Duration != 3*time.Minute {
+		t.Fatalf("want resolved after the band, got %+v", send)
+	}
+}
+
+func TestEvaluate_band_does_not_keep_pending(t *testing.T) {
+	tr, c := newTestTracker(Rule{For: 2 * time.Minute})
+	evaluate(tr, []notify.Event{totalEvent()}, nil)
+	band := totalEvent()
+	band.BelowThreshold = true
+	c.tick(time.Minute)
+	if send, pending := evaluate(tr, []notify.Event{band}, nil); len(send) != 0 || len(pending) != 0 {
+		t.Fatalf("band should reset a pending alert without resolving: send=%+v pending=%d", send, len(pending))
+	}
+}
+
+func TestEvaluate_pending_never_resolves(t *testing.T) {
+	tr, _ := newTestTracker(Rule{Checks: 2})
+	evaluate(tr, []notify.Event{totalEvent()}, nil)
+	if send, _ := evaluate(tr, nil, nil); len(send) != 0 {
+		t.Errorf("an alert that never fired should not resolve, got %+v", send)
+	}
+}
+
+func TestEvaluate_undelivered_firing_is_sent_again(t *testing.T) {
+	tr, c := newTestTracker(Rule{})
+	tr.RepeatInterval = time.Hour
+	for i := range 2 {
+		if send, _ := tr.Evaluate([]notify.Event{totalEvent()}, nil); len(send) != 1 {
+			t.Fatalf("check %d: an undelivered alert should be sent again, got %+v", i, send)
+		}
+		c.tick(time.Minute)
+	}
+	if send, _ := evaluate(tr, []notify.Event{totalEvent()}, nil); len(send) != 1 {
+		t.Fatalf("want the alert sent, got %+v", send)
+	}
+	c.tick(time.Minute)
+	if send, _ := tr.Evaluate([]notify.Event{totalEvent()}, nil); len(send) != 0 {
+		t.Fatalf("a delivered alert should be deduplicated, got %+v", send)
+	}
+}
+
+func TestEvaluate_undelivered_resolved_is_sent_again(t *testing.T) {
+	tr, c := newTestTracker(Rule{})
+	evaluate(tr, []notify.Event{totalEvent()}, nil)
+	c.tick(time.Minute)
+	for i := range 2 {
+		send, _ := tr.Evaluate(nil, nil)
+		if len(send) != 1 || !send[0].Resolved || send[0].Duration != time.Minute {
+			t.Fatalf("check %d: want the resolved event again with the first clear check's duration, got %+v", i, send)
+		}
+		c.tick(time.Minute)
+	}
+	evaluate(tr, nil, nil)
+	if send, _ := tr.Evaluate(nil, nil); len(send) != 0 {
+		t.Fatalf("a delivered resolved event should end the alert, got %+v", send)
+	}
+}
+
+func TestEvaluate_never_delivered_does_not_resolve(t *testing.T) {
+	tr, c := newTestTracker(Rule{})
+	tr.Evaluate([]notify.Event{totalEvent()}, nil) // every notifier failed
+	c.tick(time.Minute)
+	if send, _ := evaluate(tr, nil, nil); len(send) != 0 {
+		t.Fatalf("an alert nobody received should not resolve, got %+v", send)
+	}
+}
+
+func TestEvaluate_muted_alert_is_announced_after(t *testing.T) {
+	tr, c := newTestTracker(Rule{})
+	mute := func(notify.Event) bool { return true }
+	for range 2 {
+		if send, _ := evaluate(tr, []notify.Event{totalEvent()}, mute); len(send) != 0 {
+			t.Fatalf("muted alert should not be sent, got %+v", send)
+		}
+		c.tick(time.Minute)
+	}
+	if send, _ := evaluate(tr, []notify.Event{totalEvent()}, nil); len(send) != 1 {
+		t.Fatalf("alert should be announced when the silence ends, got %+v", send)
+	}
+}
+
+func TestEvaluate_muted_alert_does_not_resolve(t *testing.T) {
+	tr, c := newTestTracker(Rule{})
+	mute := func(notify.Event) bool { return true }
+	evaluate(tr, []notify.Event{totalEvent()}, mute)
+	c.tick(time.Minute)
+	if send, _ := evaluate(tr, nil, nil); len(send) != 0 {
+		t.Fatalf("an alert muted for its whole life should not resolve, got %+v", send)
+	}
+}
+
+func TestEvaluate_resolved_waits_for_silence(t *testing.T) {
+	tr, c := newTestTracker(Rule{})
+	evaluate(tr, []notify.Event{totalEvent()}, nil)
+	c.tick(time.Minute)
+	mute := func(ev notify.Event) bool { return ev.Resolved }
+	if send, _ := evaluate(tr, nil, mute); len(send) != 0 {
+		t.Fatalf("muted resolved event should not be sent, got %+v", send)
+	}
+	c.tick(time.Minute)
+	if send, _ := evaluate(tr, nil, nil); len(send) != 1 || !send[0].Resolved || send[0].Duration != time.Minute {
+		t.Fatalf("resolved event should be sent after the silence, got %+v", send)
+	}
+}
+
+func TestEvaluate_unevaluated_keeps_alerts(t *testing.T) {
+	tr, c := newTestTracker(Rule{})
+	role := notify.Event{Threshold: "role", Database: "app", Role: "billing"}
+	evaluate(tr, []notify.Event{totalEvent(), role}, nil)
+	unknown := notify.Event{Threshold: "role", Database: "app", Unevaluated: true}
+	c.tick(time.Minute)
+	send, _ := evaluate(tr, []notify.Event{unknown}, nil)
+	if len(send) != 1 || send[0].Threshold != "total" || !send[0].Resolved {
+		t.Fatalf("only total should resolve while role cannot be evaluated, got %+v", send)
+	}
+	c.tick(time.Minute)
+	send, _ = evaluate(tr, nil, nil)
+	if len(send) != 1 || send[0].Role != "billing" || !send[0].Resolved || send[0].Duration != 2*time.Minute {
+		t.Fatalf("role should resolve once evaluated again, got %+v", send)
+	}
+}
+
+func TestEvaluate_unevaluated_database(t *testing.T) {
+	tr, _ := newTestTracker(Rule{})
+	evaluate(tr, []notify.Event{totalEvent()}, nil)
+	other := notify.Event{Threshold: "total", Database: "other", Unevaluated: true}
+	if send, _ := evaluate(tr, []notify.Event{other}, nil); len(send) != 1 || !send[0].Resolved {
+		t.Fatalf("an unevaluated threshold in another database should not keep the alert, got %+v", send)
+	}
+	evaluate(tr, []notify.Event{totalEvent()}, nil)
+	anyDB := notify.Event{Threshold: "total", Unevaluated: true}
+	if send, _ := evaluate(tr, []notify.Event{anyDB}, nil); len(send) != 0 {
+		t.Fatalf("an unevaluated threshold without database should keep the alert, got %+v", send)
+	}
+}
+
+func TestEvaluate_connect_failure_keeps_alerts_and_resolves(t *testing.T) {
+	tr, c := newTestTracker(Rule{})
+	evaluate(tr, []notify.Event{totalEvent()}, nil)
+	down := []notify.Event{{Threshold: "connect_failure", Message: "pgwd could not connect to Postgres."}, {Unevaluated: true}}
+	c.tick(time.Minute)
+	if send, _ := evaluate(tr, down, nil); len(send) != 1 || send[0].Threshold != "connect_failure" {
+		t.Fatalf("want only the connect failure while total cannot be evaluated, got %+v", send)
+	}
+	c.tick(time.Minute)
+	if send, _ := evaluate(tr, down, nil); len(send) != 0 {
+		t.Fatalf("a connect failure should be sent once, got %+v", send)
+	}
+	send, _ := evaluate(tr, []notify.Event{totalEvent()}, nil)
+	if len(send) != 1 || !send[0].Resolved || send[0].Message != "Resolved: pgwd connects to Postgres again" {
+		t.Fatalf("want the connect failure resolved and total still firing, got %+v", send)
+	}
+}
+
+func TestEvaluate_pgbouncer_connect_failure_resolves(t *testing.T) {
+	tr, c := newTestTracker(Rule{})
+	down := notify.Event{Threshold: "pgbouncer_connect_failure", Level: "danger", Message: "pgwd could not connect to the PgBouncer admin console."}
+	evaluate(tr, []notify.Event{down}, nil)
+	c.tick(time.Minute)
+	if send, _ := evaluate(tr, []notify.Event{down}, nil); len(send) != 0 {
+		t.Fatalf("a PgBouncer connect failure should be sent once, got %+v", send)
+	}
+	send, _ := evaluate(tr, nil, nil)
+	if len(send) != 1 || !send[0].Resolved || send[0].Message != "Resolved: pgwd connects to the PgBouncer admin console again" {
+		t.Fatalf("want the connect failure resolved, got %+v", send)
+	}
+}
+
+func TestContinue_keeps_alerts_across_reload(t *testing.T) {
+	prev, c := newTestTracker(Rule{})
+	evaluate(prev, []notify.Event{totalEvent()}, nil)
+	tr, _ := newTestTracker(Rule{})
+	tr.Now = c.now
+	tr.Continue(prev)
+	c.tick(time.Minute)
+	if send, _ := evaluate(tr, []notify.Event{totalEvent()}, nil); len(send) != 0 {
+		t.Fatalf("a firing alert should not be notified again after a reload, got %+v", send)
+	}
+	if send, _ := evaluate(tr, nil, nil); len(send) != 1 || !send[0].Resolved || send[0].Duration != time.Minute {
+		t.Fatalf("want the alert resolved after 1m, got %+v", send)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	pool := &pgbouncer.Pool{Database: "app", User: "web"}
+	a := Fingerprint("prod", notify.Event{Threshold: "pgbouncer_waiting", PgBouncerPool: pool, Message: "5 waiting", Level: "alert"})
+	b := Fingerprint("prod", notify.Event{Threshold: "pgbouncer_waiting", PgBouncerPool: pool, Message: "9 waiting", Level: "danger"})
+	if a != b {
+		t.Errorf("fingerprint should ignore message and level: %q != %q", a, b)
+	}
+	if a == Fingerprint("staging", notify.Event{Threshold: "pgbouncer_waiting", PgBouncerPool: pool}) {
+		t.Error("fingerprint should include the target")
+	}
+	if Fingerprint("", notify.Event{Threshold: "total", Database: "a"}) == Fingerprint("", notify.Event{Threshold: "total", Database: "b"}) {
+		t.Error("fingerprint should include the database")
+	}
+	if Fingerprint("", notify.Event{Threshold: "application", Application: "web", Metric: "idle"}) ==
+		Fingerprint("", notify.Event{Threshold: "application", Application: "web", Metric: "total"}) {
+		t.Error("fingerprint should include the application metric")
+	}
+}
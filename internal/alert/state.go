@@ -0,0 +1,82 @@
+package alert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/hrodrig/pgwd/internal/lockedfile"
+)
+
+// stateVersion is the format of the state file; files with another version are rejected.
+const stateVersion = 1
+
+// Store is the on-disk alert state (-state-file), shared by the trackers of every target and by concurrent pgwd
+// runs (cron, systemd timers). Each update holds an exclusive lock on Path+".lock" and replaces the file atomically.
+type Store struct {
+	Path string
+	// ReadOnly loads the state but never writes it (dry-run).
+	ReadOnly bool
+}
+
+// stateFile is the JSON document at Store.Path: alerts by Tracker.StateKey (the target name, or the server and
+// database in single-database mode) and fingerprint.
+type stateFile struct {
+	Version int                          `json:"version"`
+	Targets map[string]map[string]*Alert `json:"targets"`
+}
+
+// Update locks the file, passes fn the alerts of target (empty when the file or target does not exist yet) and
+// writes back the alerts fn returns. When the file cannot be locked or read, fn is not called.
+func (s *Store) Update(target string, fn func(alerts map[string]*Alert) map[string]*Alert) error {
+	return lockedfile.Update(s.Path, func() error { return s.update(target, fn) })
+}
+
+func (s *Store) update(target string, fn func(alerts map[string]*Alert) map[string]*Alert) error {
+	st, err := s.read()
+	if err != nil {
+		return err
+	}
+	alerts := st.Targets[target]
+	if alerts == nil {
+		alerts = make(map[string]*Alert)
+	}
+	alerts = fn(alerts)
+	if s.ReadOnly {
+		return nil
+	}
+	if len(alerts) == 0 {
+		delete(st.Targets, target)
+	} else {
+		st.Targets[target] = alerts
+	}
+	raw, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return lockedfile.WriteAtomic(s.Path, append(raw, '\n'))
+}
+
+// read returns the state in the file, or an empty state when the file does not exist.
+func (s *Store) read() (*stateFile, error) {
+	st := &stateFile{Version: stateVersion, Targets: make(map[string]map[string]*Alert)}
+	raw, err := os.ReadFile(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, st); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Path, err)
+	}
+	if st.Version != stateVersion {
+		return nil, fmt.Errorf("%s: unsupported state version %d", s.Path, st.Version)
+	}
+	if st.Targets == nil {
+		st.Targets = make(map[string]map[string]*Alert)
+	}
+	return st, nil
+}
@@ -0,0 +1,150 @@
+package alert
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hrodrig/pgwd/internal/notify"
+	"github.com/hrodrig/pgwd/internal/postgres"
+)
+
+// run is one one-shot pgwd run: a fresh tracker on the store, evaluating events at c's time.
+func run(t *testing.T, store *Store, c *clock, events ...notify.Event) []notify.Event {
+	t.Helper()
+	tr := NewTracker("prod", nil)
+	tr.Now, tr.Store = c.now, store
+	var send []notify.Event
+	if err := tr.Sync(func() { send, _ = tr.Evaluate(events, nil) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Sync(func() { tr.Delivered(send) }); err != nil {
+		t.Fatal(err)
+	}
+	return send
+}
+
+func TestSync_one_shot_runs(t *testing.T) {
+	store := &Store{Path: filepath.Join(t.TempDir(), "state.json")}
+	c := &clock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ev := totalEvent()
+	ev.Sessions = []postgres.Session{{PID: 1}}
+	if send := run(t, store, c, ev); len(send) != 1 {
+		t.Fatalf("first run: send=%d, want 1", len(send))
+	}
+	c.tick(5 * time.Minute)
+	if send := run(t, store, c, ev); len(send) != 0 {
+		t.Fatalf("second run should be deduplicated, got %+v", send)
+	}
+	c.tick(5 * time.Minute)
+	send := run(t, store, c)
+	if len(send) != 1 || !send[0].Resolved || send[0].Duration != 10*time.Minute {
+		t.Fatalf("third run: want resolved after 10m, got %+v", send)
+	}
+	var st stateFile
+	raw, _ := os.ReadFile(store.Path)
+	if err := json.Unmarshal(raw, &st); err != nil || len(st.Targets) != 0 {
+		t.Errorf("resolved alert should leave the state empty: %s (%v)", raw, err)
+	}
+}
+
+func TestSync_keeps_other_targets(t *testing.T) {
+	store := &Store{Path: filepath.Join(t.TempDir(), "state.json")}
+	for _, target := range []string{"a", "b"} {
+		tr := NewTracker(target, nil)
+		tr.Store = store
+		if err := tr.Sync(func() { evaluate(tr, []notify.Event{totalEvent()}, nil) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st, err := store.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Targets["a"]) != 1 || len(st.Targets["b"]) != 1 {
+		t.Errorf("targets = %+v, want one alert each for a and b", st.Targets)
+	}
+	a := st.Targets["a"]["a|app|total||"]
+	if a == nil || a.State != Firing || a.LastNotified.IsZero() || a.Event.Threshold != "total" {
+		t.Errorf("stored alert = %+v", a)
+	}
+}
+
+func TestSync_state_key(t *testing.T) {
+	store := &Store{Path: filepath.Join(t.TempDir(), "state.json")}
+	for _, key := range []string{"db-1:5432/app", "db-2:5432/app"} {
+		tr := NewTracker("", nil)
+		tr.Store, tr.StateKey = store, key
+		if err := tr.Sync(func() { evaluate(tr, []notify.Event{totalEvent()}, nil) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st, err := store.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Targets) != 2 || len(st.Targets["db-1:5432/app"]) != 1 || len(st.Targets["db-2:5432/app"]) != 1 {
+		t.Errorf("targets = %+v, want one section per state key", st.Targets)
+	}
+}
+
+func TestSync_read_only(t *testing.T) {
+	store := &Store{Path: filepath.Join(t.TempDir(), "state.json"), ReadOnly: true}
+	c := &clock{t: time.Now()}
+	run(t, store, c, totalEvent())
+	if _, err := os.Stat(store.Path); !os.IsNotExist(err) {
+		t.Errorf("read-only store should not write the state file: %v", err)
+	}
+}
+
+func TestSync_unreadable_state(t *testing.T) {
+	store := &Store{Path: filepath.Join(t.TempDir(), "state.json")}
+	if err := os.WriteFile(store.Path, []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tr := NewTracker("", nil)
+	tr.Store = store
+	var send []notify.Event
+	if err := tr.Sync(func() { send, _ = tr.Evaluate([]notify.Event{totalEvent()}, nil) }); err == nil {
+		t.Error("want an error for an unreadable state file")
+	}
+	if len(send) != 1 {
+		t.Errorf("checks should still be evaluated in memory, send=%d", len(send))
+	}
+	if raw, _ := os.ReadFile(store.Path); string(raw) != "not json" {
+		t.Errorf("unreadable state file should be left alone, got %q", raw)
+	}
+}
+
+func TestStore_concurrent_updates(t *testing.T) {
+	dir := t.TempDir()
+	store := &Store{Path: filepath.Join(dir, "state.json")}
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Go(func() {
+			err := store.Update("", func(alerts map[string]*Alert) map[string]*Alert {
+				fp := string(rune('a' + i))
+				alerts[fp] = &Alert{Fingerprint: fp}
+				return alerts
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+	st, err := store.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(st.Targets[""]); n != 20 {
+		t.Errorf("got %d alerts, want 20: updates were lost", n)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 { // state.json and state.json.lock, no temporary files left
+		t.Errorf("directory has %d entries, want 2", len(entries))
+	}
+}
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -9,52 +11,159 @@ import (
 // DefaultThresholdLevels is the default comma-separated percentages for 3-tier alerts (MySQL-style).
 const DefaultThresholdLevels = "75,85,95"
 
-// Config holds all pgwd settings from CLI and env (PGWD_*).
+// Config holds all pgwd settings from CLI, env (PGWD_*) and the config file.
+// JSON and YAML keys are the env names without the PGWD_ prefix, lower-cased. JSON keys are the keys of a
+// target (see LoadTargets); settings with json "-" are process-wide and cannot be set per target.
 type Config struct {
 	// Database
-	DBURL string
+	DBURL string `json:"db_url" yaml:"db_url"`
+	// ClusterWide: check every database on the server (one query), each evaluated against the thresholds on its own.
+	ClusterWide bool `json:"cluster_wide" yaml:"cluster_wide"`
 
 	// Kubernetes: connect to Postgres via kubectl port-forward (optional)
-	KubePostgres          string // e.g. "default/svc/postgres" or "default/pod/postgres-0"
-	KubeContext           string // kubectl context to use (empty = current context)
-	KubeLocalPort         int    // local port for port-forward (default 5432)
-	KubePasswordVar       string // pod env var for password when URL has DISCOVER_MY_PASSWORD (default POSTGRES_PASSWORD)
-	KubePasswordContainer string // container name in pod if not default
+	KubePostgres          string `json:"kube_postgres" yaml:"kube_postgres"`                     // e.g. "default/svc/postgres" or "default/pod/postgres-0"
+	KubeContext           string `json:"kube_context" yaml:"kube_context"`                       // kubectl context to use (empty = current context)
+	KubeLocalPort         int    `json:"kube_local_port" yaml:"kube_local_port"`                 // local port for port-forward (default 5432)
+	KubePasswordVar       string `json:"kube_password_var" yaml:"kube_password_var"`             // pod env var for password when URL has DISCOVER_MY_PASSWORD (default POSTGRES_PASSWORD)
+	KubePasswordContainer string `json:"kube_password_container" yaml:"kube_password_container"` // container name in pod if not default
 	// Kubernetes: connect to Loki via kubectl port-forward when Loki is inside the cluster (optional)
-	KubeLoki           string // e.g. "monitoring/svc/loki" — same format as kube-postgres
-	KubeLokiLocalPort  int    // local port for Loki port-forward (default 3100)
-	KubeLokiRemotePort int    // remote port on the Loki service (default 3100)
+	KubeLoki           string `json:"-" yaml:"kube_loki"`             // e.g. "monitoring/svc/loki" — same format as kube-postgres
+	KubeLokiLocalPort  int    `json:"-" yaml:"kube_loki_local_port"`  // local port for Loki port-forward (default 3100)
+	KubeLokiRemotePort int    `json:"-" yaml:"kube_loki_remote_port"` // remote port on the Loki service (default 3100)
 
 	// Optional context for notifications (Slack health-check style): cluster name, client (service/pod or hostname).
 	// When -kube-postgres is set, Client and namespace are derived from it; Cluster can be detected from kubeconfig or set via PGWD_CLUSTER.
-	Cluster string
-	Client  string
+	Cluster string `json:"cluster" yaml:"cluster"`
+	Client  string `json:"client" yaml:"client"`
 
 	// Thresholds (0 = disabled)
-	ThresholdTotal  int // Deprecated: use ThresholdLevels; will be removed in v1.0.0
-	ThresholdActive int // Deprecated: use ThresholdLevels; will be removed in v1.0.0
-	ThresholdIdle   int
-	StaleAge        int // seconds; connections open longer than this are "stale"
-	ThresholdStale  int // alert when count of stale connections >= this
+	ThresholdTotal  int `json:"threshold_total" yaml:"threshold_total"`   // Deprecated: use ThresholdLevels; will be removed in v1.0.0
+	ThresholdActive int `json:"threshold_active" yaml:"threshold_active"` // Deprecated: use ThresholdLevels; will be removed in v1.0.0
+	ThresholdIdle   int `json:"threshold_idle" yaml:"threshold_idle"`
+	StaleAge        int `json:"stale_age" yaml:"stale_age"`             // seconds; connections open longer than this are "stale"
+	ThresholdStale  int `json:"threshold_stale" yaml:"threshold_stale"` // alert when count of stale connections >= this
+	ThresholdRole   int `json:"threshold_role" yaml:"threshold_role"`   // alert when a single role (usename) has >= this many connections
+	// ThresholdIdleInTransaction: alert when sessions idle in transaction (including aborted) >= this.
+	ThresholdIdleInTransaction int `json:"threshold_idle_in_transaction" yaml:"threshold_idle_in_transaction"`
+	// IdleInTransactionAge: alert when a session has been idle in transaction for >= this many seconds (now() - state_change).
+	IdleInTransactionAge int `json:"idle_in_transaction_age" yaml:"idle_in_transaction_age"`
+	// ThresholdQueryAge: alert when an active query has been running longer than this many seconds (query_start).
+	ThresholdQueryAge int `json:"threshold_query_age" yaml:"threshold_query_age"`
+	// ThresholdTransactionAge: alert when a transaction has been open longer than this many seconds (xact_start).
+	ThresholdTransactionAge int `json:"threshold_transaction_age" yaml:"threshold_transaction_age"`
+	// ThresholdBlocked: alert when sessions blocked by another session's locks (pg_blocking_pids) >= this.
+	ThresholdBlocked int `json:"threshold_blocked" yaml:"threshold_blocked"`
+	// ThresholdBlockedWait: alert when a blocked session has been waiting for >= this many seconds.
+	ThresholdBlockedWait int `json:"threshold_blocked_wait" yaml:"threshold_blocked_wait"`
+	// CheckRoleLimits: alert when a role reaches the ThresholdLevels percentages of its own rolconnlimit.
+	CheckRoleLimits bool `json:"check_role_limits" yaml:"check_role_limits"`
+	// ApplicationThresholds: per-application_name limits, e.g. "billing-api:idle=50,web:total=100" (see ParseApplicationThresholds).
+	ApplicationThresholds string `json:"application_thresholds" yaml:"application_thresholds"`
+	// TopApplications: list the N busiest application_name values in every threshold event (0 = off).
+	TopApplications int `json:"top_applications" yaml:"top_applications"`
+	// SnapshotSize: attach up to N offending sessions (pid, user, application, client, state, ages, query) to events (0 = off).
+	SnapshotSize int `json:"snapshot_size" yaml:"snapshot_size"`
+
+	// PgBouncer: admin console URL (database "pgbouncer") for SHOW POOLS / SHOW CLIENTS checks (empty = off).
+	PgBouncerURL string `json:"pgbouncer_url" yaml:"pgbouncer_url"`
+	// PgBouncer thresholds, per pool (0 = disabled): waiting clients (cl_waiting), longest client wait in
+	// seconds (maxwait), client connections (cl_active + cl_waiting) and server connections (sv_*).
+	PgBouncerThresholdWaiting int `json:"pgbouncer_threshold_waiting" yaml:"pgbouncer_threshold_waiting"`
+	PgBouncerThresholdMaxWait int `json:"pgbouncer_threshold_maxwait" yaml:"pgbouncer_threshold_maxwait"`
+	PgBouncerThresholdClients int `json:"pgbouncer_threshold_clients" yaml:"pgbouncer_threshold_clients"`
+	PgBouncerThresholdServers int `json:"pgbouncer_threshold_servers" yaml:"pgbouncer_threshold_servers"`
+
+	// Remediation (opt-in): terminate or cancel sessions matching a policy; every action is reported as a "remediation" event.
+	// RemediateIdleInTransactionAge: act on sessions idle in transaction for longer than this many seconds (0 = off).
+	RemediateIdleInTransactionAge int `json:"remediate_idle_in_transaction_age" yaml:"remediate_idle_in_transaction_age"`
+	// RemediateStale: act on stale sessions (open longer than StaleAge).
+	RemediateStale bool `json:"remediate_stale" yaml:"remediate_stale"`
+	// RemediateAction: "terminate" (pg_terminate_backend, default) or "cancel" (pg_cancel_backend).
+	RemediateAction string `json:"remediate_action" yaml:"remediate_action"`
+	// RemediateRoles / RemediateApplications: comma-separated allowlists of usename / application_name (empty = any).
+	RemediateRoles        string `json:"remediate_roles" yaml:"remediate_roles"`
+	RemediateApplications string `json:"remediate_applications" yaml:"remediate_applications"`
+	// RemediateExcludeRoles / RemediateExcludeApplications: comma-separated denylists; they win over the allowlists.
+	RemediateExcludeRoles        string `json:"remediate_exclude_roles" yaml:"remediate_exclude_roles"`
+	RemediateExcludeApplications string `json:"remediate_exclude_applications" yaml:"remediate_exclude_applications"`
+	// RemediateMaxKills: at most this many sessions are acted on per run (across databases with ClusterWide).
+	RemediateMaxKills int `json:"remediate_max_kills" yaml:"remediate_max_kills"`
+	// RemediatePrivileged: also act on sessions of superuser and replication roles (skipped by default).
+	RemediatePrivileged bool `json:"remediate_privileged" yaml:"remediate_privileged"`
+
+	// Sustained conditions (daemon mode): a breached threshold only notifies once it has been breached
+	// continuously for For seconds and ForChecks consecutive checks (0 = on the first breach).
+	For       int `json:"for" yaml:"for"`
+	ForChecks int `json:"for_checks" yaml:"for_checks"`
+	// ResolveHysteresis: a firing alert resolves only once its value drops below the threshold minus this
+	// percentage of it (0 = as soon as it is below the threshold). See ClearLevel.
+	ResolveHysteresis int `json:"resolve_hysteresis" yaml:"resolve_hysteresis"`
+	// RepeatInterval: re-send a firing alert whose level has not changed after this many seconds (0 = never).
+	// A change of level (escalation or de-escalation) is sent right away.
+	RepeatInterval int `json:"repeat_interval" yaml:"repeat_interval"`
+	// ForThresholds: per-threshold overrides of For/ForChecks, e.g. "total=300,stale=3checks" (see ParseForThresholds).
+	ForThresholds string `json:"for_thresholds" yaml:"for_thresholds"`
 
 	// Notifications
-	SlackWebhook    string
-	LokiURL         string
-	LokiLabels      string // comma-separated key=value
-	LokiOrgID       string // X-Scope-OrgID header (Loki multi-tenancy); empty = not set
-	LokiBearerToken string // Authorization: Bearer <token>; empty = not set
+	SlackWebhook    string `json:"slack_webhook" yaml:"slack_webhook"`
+	TeamsWebhook    string `json:"teams_webhook" yaml:"teams_webhook"` // Teams Workflows or Incoming Webhook URL
+	LokiURL         string `json:"loki_url" yaml:"loki_url"`
+	LokiLabels      string `json:"loki_labels" yaml:"loki_labels"`             // comma-separated key=value
+	LokiOrgID       string `json:"loki_org_id" yaml:"loki_org_id"`             // X-Scope-OrgID header (Loki multi-tenancy); empty = not set
+	LokiBearerToken string `json:"loki_bearer_token" yaml:"loki_bearer_token"` // Authorization: Bearer <token>; empty = not set
+	// PagerDuty Events API v2: integration (routing) key of the service; URL empty = notify.PagerDutyEventsURL
+	PagerDutyRoutingKey string `json:"pagerduty_routing_key" yaml:"pagerduty_routing_key"`
+	PagerDutyURL        string `json:"pagerduty_url" yaml:"pagerduty_url"`
+	// Generic webhook: body from a text/template over the event (see notify.ParseWebhookTemplate), signed with
+	// HMAC-SHA256 when WebhookSecret is set.
+	WebhookURL      string `json:"webhook_url" yaml:"webhook_url"`
+	WebhookMethod   string `json:"webhook_method" yaml:"webhook_method"`     // POST (default), PUT or PATCH
+	WebhookHeaders  string `json:"webhook_headers" yaml:"webhook_headers"`   // comma-separated Name=value
+	WebhookTemplate string `json:"webhook_template" yaml:"webhook_template"` // empty = the event as JSON
+	WebhookSecret   string `json:"webhook_secret" yaml:"webhook_secret"`
+	// Email over SMTP: server host[:port] (default port from EmailTLS), TLS mode starttls (default), tls or none,
+	// auth plain (default) or login when EmailUsername is set, and comma-separated recipients.
+	EmailSMTPAddr string `json:"email_smtp_addr" yaml:"email_smtp_addr"`
+	EmailTLS      string `json:"email_tls" yaml:"email_tls"`
+	EmailAuth     string `json:"email_auth" yaml:"email_auth"`
+	EmailUsername string `json:"email_username" yaml:"email_username"`
+	EmailPassword string `json:"email_password" yaml:"email_password"`
+	EmailFrom     string `json:"email_from" yaml:"email_from"`
+	EmailTo       string `json:"email_to" yaml:"email_to"`
+	// AlertmanagerURL: comma-separated Alertmanager base URLs (e.g. http://alertmanager:9093), each gets every alert.
+	AlertmanagerURL string `json:"alertmanager_url" yaml:"alertmanager_url"`
+	// ExecCommand runs through the shell for each event (JSON on stdin, PGWD_EVENT_* env), killed after ExecTimeout
+	// seconds (0 = no limit). ExecConcurrency bounds the commands running at once across all targets (0 = no limit).
+	ExecCommand     string `json:"exec_command" yaml:"exec_command"`
+	ExecTimeout     int    `json:"exec_timeout" yaml:"exec_timeout"`
+	ExecConcurrency int    `json:"-" yaml:"exec_concurrency"`
+	// Receivers and Routes: route events by level, threshold, database and cluster to named receivers (config file
+	// only, see Route). Without routes every event goes to the notifiers above.
+	Receivers []Receiver `json:"-" yaml:"receivers"`
+	Routes    []Route    `json:"-" yaml:"routes"`
 
 	// Behavior
-	Interval                int // seconds; 0 = run once
-	DryRun                  bool
-	ForceNotification       bool   // send a test notification regardless of thresholds (to validate delivery/format)
-	NotifyOnConnectFailure  bool   // when Postgres connection fails, send an alert to notifiers (infrastructure alert)
-	DefaultThresholdPercent int    // when threshold-total/active are set, used for the one left at 0 (1-100, default 80)
-	ThresholdLevels         string // comma-separated percentages for 3-tier alerts, e.g. "75,85,95" (attention/alert/danger). Used when both total and active are 0.
+	Interval int `json:"-" yaml:"interval"` // seconds; 0 = run once
+	// CheckTimeout: seconds one check (queries and notifications) may take before it is cancelled (0 = no limit).
+	CheckTimeout int `json:"check_timeout" yaml:"check_timeout"`
+	// ConfigFile: YAML config file (see LoadFile); empty = none.
+	ConfigFile string `json:"-" yaml:"-"`
+	// StateFile: JSON file keeping alert state (pending/firing alerts, notification times) between runs, so -for,
+	// resolved and -repeat-interval also work in one-shot mode (cron); empty = state in memory only.
+	StateFile string `json:"-" yaml:"state_file"`
+	// SilenceFile: JSON file of silences managed with `pgwd silence` (see package silence); empty = no silences.
+	SilenceFile string `json:"-" yaml:"silence_file"`
+	// TargetsFile: JSON file listing the databases to monitor (see LoadTargets); empty = only DBURL.
+	TargetsFile             string `json:"-" yaml:"-"`
+	DryRun                  bool   `json:"dry_run" yaml:"dry_run"`
+	ForceNotification       bool   `json:"force_notification" yaml:"force_notification"`               // send a test notification regardless of thresholds (to validate delivery/format)
+	NotifyOnConnectFailure  bool   `json:"notify_on_connect_failure" yaml:"notify_on_connect_failure"` // when Postgres connection fails, send an alert to notifiers (infrastructure alert)
+	DefaultThresholdPercent int    `json:"default_threshold_percent" yaml:"default_threshold_percent"` // when threshold-total/active are set, used for the one left at 0 (1-100, default 80)
+	ThresholdLevels         string `json:"threshold_levels" yaml:"threshold_levels"`                   // comma-separated percentages for 3-tier alerts, e.g. "75,85,95" (attention/alert/danger). Used when both total and active are 0.
 	// TestMaxConnections: if > 0, use instead of server max_connections for defaults and display (for testing alerts).
-	TestMaxConnections int
+	TestMaxConnections int `json:"test_max_connections" yaml:"test_max_connections"`
 	// ValidateK8sAccess: if true, validate kubectl connectivity and list pods, then exit. Uses KubeContext if set.
-	ValidateK8sAccess bool
+	ValidateK8sAccess bool `json:"-" yaml:"-"`
 }
 
 func env(key, def string) string {
@@ -81,41 +190,120 @@ func envBool(key string, def bool) bool {
 	return v == "1" || v == "true" || v == "yes"
 }
 
-// FromEnv builds config from environment variables (PGWD_*).
+// FromEnv builds config from the defaults and environment variables (PGWD_*).
 func FromEnv() Config {
+	c := Defaults()
+	c.ApplyEnv()
+	return c
+}
+
+// Defaults returns the built-in settings, before the config file, env and flags.
+func Defaults() Config {
 	return Config{
-		DBURL:                   env("DB_URL", ""),
-		KubePostgres:            env("KUBE_POSTGRES", ""),
-		KubeContext:             env("KUBE_CONTEXT", ""),
-		KubeLocalPort:           envInt("KUBE_LOCAL_PORT", 5432),
-		KubePasswordVar:         env("KUBE_PASSWORD_VAR", "POSTGRES_PASSWORD"),
-		KubePasswordContainer:   env("KUBE_PASSWORD_CONTAINER", ""),
-		KubeLoki:                env("KUBE_LOKI", ""),
-		KubeLokiLocalPort:       envInt("KUBE_LOKI_LOCAL_PORT", 3100),
-		KubeLokiRemotePort:      envInt("KUBE_LOKI_REMOTE_PORT", 3100),
-		Cluster:                 env("CLUSTER", ""),
-		Client:                  env("CLIENT", ""),
-		ThresholdTotal:          envInt("THRESHOLD_TOTAL", 0),
-		ThresholdActive:         envInt("THRESHOLD_ACTIVE", 0),
-		ThresholdIdle:           envInt("THRESHOLD_IDLE", 0),
-		StaleAge:                envInt("STALE_AGE", 0),
-		ThresholdStale:          envInt("THRESHOLD_STALE", 0),
-		SlackWebhook:            env("SLACK_WEBHOOK", ""),
-		LokiURL:                 env("LOKI_URL", ""),
-		LokiLabels:              env("LOKI_LABELS", ""),
-		LokiOrgID:               env("LOKI_ORG_ID", ""),
-		LokiBearerToken:         env("LOKI_BEARER_TOKEN", ""),
-		Interval:                envInt("INTERVAL", 0),
-		DryRun:                  envBool("DRY_RUN", false),
-		ForceNotification:       envBool("FORCE_NOTIFICATION", false),
-		NotifyOnConnectFailure:  envBool("NOTIFY_ON_CONNECT_FAILURE", false),
-		DefaultThresholdPercent: envInt("DEFAULT_THRESHOLD_PERCENT", 80),
-		ThresholdLevels:         env("THRESHOLD_LEVELS", DefaultThresholdLevels),
-		TestMaxConnections:      envInt("TEST_MAX_CONNECTIONS", 0),
-		ValidateK8sAccess:       envBool("VALIDATE_K8S_ACCESS", false),
+		KubeLocalPort:           5432,
+		KubePasswordVar:         "POSTGRES_PASSWORD",
+		KubeLokiLocalPort:       3100,
+		KubeLokiRemotePort:      3100,
+		SnapshotSize:            5,
+		RemediateAction:         "terminate",
+		RemediateMaxKills:       5,
+		CheckTimeout:            30,
+		ExecTimeout:             10,
+		ExecConcurrency:         4,
+		RepeatInterval:          3600,
+		DefaultThresholdPercent: 80,
+		ThresholdLevels:         DefaultThresholdLevels,
 	}
 }
 
+// ApplyEnv overrides c with the PGWD_* environment variables that are set.
+func (c *Config) ApplyEnv() {
+	c.ConfigFile = env("CONFIG", c.ConfigFile)
+	c.DBURL = env("DB_URL", c.DBURL)
+	c.ClusterWide = envBool("CLUSTER_WIDE", c.ClusterWide)
+	c.KubePostgres = env("KUBE_POSTGRES", c.KubePostgres)
+	c.KubeContext = env("KUBE_CONTEXT", c.KubeContext)
+	c.KubeLocalPort = envInt("KUBE_LOCAL_PORT", c.KubeLocalPort)
+	c.KubePasswordVar = env("KUBE_PASSWORD_VAR", c.KubePasswordVar)
+	c.KubePasswordContainer = env("KUBE_PASSWORD_CONTAINER", c.KubePasswordContainer)
+	c.KubeLoki = env("KUBE_LOKI", c.KubeLoki)
+	c.KubeLokiLocalPort = envInt("KUBE_LOKI_LOCAL_PORT", c.KubeLokiLocalPort)
+	c.KubeLokiRemotePort = envInt("KUBE_LOKI_REMOTE_PORT", c.KubeLokiRemotePort)
+	c.Cluster = env("CLUSTER", c.Cluster)
+	c.Client = env("CLIENT", c.Client)
+	c.ThresholdTotal = envInt("THRESHOLD_TOTAL", c.ThresholdTotal)
+	c.ThresholdActive = envInt("THRESHOLD_ACTIVE", c.ThresholdActive)
+	c.ThresholdIdle = envInt("THRESHOLD_IDLE", c.ThresholdIdle)
+	c.StaleAge = envInt("STALE_AGE", c.StaleAge)
+	c.ThresholdStale = envInt("THRESHOLD_STALE", c.ThresholdStale)
+	c.ThresholdRole = envInt("THRESHOLD_ROLE", c.ThresholdRole)
+	c.ThresholdIdleInTransaction = envInt("THRESHOLD_IDLE_IN_TRANSACTION", c.ThresholdIdleInTransaction)
+	c.IdleInTransactionAge = envInt("IDLE_IN_TRANSACTION_AGE", c.IdleInTransactionAge)
+	c.ThresholdQueryAge = envInt("THRESHOLD_QUERY_AGE", c.ThresholdQueryAge)
+	c.ThresholdTransactionAge = envInt("THRESHOLD_TRANSACTION_AGE", c.ThresholdTransactionAge)
+	c.ThresholdBlocked = envInt("THRESHOLD_BLOCKED", c.ThresholdBlocked)
+	c.ThresholdBlockedWait = envInt("THRESHOLD_BLOCKED_WAIT", c.ThresholdBlockedWait)
+	c.CheckRoleLimits = envBool("CHECK_ROLE_LIMITS", c.CheckRoleLimits)
+	c.ApplicationThresholds = env("APPLICATION_THRESHOLDS", c.ApplicationThresholds)
+	c.TopApplications = envInt("TOP_APPLICATIONS", c.TopApplications)
+	c.SnapshotSize = envInt("SNAPSHOT_SIZE", c.SnapshotSize)
+	c.PgBouncerURL = env("PGBOUNCER_URL", c.PgBouncerURL)
+	c.PgBouncerThresholdWaiting = envInt("PGBOUNCER_THRESHOLD_WAITING", c.PgBouncerThresholdWaiting)
+	c.PgBouncerThresholdMaxWait = envInt("PGBOUNCER_THRESHOLD_MAXWAIT", c.PgBouncerThresholdMaxWait)
+	c.PgBouncerThresholdClients = envInt("PGBOUNCER_THRESHOLD_CLIENTS", c.PgBouncerThresholdClients)
+	c.PgBouncerThresholdServers = envInt("PGBOUNCER_THRESHOLD_SERVERS", c.PgBouncerThresholdServers)
+	c.RemediateIdleInTransactionAge = envInt("REMEDIATE_IDLE_IN_TRANSACTION_AGE", c.RemediateIdleInTransactionAge)
+	c.RemediateStale = envBool("REMEDIATE_STALE", c.RemediateStale)
+	c.RemediateAction = env("REMEDIATE_ACTION", c.RemediateAction)
+	c.RemediateRoles = env("REMEDIATE_ROLES", c.RemediateRoles)
+	c.RemediateApplications = env("REMEDIATE_APPLICATIONS", c.RemediateApplications)
+	c.RemediateExcludeRoles = env("REMEDIATE_EXCLUDE_ROLES", c.RemediateExcludeRoles)
+	c.RemediateExcludeApplications = env("REMEDIATE_EXCLUDE_APPLICATIONS", c.RemediateExcludeApplications)
+	c.RemediateMaxKills = envInt("REMEDIATE_MAX_KILLS", c.RemediateMaxKills)
+	c.RemediatePrivileged = envBool("REMEDIATE_PRIVILEGED", c.RemediatePrivileged)
+	c.For = envInt("FOR", c.For)
+	c.ForChecks = envInt("FOR_CHECKS", c.ForChecks)
+	c.ForThresholds = env("FOR_THRESHOLDS", c.ForThresholds)
+	c.ResolveHysteresis = envInt("RESOLVE_HYSTERESIS", c.ResolveHysteresis)
+	c.RepeatInterval = envInt("REPEAT_INTERVAL", c.RepeatInterval)
+	c.SlackWebhook = env("SLACK_WEBHOOK", c.SlackWebhook)
+	c.TeamsWebhook = env("TEAMS_WEBHOOK", c.TeamsWebhook)
+	c.LokiURL = env("LOKI_URL", c.LokiURL)
+	c.LokiLabels = env("LOKI_LABELS", c.LokiLabels)
+	c.LokiOrgID = env("LOKI_ORG_ID", c.LokiOrgID)
+	c.LokiBearerToken = env("LOKI_BEARER_TOKEN", c.LokiBearerToken)
+	c.PagerDutyRoutingKey = env("PAGERDUTY_ROUTING_KEY", c.PagerDutyRoutingKey)
+	c.PagerDutyURL = env("PAGERDUTY_URL", c.PagerDutyURL)
+	c.WebhookURL = env("WEBHOOK_URL", c.WebhookURL)
+	c.WebhookMethod = env("WEBHOOK_METHOD", c.WebhookMethod)
+	c.WebhookHeaders = env("WEBHOOK_HEADERS", c.WebhookHeaders)
+	c.WebhookTemplate = env("WEBHOOK_TEMPLATE", c.WebhookTemplate)
+	c.WebhookSecret = env("WEBHOOK_SECRET", c.WebhookSecret)
+	c.EmailSMTPAddr = env("EMAIL_SMTP_ADDR", c.EmailSMTPAddr)
+	c.EmailTLS = env("EMAIL_TLS", c.EmailTLS)
+	c.EmailAuth = env("EMAIL_AUTH", c.EmailAuth)
+	c.EmailUsername = env("EMAIL_USERNAME", c.EmailUsername)
+	c.EmailPassword = env("EMAIL_PASSWORD", c.EmailPassword)
+	c.EmailFrom = env("EMAIL_FROM", c.EmailFrom)
+	c.EmailTo = env("EMAIL_TO", c.EmailTo)
+	c.AlertmanagerURL = env("ALERTMANAGER_URL", c.AlertmanagerURL)
+	c.ExecCommand = env("EXEC_COMMAND", c.ExecCommand)
+	c.ExecTimeout = envInt("EXEC_TIMEOUT", c.ExecTimeout)
+	c.ExecConcurrency = envInt("EXEC_CONCURRENCY", c.ExecConcurrency)
+	c.Interval = envInt("INTERVAL", c.Interval)
+	c.CheckTimeout = envInt("CHECK_TIMEOUT", c.CheckTimeout)
+	c.TargetsFile = env("TARGETS", c.TargetsFile)
+	c.StateFile = env("STATE_FILE", c.StateFile)
+	c.SilenceFile = env("SILENCE_FILE", c.SilenceFile)
+	c.DryRun = envBool("DRY_RUN", c.DryRun)
+	c.ForceNotification = envBool("FORCE_NOTIFICATION", c.ForceNotification)
+	c.NotifyOnConnectFailure = envBool("NOTIFY_ON_CONNECT_FAILURE", c.NotifyOnConnectFailure)
+	c.DefaultThresholdPercent = envInt("DEFAULT_THRESHOLD_PERCENT", c.DefaultThresholdPercent)
+	c.ThresholdLevels = env("THRESHOLD_LEVELS", c.ThresholdLevels)
+	c.TestMaxConnections = envInt("TEST_MAX_CONNECTIONS", c.TestMaxConnections)
+	c.ValidateK8sAccess = envBool("VALIDATE_K8S_ACCESS", c.ValidateK8sAccess)
+}
+
 // OverrideWith sets fields from a set of optional CLI overrides (pointers).
 // Non-nil values override the config.
 func (c *Config) OverrideWith(overrides struct {
@@ -222,10 +410,172 @@ func (c *Config) UsesLevelMode() bool {
 // HasAnyThreshold returns true if at least one threshold is set or level mode is active.
 func (c *Config) HasAnyThreshold() bool {
 	return c.ThresholdTotal > 0 || c.ThresholdActive > 0 || c.ThresholdIdle > 0 ||
-		c.ThresholdStale > 0 || c.UsesLevelMode()
+		c.ThresholdStale > 0 || c.ThresholdRole > 0 || c.CheckRoleLimits || c.ApplicationThresholds != "" ||
+		c.hasSessionThreshold() || c.HasPgBouncerThreshold() || c.UsesLevelMode()
+}
+
+// hasSessionThreshold returns true if a threshold on session age or state (idle in transaction,
+// long queries/transactions, blocking) is set.
+func (c *Config) hasSessionThreshold() bool {
+	return c.ThresholdIdleInTransaction > 0 || c.IdleInTransactionAge > 0 ||
+		c.ThresholdQueryAge > 0 || c.ThresholdTransactionAge > 0 ||
+		c.ThresholdBlocked > 0 || c.ThresholdBlockedWait > 0
+}
+
+// HasPgBouncerThreshold returns true if at least one PgBouncer pool threshold is set.
+func (c *Config) HasPgBouncerThreshold() bool {
+	return c.PgBouncerThresholdWaiting > 0 || c.PgBouncerThresholdMaxWait > 0 ||
+		c.PgBouncerThresholdClients > 0 || c.PgBouncerThresholdServers > 0
+}
+
+// ApplicationThreshold is one per-application limit: alert when Metric (total, active or idle)
+// connections with application_name = Application reach Value.
+type ApplicationThreshold struct {
+	Application string
+	Metric      string
+	Value       int
+}
+
+// ParseApplicationThresholds parses "billing-api:idle=50,web:total=100" into thresholds.
+// Each entry is application:metric=N with metric one of total, active, idle and N >= 1.
+// The application name is everything before the last colon. Empty input returns nil, nil.
+func ParseApplicationThresholds(s string) ([]ApplicationThreshold, error) {
+	var out []ApplicationThreshold
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		i := strings.LastIndex(part, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("application threshold %q: want application:metric=N", part)
+		}
+		metric, value, ok := strings.Cut(part[i+1:], "=")
+		metric = strings.TrimSpace(metric)
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil || n < 1 {
+			return nil, fmt.Errorf("application threshold %q: want application:metric=N with N >= 1", part)
+		}
+		if metric != "total" && metric != "active" && metric != "idle" {
+			return nil, fmt.Errorf("application threshold %q: metric must be total, active or idle", part)
+		}
+		out = append(out, ApplicationThreshold{Application: strings.TrimSpace(part[:i]), Metric: metric, Value: n})
+	}
+	return out, nil
+}
+
+// ForRule is how long a threshold must stay breached before it notifies: Seconds since the first breached
+// check and Checks consecutive breached checks (0 = no requirement).
+type ForRule struct {
+	Seconds int
+	Checks  int
+}
+
+// conditionThresholds are the thresholds of Event.Threshold that -for applies to.
+var conditionThresholds = []string{
+	"total", "active", "idle", "stale", "role", "role_connlimit", "application",
+	"idle_in_transaction", "idle_in_transaction_age", "long_query", "long_transaction",
+	"blocked", "blocked_wait", "connect_failure", "too_many_clients",
+	"pgbouncer_waiting", "pgbouncer_maxwait", "pgbouncer_clients", "pgbouncer_servers", "pgbouncer_connect_failure",
+}
+
+// ParseForThresholds parses "total=300,stale=3checks" into per-threshold rules. Each entry is threshold=N
+// (N seconds) or threshold=Nchecks (N consecutive checks), with N >= 0 and threshold an event threshold name
+// (total, active, idle, stale, role, application, long_query, pgbouncer_waiting, ...). Empty input returns nil, nil.
+func ParseForThresholds(s string) (map[string]ForRule, error) {
+	var out map[string]ForRule
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || !slices.Contains(conditionThresholds, name) {
+			return nil, fmt.Errorf("for threshold %q: want threshold=N with threshold one of %s", part, strings.Join(conditionThresholds, ", "))
+		}
+		var r ForRule
+		digits, checks := strings.CutSuffix(value, "checks")
+		n, err := strconv.Atoi(strings.TrimSpace(digits))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("for threshold %q: want N seconds or Nchecks with N >= 0", part)
+		}
+		if checks {
+			r.Checks = n
+		} else {
+			r.Seconds = n
+		}
+		if out == nil {
+			out = make(map[string]ForRule)
+		}
+		out[name] = r
+	}
+	return out, nil
+}
+
+// ForRule returns the rule for threshold: its ForThresholds entry, else For and ForChecks.
+// ForThresholds is assumed valid (see Validate).
+func (c *Config) ForRule(threshold string) ForRule {
+	overrides, _ := ParseForThresholds(c.ForThresholds)
+	if r, ok := overrides[threshold]; ok {
+		return r
+	}
+	return ForRule{Seconds: c.For, Checks: c.ForChecks}
+}
+
+// ClearLevel returns the value a firing alert on limit must drop below to resolve: limit minus
+// ResolveHysteresis percent of it.
+func (c *Config) ClearLevel(limit int) int {
+	return limit - limit*c.ResolveHysteresis/100
+}
+
+// UsesFor reports whether any threshold waits before notifying (-for, -for-checks or -for-thresholds).
+func (c *Config) UsesFor() bool {
+	return c.For > 0 || c.ForChecks > 1 || c.ForThresholds != ""
+}
+
+// RoleLevels returns the percentages used for per-role levels: ThresholdLevels when valid, else DefaultThresholdLevels.
+func (c *Config) RoleLevels() []int {
+	if levels := ParseThresholdLevels(c.ThresholdLevels); len(levels) >= 3 {
+		return levels
+	}
+	return ParseThresholdLevels(DefaultThresholdLevels)
+}
+
+// RemediationEnabled returns true when at least one remediation policy is set.
+func (c *Config) RemediationEnabled() bool {
+	return c.RemediateIdleInTransactionAge > 0 || c.RemediateStale
+}
+
+// RemediationAllows reports whether a session of role and application may be remediated:
+// not in an exclude list, and in the allowlists when they are set. Names match exactly.
+func (c *Config) RemediationAllows(role, application string) bool {
+	if inList(c.RemediateExcludeRoles, role) || inList(c.RemediateExcludeApplications, application) {
+		return false
+	}
+	if c.RemediateRoles != "" && !inList(c.RemediateRoles, role) {
+		return false
+	}
+	if c.RemediateApplications != "" && !inList(c.RemediateApplications, application) {
+		return false
+	}
+	return true
+}
+
+// inList reports whether name is one of the comma-separated entries of list.
+func inList(list, name string) bool {
+	for _, part := range strings.Split(list, ",") {
+		if part = strings.TrimSpace(part); part != "" && part == name {
+			return true
+		}
+	}
+	return false
 }
 
-// HasAnyNotifier returns true if Slack or Loki is configured.
+// HasAnyNotifier returns true if Slack, Teams, Loki, PagerDuty, a webhook, email, Alertmanager or a command is
+// configured, or a receiver for routes.
 func (c *Config) HasAnyNotifier() bool {
-	return c.SlackWebhook != "" || c.LokiURL != "" || c.KubeLoki != ""
+	return c.SlackWebhook != "" || c.TeamsWebhook != "" || c.LokiURL != "" || c.KubeLoki != "" ||
+		c.PagerDutyRoutingKey != "" || c.WebhookURL != "" || c.EmailSMTPAddr != "" || c.AlertmanagerURL != "" ||
+		c.ExecCommand != "" || len(c.Receivers) > 0
 }
@@ -22,7 +22,8 @@ func TestFromEnv_Defaults(t *testing.T) {
 	prefixes := []string{"PGWD_DB_URL", "PGWD_KUBE_POSTGRES", "PGWD_KUBE_LOKI", "PGWD_KUBE_LOCAL_PORT", "PGWD_KUBE_LOKI_LOCAL_PORT", "PGWD_KUBE_LOKI_REMOTE_PORT", "PGWD_KUBE_PASSWORD_VAR", "PGWD_KUBE_PASSWORD_CONTAINER",
 		"PGWD_THRESHOLD_TOTAL", "PGWD_THRESHOLD_ACTIVE", "PGWD_THRESHOLD_IDLE",
 		"PGWD_STALE_AGE", "PGWD_THRESHOLD_STALE", "PGWD_SLACK_WEBHOOK", "PGWD_LOKI_URL", "PGWD_LOKI_LABELS",
-		"PGWD_INTERVAL", "PGWD_DRY_RUN", "PGWD_FORCE_NOTIFICATION", "PGWD_NOTIFY_ON_CONNECT_FAILURE", "PGWD_DEFAULT_THRESHOLD_PERCENT", "PGWD_VALIDATE_K8S_ACCESS"}
+		"PGWD_INTERVAL", "PGWD_DRY_RUN", "PGWD_FORCE_NOTIFICATION", "PGWD_NOTIFY_ON_CONNECT_FAILURE", "PGWD_DEFAULT_THRESHOLD_PERCENT", "PGWD_VALIDATE_K8S_ACCESS",
+		"PGWD_CHECK_TIMEOUT", "PGWD_TARGETS"}
 	for _, p := range prefixes {
 		os.Unsetenv(p)
 	}
@@ -39,11 +40,28 @@ func TestFromEnv_Defaults(t *testing.T) {
 	if cfg.DefaultThresholdPercent != 80 {
 		t.Errorf("DefaultThresholdPercent default: got %d", cfg.DefaultThresholdPercent)
 	}
+	if cfg.CheckTimeout != 30 || cfg.TargetsFile != "" {
+		t.Errorf("CheckTimeout default: got %d, TargetsFile default: got %q", cfg.CheckTimeout, cfg.TargetsFile)
+	}
 	if cfg.DryRun || cfg.ForceNotification || cfg.NotifyOnConnectFailure || cfg.ValidateK8sAccess {
 		t.Errorf("DryRun=%v ForceNotification=%v NotifyOnConnectFailure=%v ValidateK8sAccess=%v", cfg.DryRun, cfg.ForceNotification, cfg.NotifyOnConnectFailure, cfg.ValidateK8sAccess)
 	}
 }
 
+func TestFromEnv_alert_defaults(t *testing.T) {
+	for _, k := range []string{"PGWD_FOR", "PGWD_FOR_CHECKS", "PGWD_FOR_THRESHOLDS", "PGWD_RESOLVE_HYSTERESIS", "PGWD_REPEAT_INTERVAL"} {
+		os.Unsetenv(k)
+	}
+	cfg := FromEnv()
+	if cfg.UsesFor() || cfg.ResolveHysteresis != 0 || cfg.RepeatInterval != 3600 {
+		t.Errorf("for=%d for_checks=%d for_thresholds=%q resolve_hysteresis=%d repeat_interval=%d", cfg.For, cfg.ForChecks, cfg.ForThresholds, cfg.ResolveHysteresis, cfg.RepeatInterval)
+	}
+	defer setEnv("PGWD_REPEAT_INTERVAL", "0")()
+	if cfg := FromEnv(); cfg.RepeatInterval != 0 {
+		t.Errorf("PGWD_REPEAT_INTERVAL=0: got %d", cfg.RepeatInterval)
+	}
+}
+
 func TestFromEnv_ValidateK8sAccess(t *testing.T) {
 	defer setEnv("PGWD_VALIDATE_K8S_ACCESS", "true")()
 	cfg := FromEnv()
@@ -88,6 +106,17 @@ func TestHasAnyThreshold(t *testing.T) {
 		{"active", Config{ThresholdActive: 50}, true},
 		{"idle", Config{ThresholdIdle: 40}, true},
 		{"stale", Config{ThresholdStale: 1}, true},
+		{"role", Config{ThresholdRole: 20}, true},
+		{"idle in transaction", Config{ThresholdIdleInTransaction: 5}, true},
+		{"idle in transaction age", Config{IdleInTransactionAge: 300}, true},
+		{"query age", Config{ThresholdQueryAge: 300}, true},
+		{"transaction age", Config{ThresholdTransactionAge: 600}, true},
+		{"blocked", Config{ThresholdBlocked: 5}, true},
+		{"blocked wait", Config{ThresholdBlockedWait: 30}, true},
+		{"role limits", Config{CheckRoleLimits: true}, true},
+		{"application", Config{ApplicationThresholds: "billing-api:idle=50"}, true},
+		{"pgbouncer waiting", Config{PgBouncerThresholdWaiting: 1}, true},
+		{"pgbouncer maxwait", Config{PgBouncerThresholdMaxWait: 5}, true},
 		{"level mode", Config{ThresholdTotal: 0, ThresholdActive: 0, ThresholdLevels: "75,85,95"}, true},
 		{"all", Config{ThresholdTotal: 1, ThresholdActive: 1, ThresholdIdle: 1, ThresholdStale: 1}, true},
 	}
@@ -149,6 +178,104 @@ func TestUsesLevelMode(t *testing.T) {
 	}
 }
 
+func TestRoleLevels(t *testing.T) {
+	c := Config{ThresholdLevels: "70,80,90"}
+	if got := c.RoleLevels(); len(got) != 3 || got[0] != 70 {
+		t.Errorf("RoleLevels() = %v, want [70 80 90]", got)
+	}
+	c = Config{ThresholdLevels: "bad"}
+	if got := c.RoleLevels(); len(got) != 3 || got[0] != 75 {
+		t.Errorf("RoleLevels() with invalid levels = %v, want default [75 85 95]", got)
+	}
+}
+
+func TestParseApplicationThresholds(t *testing.T) {
+	got, err := ParseApplicationThresholds(" billing-api:idle=50 , web:total=100,host:8080:active=3")
+	if err != nil {
+		t.Fatalf("ParseApplicationThresholds: %v", err)
+	}
+	want := []ApplicationThreshold{
+		{Application: "billing-api", Metric: "idle", Value: 50},
+		{Application: "web", Metric: "total", Value: 100},
+		{Application: "host:8080", Metric: "active", Value: 3},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("[%d] got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if got, err := ParseApplicationThresholds(""); err != nil || got != nil {
+		t.Errorf("empty: got %v, %v", got, err)
+	}
+	for _, bad := range []string{"billing-api", "billing-api:idle", "billing-api:idle=0", "billing-api:waiting=5", ":idle=5", "app:idle=x"} {
+		if _, err := ParseApplicationThresholds(bad); err == nil {
+			t.Errorf("ParseApplicationThresholds(%q): expected error", bad)
+		}
+	}
+}
+
+func TestParseForThresholds(t *testing.T) {
+	got, err := ParseForThresholds(" total=300 , stale=3checks,pgbouncer_waiting=0")
+	if err != nil {
+		t.Fatalf("ParseForThresholds: %v", err)
+	}
+	want := map[string]ForRule{
+		"total":             {Seconds: 300},
+		"stale":             {Checks: 3},
+		"pgbouncer_waiting": {},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for k, w := range want {
+		if got[k] != w {
+			t.Errorf("[%s] got %+v, want %+v", k, got[k], w)
+		}
+	}
+	if got, err := ParseForThresholds(""); err != nil || got != nil {
+		t.Errorf("empty: got %v, %v", got, err)
+	}
+	for _, bad := range []string{"total", "totl=5", "total=-1", "total=x", "total=3check", "test=5", "=5"} {
+		if _, err := ParseForThresholds(bad); err == nil {
+			t.Errorf("ParseForThresholds(%q): expected error", bad)
+		}
+	}
+}
+
+func TestForRule(t *testing.T) {
+	c := Config{For: 120, ForChecks: 2, ForThresholds: "stale=3checks,idle=0"}
+	if r := c.ForRule("total"); r != (ForRule{Seconds: 120, Checks: 2}) {
+		t.Errorf("total: got %+v, want the -for/-for-checks default", r)
+	}
+	if r := c.ForRule("stale"); r != (ForRule{Checks: 3}) {
+		t.Errorf("stale: got %+v, want {Checks: 3}", r)
+	}
+	if r := c.ForRule("idle"); r != (ForRule{}) {
+		t.Errorf("idle: got %+v, want zero (fire on first breach)", r)
+	}
+	if (&Config{}).UsesFor() || (&Config{ForChecks: 1}).UsesFor() || !(&Config{ForChecks: 2}).UsesFor() {
+		t.Error("UsesFor: want true only when a threshold waits")
+	}
+}
+
+func TestClearLevel(t *testing.T) {
+	tests := []struct{ hysteresis, limit, want int }{
+		{0, 80, 80},
+		{10, 80, 72},
+		{10, 5, 5},
+		{50, 3, 2},
+	}
+	for _, tt := range tests {
+		c := Config{ResolveHysteresis: tt.hysteresis}
+		if got := c.ClearLevel(tt.limit); got != tt.want {
+			t.Errorf("ClearLevel(%d) with %d%% = %d, want %d", tt.limit, tt.hysteresis, got, tt.want)
+		}
+	}
+}
+
 func TestHasAnyNotifier(t *testing.T) {
 	tests := []struct {
 		name string
@@ -211,3 +338,29 @@ func TestOverrideWith(t *testing.T) {
 		t.Errorf("SlackWebhook should be unchanged when nil override: got %q", c.SlackWebhook)
 	}
 }
+
+func TestRemediationAllows(t *testing.T) {
+	tests := []struct {
+		name      string
+		c         Config
+		role, app string
+		want      bool
+	}{
+		{"no lists", Config{}, "app", "billing-api", true},
+		{"role allowed", Config{RemediateRoles: "app, batch"}, "batch", "", true},
+		{"role not allowed", Config{RemediateRoles: "app,batch"}, "postgres", "", false},
+		{"application allowed", Config{RemediateApplications: "billing-api"}, "app", "billing-api", true},
+		{"application not allowed", Config{RemediateApplications: "billing-api"}, "app", "psql", false},
+		{"role excluded", Config{RemediateExcludeRoles: "postgres"}, "postgres", "billing-api", false},
+		{"application excluded", Config{RemediateExcludeApplications: "pg_dump"}, "app", "pg_dump", false},
+		{"exclude wins over allow", Config{RemediateRoles: "app", RemediateExcludeApplications: "pg_dump"}, "app", "pg_dump", false},
+		{"unnamed application with allowlist", Config{RemediateApplications: "billing-api"}, "app", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.c.RemediationAllows(tt.role, tt.app); got != tt.want {
+				t.Errorf("RemediationAllows(%q, %q) = %v, want %v", tt.role, tt.app, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is a YAML config file (-config). Top-level keys are Config's YAML keys (the env names without
+// PGWD_, lower-cased); an optional "targets" list holds per-target settings like a targets file:
+//
+//	interval: 60
+//	slack_webhook: https://hooks.slack.com/services/...
+//	targets:
+//	  - name: billing
+//	    db_url: postgres://pgwd@db1:5432/billing
+//	    threshold_levels: "70,80,90"
+//
+// Settings from the file are applied before env and flags, so PGWD_* and command-line flags win.
+type File struct {
+	Path string
+	root *yaml.Node // top-level mapping; nil for an empty file
+}
+
+// fileSchema is everything a config file may contain; decoding into it with KnownFields rejects unknown keys.
+type fileSchema struct {
+	Config  `yaml:",inline"`
+	Targets []Target `yaml:"targets"`
+}
+
+// LoadFile reads and checks the config file at path: unknown keys, wrong value types and process-wide
+// settings inside targets are errors that name the file and line.
+func LoadFile(path string) (*File, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFile(path, raw)
+}
+
+// ParseFile is LoadFile for a document already in memory; path is only used in error messages.
+func ParseFile(path string, raw []byte) (*File, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fileError(path, err)
+	}
+	f := &File{Path: path}
+	if len(doc.Content) == 0 {
+		return f, nil
+	}
+	f.root = doc.Content[0]
+	if f.root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: want a mapping of settings", path, f.root.Line)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	dec.KnownFields(true)
+	if err := dec.Decode(&fileSchema{}); err != nil {
+		return nil, fileError(path, err)
+	}
+	for i, t := range f.targetNodes() {
+		if t.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s:%d: targets[%d]: want a mapping of settings", path, t.Line, i)
+		}
+		for j := 0; j+1 < len(t.Content); j += 2 {
+			if key := t.Content[j]; processWideKeys[key.Value] {
+				return nil, fmt.Errorf("%s:%d: targets[%d]: %s is process-wide and cannot be set per target", path, key.Line, i, key.Value)
+			}
+		}
+	}
+	return f, nil
+}
+
+// Apply sets the top-level settings of the file on c; keys the file does not set keep their value.
+func (f *File) Apply(c *Config) error {
+	if f == nil || f.root == nil {
+		return nil
+	}
+	if err := f.root.Decode(c); err != nil {
+		return fileError(f.Path, err)
+	}
+	return nil
+}
+
+// Targets returns the file's targets, each starting as a copy of base (the merged file, env and flags).
+// It returns nil when the file has no targets list.
+func (f *File) Targets(base Config) ([]Target, error) {
+	nodes := f.targetNodes()
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+	targets := make([]Target, 0, len(nodes))
+	seen := make(map[string]bool)
+	for i, n := range nodes {
+		t := Target{Config: base}
+		if err := n.Decode(&t); err != nil {
+			return nil, fileError(f.Path, err)
+		}
+		if t.Name == "" {
+			return nil, fmt.Errorf("%s:%d: targets[%d]: name is required", f.Path, n.Line, i)
+		}
+		if seen[t.Name] {
+			return nil, fmt.Errorf("%s:%d: targets[%d]: duplicate name %q", f.Path, n.Line, i, t.Name)
+		}
+		seen[t.Name] = true
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// Annotate prefixes a ValidationError with the file and line of its key when the file sets it at the top level.
+func (f *File) Annotate(err error) error {
+	if f == nil {
+		return err
+	}
+	if line := keyLine(f.root, err); line > 0 {
+		return fmt.Errorf("%s:%d: %w", f.Path, line, err)
+	}
+	return err
+}
+
+// AnnotateTarget is Annotate for the i-th entry of the targets list: the line in the target when it
+// sets the key, else the top-level line the target inherited it from.
+func (f *File) AnnotateTarget(i int, err error) error {
+	if f == nil {
+		return err
+	}
+	if nodes := f.targetNodes(); i < len(nodes) {
+		if line := keyLine(nodes[i], err); line > 0 {
+			return fmt.Errorf("%s:%d: %w", f.Path, line, err)
+		}
+	}
+	return f.Annotate(err)
+}
+
+// keyLine returns the line of a ValidationError's key in mapping, or 0.
+func keyLine(mapping *yaml.Node, err error) int {
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		return 0
+	}
+	if key, _ := mappingKey(mapping, verr.Key); key != nil {
+		return key.Line
+	}
+	return 0
+}
+
+func (f *File) targetNodes() []*yaml.Node {
+	if f == nil {
+		return nil
+	}
+	if _, value := mappingKey(f.root, "targets"); value != nil {
+		return value.Content
+	}
+	return nil
+}
+
+// mappingKey returns the key and value nodes for name in a mapping node, or nil, nil.
+func mappingKey(mapping *yaml.Node, name string) (key, value *yaml.Node) {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == name {
+			return mapping.Content[i], mapping.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// processWideKeys are the YAML keys allowed at the top of a config file but not in a target
+// (json "-": not settable per target, see Config).
+var processWideKeys = func() map[string]bool {
+	keys := make(map[string]bool)
+	t := reflect.TypeFor[Config]()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if y := f.Tag.Get("yaml"); f.Tag.Get("json") == "-" && y != "-" && y != "" {
+			keys[y] = true
+		}
+	}
+	return keys
+}()
+
+var yamlLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// fileError rewrites yaml.v3 errors ("line 3: field foo not found in type config.fileSchema") as
+// "path:3: field foo not found", one line per problem.
+func fileError(path string, err error) error {
+	var msgs []string
+	var terr *yaml.TypeError
+	if errors.As(err, &terr) {
+		msgs = terr.Errors
+	} else {
+		msgs = []string{err.Error()}
+	}
+	out := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		m = strings.TrimSpace(m)
+		if sm := yamlLine.FindStringSubmatch(m); sm != nil {
+			m = fmt.Sprintf("%s:%s: %s", path, sm[1], sm[2])
+		} else {
+			m = fmt.Sprintf("%s: %s", path, m)
+		}
+		if i := strings.Index(m, " in type "); i >= 0 {
+			m = m[:i]
+		}
+		out = append(out, m)
+	}
+	return errors.New(strings.Join(out, "\n"))
+}
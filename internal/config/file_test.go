@@ -0,0 +1,203 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sampleFile = `interval: 60
+cluster: prod
+slack_webhook: https://hooks.example/base
+threshold_levels: "70,80,90"
+targets:
+  - name: billing
+    db_url: postgres://billing
+  - name: orders
+    db_url: postgres://orders
+    cluster: prod-eu
+    threshold_idle: 40
+`
+
+func TestParseFile_Apply_keeps_unset_values(t *testing.T) {
+	f, err := ParseFile("pgwd.yaml", []byte("interval: 60\nslack_webhook: https://hooks.example/base\n"))
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	c := Defaults()
+	c.Cluster = "from-env"
+	if err := f.Apply(&c); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if c.Interval != 60 || c.SlackWebhook != "https://hooks.example/base" {
+		t.Errorf("file values not applied: interval=%d webhook=%q", c.Interval, c.SlackWebhook)
+	}
+	if c.Cluster != "from-env" || c.CheckTimeout != 30 || c.ThresholdLevels != DefaultThresholdLevels {
+		t.Errorf("unset keys changed: cluster=%q check_timeout=%d levels=%q", c.Cluster, c.CheckTimeout, c.ThresholdLevels)
+	}
+}
+
+func TestParseFile_empty(t *testing.T) {
+	f, err := ParseFile("pgwd.yaml", nil)
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	c := Defaults()
+	if err := f.Apply(&c); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if targets, err := f.Targets(c); err != nil || targets != nil {
+		t.Errorf("Targets() = %v, %v; want nil, nil", targets, err)
+	}
+}
+
+func TestFile_Targets_inherit_top_level(t *testing.T) {
+	f, err := ParseFile("pgwd.yaml", []byte(sampleFile))
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	base := Defaults()
+	if err := f.Apply(&base); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	base.SlackWebhook = "https://hooks.example/env" // env and flags are applied to the base before Targets
+	targets, err := f.Targets(base)
+	if err != nil {
+		t.Fatalf("Targets: %v", err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("Targets: got %d, want 2", len(targets))
+	}
+	billing, orders := targets[0], targets[1]
+	if billing.Name != "billing" || billing.DBURL != "postgres://billing" || billing.Cluster != "prod" || billing.ThresholdLevels != "70,80,90" {
+		t.Errorf("billing: name=%q db=%q cluster=%q levels=%q", billing.Name, billing.DBURL, billing.Cluster, billing.ThresholdLevels)
+	}
+	if orders.Cluster != "prod-eu" || orders.ThresholdIdle != 40 || orders.Interval != 60 {
+		t.Errorf("orders: cluster=%q idle=%d interval=%d", orders.Cluster, orders.ThresholdIdle, orders.Interval)
+	}
+	if billing.SlackWebhook != "https://hooks.example/env" || orders.SlackWebhook != "https://hooks.example/env" {
+		t.Errorf("targets should inherit the base webhook: %q, %q", billing.SlackWebhook, orders.SlackWebhook)
+	}
+}
+
+func TestParseFile_errors(t *testing.T) {
+	tests := []struct {
+		name, raw, want string
+	}{
+		{"unknown key", "interval: 60\nthreshold_totl: 5\n", "pgwd.yaml:2: field threshold_totl not found"},
+		{"wrong type", "interval: often\n", "pgwd.yaml:1: cannot unmarshal !!str `often` into int"},
+		{"not a mapping", "- interval: 60\n", "pgwd.yaml:1: want a mapping"},
+		{"unknown key in target", "targets:\n  - name: a\n    dburl: x\n", "pgwd.yaml:3: field dburl not found"},
+		{"process-wide key in target", "targets:\n  - name: a\n    interval: 5\n", "pgwd.yaml:3: targets[0]: interval is process-wide"},
+		{"routes in target", "targets:\n  - name: a\n    routes: []\n", "pgwd.yaml:3: targets[0]: routes is process-wide"},
+		{"unknown key in receiver", "receivers:\n  - name: a\n    slack_url: x\n", "pgwd.yaml:3: field slack_url not found"},
+		{"syntax", "interval: [60\n", "pgwd.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFile("pgwd.yaml", []byte(tt.raw))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseFile error = %v, want containing %q", err, tt.want)
+			}
+			if err != nil && strings.Contains(err.Error(), " in type ") {
+				t.Errorf("ParseFile error should not name Go types: %v", err)
+			}
+		})
+	}
+}
+
+func TestFile_Targets_errors(t *testing.T) {
+	tests := []struct {
+		name, raw, want string
+	}{
+		{"missing name", "targets:\n  - db_url: postgres://a\n", "pgwd.yaml:2: targets[0]: name is required"},
+		{"duplicate name", "targets:\n  - name: a\n  - name: a\n", "pgwd.yaml:3: targets[1]: duplicate name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseFile("pgwd.yaml", []byte(tt.raw))
+			if err != nil {
+				t.Fatalf("ParseFile: %v", err)
+			}
+			_, err = f.Targets(Defaults())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Targets error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFile_Annotate(t *testing.T) {
+	f, err := ParseFile("pgwd.yaml", []byte("db_url: postgres://a\nremediate_action: kill\ntargets:\n  - name: a\n    stale_age: 0\n"))
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	verr := invalid("remediate_action", "invalid remediate-action")
+	if got := f.Annotate(verr).Error(); got != "pgwd.yaml:2: invalid remediate-action" {
+		t.Errorf("Annotate = %q", got)
+	}
+	if got := f.AnnotateTarget(0, invalid("stale_age", "stale-age must be > 0")).Error(); got != "pgwd.yaml:5: stale-age must be > 0" {
+		t.Errorf("AnnotateTarget (target key) = %q", got)
+	}
+	if got := f.AnnotateTarget(0, verr).Error(); got != "pgwd.yaml:2: invalid remediate-action" {
+		t.Errorf("AnnotateTarget (inherited key) = %q", got)
+	}
+	if got := f.Annotate(invalid("loki_url", "from env")).Error(); got != "from env" {
+		t.Errorf("Annotate for a key not in the file = %q", got)
+	}
+	var nilFile *File
+	if got := nilFile.Annotate(verr); got != verr {
+		t.Errorf("nil File Annotate = %v", got)
+	}
+}
+
+func TestLoadFile_reads_file(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pgwd.yaml")
+	if err := os.WriteFile(path, []byte(sampleFile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if f.Path != path {
+		t.Errorf("Path = %q, want %q", f.Path, path)
+	}
+	if _, err := LoadFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("LoadFile(missing) should fail")
+	}
+}
+
+func TestParseFile_routing(t *testing.T) {
+	raw := `slack_webhook: https://hooks.example/default
+receivers:
+  - name: paging
+    slack_webhook: https://hooks.example/paging
+  - name: tests
+    slack_webhook: https://hooks.example/tests
+routes:
+  - match: {threshold: test}
+    receivers: [tests]
+  - match: {level: danger}
+    receivers: [paging]
+    continue: true
+`
+	f, err := ParseFile("pgwd.yaml", []byte(raw))
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	c := Defaults()
+	if err := f.Apply(&c); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if len(c.Receivers) != 2 || c.Receivers[1].SlackWebhook != "https://hooks.example/tests" {
+		t.Errorf("receivers = %+v", c.Receivers)
+	}
+	if len(c.Routes) != 2 || c.Routes[1].Match.Level != "danger" || !c.Routes[1].Continue || c.Routes[0].Receivers[0] != "tests" {
+		t.Errorf("routes = %+v", c.Routes)
+	}
+	if r := c.DefaultReceiver(); r.SlackWebhook != "https://hooks.example/default" {
+		t.Errorf("default receiver = %+v", r)
+	}
+}
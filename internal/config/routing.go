@@ -0,0 +1,228 @@
+package config
+
+import (
+	"net/http"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/hrodrig/pgwd/internal/notify"
+)
+
+// Receiver is a named set of notifiers that routes send events to (config file "receivers"). Its keys are the
+// notifier settings of Config, so several receivers can use the same notifier type, e.g. two Slack webhooks:
+//
+//	receivers:
+//	  - name: paging
+//	    slack_webhook: https://hooks.slack.com/services/T000/B000/paging
+//	  - name: logs
+//	    loki_url: http://loki:3100/loki/api/v1/push
+type Receiver struct {
+	Name            string `yaml:"name"`
+	SlackWebhook    string `yaml:"slack_webhook"`
+	TeamsWebhook    string `yaml:"teams_webhook"`
+	LokiURL         string `yaml:"loki_url"`
+	LokiLabels      string `yaml:"loki_labels"`
+	LokiOrgID       string `yaml:"loki_org_id"`
+	LokiBearerToken string `yaml:"loki_bearer_token"`
+
+	PagerDutyRoutingKey string `yaml:"pagerduty_routing_key"`
+	PagerDutyURL        string `yaml:"pagerduty_url"`
+
+	WebhookURL      string `yaml:"webhook_url"`
+	WebhookMethod   string `yaml:"webhook_method"`
+	WebhookHeaders  string `yaml:"webhook_headers"`
+	WebhookTemplate string `yaml:"webhook_template"`
+	WebhookSecret   string `yaml:"webhook_secret"`
+
+	EmailSMTPAddr string `yaml:"email_smtp_addr"`
+	EmailTLS      string `yaml:"email_tls"`
+	EmailAuth     string `yaml:"email_auth"`
+	EmailUsername string `yaml:"email_username"`
+	EmailPassword string `yaml:"email_password"`
+	EmailFrom     string `yaml:"email_from"`
+	EmailTo       string `yaml:"email_to"`
+
+	AlertmanagerURL string `yaml:"alertmanager_url"`
+
+	ExecCommand string `yaml:"exec_command"`
+	ExecTimeout int    `yaml:"exec_timeout"` // 0 = the top-level exec_timeout
+}
+
+// HasNotifier reports whether the receiver sends anywhere.
+func (r *Receiver) HasNotifier() bool {
+	return r.SlackWebhook != "" || r.TeamsWebhook != "" || r.LokiURL != "" || r.PagerDutyRoutingKey != "" || r.WebhookURL != "" || r.EmailSMTPAddr != "" || r.AlertmanagerURL != "" || r.ExecCommand != ""
+}
+
+// validate checks the notifier settings that can be wrong on their own.
+func (r *Receiver) validate() error {
+	if err := r.validateWebhook(); err != nil {
+		return err
+	}
+	if err := r.validateEmail(); err != nil {
+		return err
+	}
+	if err := r.validateAlertmanager(); err != nil {
+		return err
+	}
+	if r.ExecTimeout < 0 {
+		return invalid("exec_timeout", "exec-timeout must be >= 0")
+	}
+	return nil
+}
+
+// validateWebhook checks the webhook method, headers and body template.
+func (r *Receiver) validateWebhook() error {
+	switch strings.ToUpper(r.WebhookMethod) {
+	case "", http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return invalid("webhook_method", "invalid webhook-method %q: want POST, PUT or PATCH", r.WebhookMethod)
+	}
+	if _, err := notify.ParseWebhookHeaders(r.WebhookHeaders); err != nil {
+		return invalid("webhook_headers", "invalid webhook-headers: %v", err)
+	}
+	if _, err := notify.ParseWebhookTemplate(r.WebhookTemplate); err != nil {
+		return invalid("webhook_template", "invalid webhook-template: %v", err)
+	}
+	return nil
+}
+
+// validateEmail checks the TLS mode, auth mechanism and addresses when email is configured.
+func (r *Receiver) validateEmail() error {
+	if r.EmailSMTPAddr == "" {
+		return nil
+	}
+	switch r.EmailTLS {
+	case "", notify.EmailTLSStartTLS, notify.EmailTLSImplicit, notify.EmailTLSNone:
+	default:
+		return invalid("email_tls", "invalid email-tls %q: want starttls, tls or none", r.EmailTLS)
+	}
+	switch r.EmailAuth {
+	case "", "plain", "login":
+	default:
+		return invalid("email_auth", "invalid email-auth %q: want plain or login", r.EmailAuth)
+	}
+	if _, err := mail.ParseAddress(r.EmailFrom); err != nil {
+		return invalid("email_from", "email-smtp-addr requires a valid email-from: %v", err)
+	}
+	if _, err := notify.ParseEmailAddresses(r.EmailTo); err != nil {
+		return invalid("email_to", "email-smtp-addr requires valid email-to recipients: %v", err)
+	}
+	return nil
+}
+
+// validateAlertmanager checks that every Alertmanager URL is an absolute http(s) URL.
+func (r *Receiver) validateAlertmanager() error {
+	for _, s := range strings.Split(r.AlertmanagerURL, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if u, err := url.Parse(s); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return invalid("alertmanager_url", "invalid alertmanager-url %q: want http(s)://host[:port]", s)
+		}
+	}
+	return nil
+}
+
+// DefaultReceiver returns the top-level notifiers (-slack-webhook, -loki-url, ...) as a receiver: where events go
+// when there are no routes or no route matches.
+func (c *Config) DefaultReceiver() Receiver {
+	return Receiver{
+		Name:            "default",
+		SlackWebhook:    c.SlackWebhook,
+		TeamsWebhook:    c.TeamsWebhook,
+		LokiURL:         c.LokiURL,
+		LokiLabels:      c.LokiLabels,
+		LokiOrgID:       c.LokiOrgID,
+		LokiBearerToken: c.LokiBearerToken,
+
+		PagerDutyRoutingKey: c.PagerDutyRoutingKey,
+		PagerDutyURL:        c.PagerDutyURL,
+
+		WebhookURL:      c.WebhookURL,
+		WebhookMethod:   c.WebhookMethod,
+		WebhookHeaders:  c.WebhookHeaders,
+		WebhookTemplate: c.WebhookTemplate,
+		WebhookSecret:   c.WebhookSecret,
+
+		EmailSMTPAddr: c.EmailSMTPAddr,
+		EmailTLS:      c.EmailTLS,
+		EmailAuth:     c.EmailAuth,
+		EmailUsername: c.EmailUsername,
+		EmailPassword: c.EmailPassword,
+		EmailFrom:     c.EmailFrom,
+		EmailTo:       c.EmailTo,
+
+		AlertmanagerURL: c.AlertmanagerURL,
+
+		ExecCommand: c.ExecCommand,
+		ExecTimeout: c.ExecTimeout,
+	}
+}
+
+// Route sends the events it matches to named receivers (config file "routes"). Routes are tried in order and the
+// first match wins, unless it sets Continue; events matching no route go to the default receiver:
+//
+//	routes:
+//	  - match: {threshold: test}
+//	    receivers: [deliveries]
+//	  - match: {level: danger}
+//	    receivers: [paging, logs]
+type Route struct {
+	Match     RouteMatch `yaml:"match"`
+	Receivers []string   `yaml:"receivers"`
+	Continue  bool       `yaml:"continue"` // also try the next routes
+}
+
+// RouteMatch selects events by field. Each value is a regular expression that must match the whole field (e.g.
+// "alert|danger"); empty matches anything. Level is the event's level, derived from the threshold when the event
+// has none (as in the Loki level label).
+type RouteMatch struct {
+	Level     string `yaml:"level"`
+	Threshold string `yaml:"threshold"`
+	Database  string `yaml:"database"`
+	Cluster   string `yaml:"cluster"`
+}
+
+// Pattern compiles a RouteMatch value: nil for "" (any value), else a regexp anchored at both ends.
+func Pattern(s string) (*regexp.Regexp, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + s + ")$")
+}
+
+func (c *Config) validateRouting() error {
+	names := make(map[string]bool, len(c.Receivers))
+	for i, r := range c.Receivers {
+		switch {
+		case r.Name == "":
+			return invalid("receivers", "receivers[%d]: name is required", i)
+		case names[r.Name]:
+			return invalid("receivers", "receivers[%d]: duplicate name %q", i, r.Name)
+		case !r.HasNotifier():
+			return invalid("receivers", "receiver %s: no notifier configured (slack_webhook, teams_webhook, loki_url, pagerduty_routing_key, webhook_url, email_smtp_addr, alertmanager_url or exec_command)", r.Name)
+		}
+		if err := r.validate(); err != nil {
+			return invalid("receivers", "receiver %s: %v", r.Name, err)
+		}
+		names[r.Name] = true
+	}
+	for i, rt := range c.Routes {
+		if len(rt.Receivers) == 0 {
+			return invalid("routes", "routes[%d]: receivers is required", i)
+		}
+		for _, name := range rt.Receivers {
+			if !names[name] {
+				return invalid("routes", "routes[%d]: unknown receiver %q", i, name)
+			}
+		}
+		for _, p := range []string{rt.Match.Level, rt.Match.Threshold, rt.Match.Database, rt.Match.Cluster} {
+			if _, err := Pattern(p); err != nil {
+				return invalid("routes", "routes[%d]: invalid match %q: %v", i, p, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Target is one monitored database from a targets file: a unique name plus the settings that
+// differ from the base config (URL, thresholds, cluster/client labels, notifiers).
+type Target struct {
+	Name   string `json:"name" yaml:"name"`
+	Config `yaml:",inline"`
+}
+
+// LoadTargets reads a JSON array of targets from path. Each target starts as a copy of base and
+// the keys it sets override it, e.g.
+//
+//	[{"name": "billing", "db_url": "postgres://...", "threshold_levels": "70,80,90", "slack_webhook": "https://..."}]
+//
+// Keys are Config's JSON names; unknown keys, process-wide settings and missing or duplicate names are errors.
+func LoadTargets(path string, base Config) ([]Target, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTargets(raw, base)
+}
+
+// ParseTargets is LoadTargets for a JSON document already in memory.
+func ParseTargets(raw []byte, base Config) ([]Target, error) {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, fmt.Errorf("targets: want a JSON array of objects: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("targets: no targets defined")
+	}
+	targets := make([]Target, 0, len(entries))
+	seen := make(map[string]bool)
+	for i, entry := range entries {
+		t := Target{Config: base}
+		dec := json.NewDecoder(bytes.NewReader(entry))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&t); err != nil {
+			return nil, fmt.Errorf("targets[%d]: %w", i, err)
+		}
+		if t.Name == "" {
+			return nil, fmt.Errorf("targets[%d]: name is required", i)
+		}
+		if seen[t.Name] {
+			return nil, fmt.Errorf("targets[%d]: duplicate name %q", i, t.Name)
+		}
+		seen[t.Name] = true
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// ValidateTargets checks what spans targets: kube_postgres targets each need their own kube_local_port (the
+// default, 5432, is the same for all).
+func ValidateTargets(targets []Target) error {
+	kubePorts := make(map[int]string) // kube_local_port -> target using it
+	for _, t := range targets {
+		if t.KubePostgres == "" {
+			continue
+		}
+		if other, ok := kubePorts[t.KubeLocalPort]; ok {
+			return fmt.Errorf("target %s: kube_local_port %d is already used by target %s; give each kube_postgres target its own port", t.Name, t.KubeLocalPort, other)
+		}
+		kubePorts[t.KubeLocalPort] = t.Name
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseTargets_overrides_base(t *testing.T) {
+	base := Config{ThresholdLevels: DefaultThresholdLevels, Cluster: "prod", SlackWebhook: "https://hooks.example/base", Interval: 60}
+	raw := []byte(`[
+		{"name": "billing", "db_url": "postgres://billing", "threshold_levels": "70,80,90", "slack_webhook": "https://hooks.example/billing"},
+		{"name": "orders", "db_url": "postgres://orders", "cluster": "prod-eu", "threshold_idle": 40}
+	]`)
+	targets, err := ParseTargets(raw, base)
+	if err != nil {
+		t.Fatalf("ParseTargets: %v", err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("ParseTargets: got %d targets, want 2", len(targets))
+	}
+	billing, orders := targets[0], targets[1]
+	if billing.Name != "billing" || billing.DBURL != "postgres://billing" || billing.ThresholdLevels != "70,80,90" {
+		t.Errorf("billing: %+v", billing)
+	}
+	if billing.SlackWebhook != "https://hooks.example/billing" || billing.Cluster != "prod" {
+		t.Errorf("billing notifier/cluster: webhook=%q cluster=%q", billing.SlackWebhook, billing.Cluster)
+	}
+	if orders.Cluster != "prod-eu" || orders.ThresholdIdle != 40 || orders.ThresholdLevels != DefaultThresholdLevels {
+		t.Errorf("orders: cluster=%q idle=%d levels=%q", orders.Cluster, orders.ThresholdIdle, orders.ThresholdLevels)
+	}
+	if orders.SlackWebhook != base.SlackWebhook || orders.Interval != 60 {
+		t.Errorf("orders should inherit base: webhook=%q interval=%d", orders.SlackWebhook, orders.Interval)
+	}
+}
+
+func TestParseTargets_errors(t *testing.T) {
+	tests := []struct {
+		name, raw, want string
+	}{
+		{"not an array", `{"name": "a"}`, "JSON array"},
+		{"empty", `[]`, "no targets"},
+		{"missing name", `[{"db_url": "postgres://a"}]`, "name is required"},
+		{"duplicate name", `[{"name": "a"}, {"name": "a"}]`, "duplicate name"},
+		{"unknown key", `[{"name": "a", "threshold_totl": 5}]`, "unknown field"},
+		{"process-wide key", `[{"name": "a", "interval": 5}]`, "unknown field"},
+		{"wrong type", `[{"name": "a", "threshold_idle": "many"}]`, "targets[0]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTargets([]byte(tt.raw), Config{})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseTargets(%s) error = %v, want containing %q", tt.raw, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTargets_reads_file(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	if err := os.WriteFile(path, []byte(`[{"name": "a", "db_url": "postgres://a"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	targets, err := LoadTargets(path, Config{})
+	if err != nil || len(targets) != 1 || targets[0].DBURL != "postgres://a" {
+		t.Errorf("LoadTargets = %+v, %v", targets, err)
+	}
+	if _, err := LoadTargets(filepath.Join(t.TempDir(), "missing.json"), Config{}); err == nil {
+		t.Error("LoadTargets(missing file): expected error")
+	}
+}
+
+func TestValidateTargets_kube_local_port(t *testing.T) {
+	kube := func(name, resource string, port int) Target {
+		return Target{Name: name, Config: Config{KubePostgres: resource, KubeLocalPort: port}}
+	}
+	if err := ValidateTargets([]Target{kube("a", "ns/svc/pg", 5432), kube("b", "", 5432), kube("c", "ns/svc/pg2", 15432)}); err != nil {
+		t.Errorf("distinct ports: %v", err)
+	}
+	err := ValidateTargets([]Target{kube("a", "ns/svc/pg", 5432), kube("b", "ns/svc/pg2", 5432)})
+	if err == nil || !strings.Contains(err.Error(), "kube_local_port 5432 is already used by target a") {
+		t.Errorf("shared port: error = %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package config
+
+import "fmt"
+
+// ValidationError is an invalid setting. Key is the setting's config-file key (e.g. "stale_age"),
+// so errors for settings from a config file can point at the line (see File.Annotate).
+type ValidationError struct {
+	Key string
+	Msg string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Msg
+}
+
+func invalid(key, format string, args ...any) error {
+	return &ValidationError{Key: key, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Validate checks that the settings are usable together; it returns the first problem found.
+func (c *Config) Validate() error {
+	for _, check := range []func() error{
+		c.validateDBURL,
+		c.validateStale,
+		c.validateApplicationThresholds,
+		c.validateRemediation,
+		c.validateAlerting,
+		c.validatePgBouncer,
+		c.validateNotifiers,
+		c.validateDefaultReceiver,
+		c.validateRouting,
+		c.validateKubePostgres,
+		c.validateKubeLoki,
+	} {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateDBURL() error {
+	if c.DBURL == "" {
+		return invalid("db_url", "missing database URL: set PGWD_DB_URL or -db-url")
+	}
+	return nil
+}
+
+func (c *Config) validateStale() error {
+	if c.ThresholdStale > 0 && c.StaleAge <= 0 {
+		return invalid("stale_age", "when using threshold-stale, stale-age must be > 0 (PGWD_STALE_AGE or -stale-age)")
+	}
+	return nil
+}
+
+func (c *Config) validateApplicationThresholds() error {
+	if _, err := ParseApplicationThresholds(c.ApplicationThresholds); err != nil {
+		return invalid("application_thresholds", "invalid application-thresholds: %v", err)
+	}
+	return nil
+}
+
+func (c *Config) validateRemediation() error {
+	if !c.RemediationEnabled() {
+		return nil
+	}
+	if c.RemediateAction != "terminate" && c.RemediateAction != "cancel" {
+		return invalid("remediate_action", "invalid remediate-action %q: use terminate or cancel", c.RemediateAction)
+	}
+	if c.RemediateAction == "cancel" && c.RemediateIdleInTransactionAge > 0 {
+		return invalid("remediate_action", "remediate-action cancel has no effect on sessions idle in transaction (no query is running): use terminate")
+	}
+	if c.RemediateMaxKills < 1 {
+		return invalid("remediate_max_kills", "remediation requires remediate-max-kills >= 1")
+	}
+	if c.RemediateStale && c.StaleAge <= 0 {
+		return invalid("stale_age", "when using remediate-stale, stale-age must be > 0 (PGWD_STALE_AGE or -stale-age)")
+	}
+	return nil
+}
+
+func (c *Config) validateAlerting() error {
+	if c.For < 0 || c.ForChecks < 0 {
+		return invalid("for", "for and for-checks must be >= 0")
+	}
+	if c.RepeatInterval < 0 {
+		return invalid("repeat_interval", "repeat-interval must be >= 0")
+	}
+	if c.RepeatInterval == 0 && c.usesAlertmanager() {
+		return invalid("repeat_interval", "alertmanager-url needs repeat-interval > 0: Alertmanager resolves firing alerts that pgwd does not re-send")
+	}
+	if c.ResolveHysteresis < 0 || c.ResolveHysteresis > 99 {
+		return invalid("resolve_hysteresis", "resolve-hysteresis must be between 0 and 99 (percent)")
+	}
+	if _, err := ParseForThresholds(c.ForThresholds); err != nil {
+		return invalid("for_thresholds", "invalid for-thresholds: %v", err)
+	}
+	if c.UsesFor() && c.Interval <= 0 && c.StateFile == "" {
+		return invalid("for", "for, for-checks and for-thresholds need daemon mode (-interval > 0) or -state-file: state is kept between checks")
+	}
+	return nil
+}
+
+// usesAlertmanager reports whether the top-level notifiers or a receiver post to Alertmanager.
+func (c *Config) usesAlertmanager() bool {
+	if c.AlertmanagerURL != "" {
+		return true
+	}
+	for _, r := range c.Receivers {
+		if r.AlertmanagerURL != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) validatePgBouncer() error {
+	if c.HasPgBouncerThreshold() && c.PgBouncerURL == "" {
+		return invalid("pgbouncer_url", "pgbouncer thresholds require PGWD_PGBOUNCER_URL or -pgbouncer-url")
+	}
+	return nil
+}
+
+func (c *Config) validateNotifiers() error {
+	if !c.HasAnyNotifier() && !c.DryRun {
+		return invalid("slack_webhook", "no notifier configured: set PGWD_SLACK_WEBHOOK, PGWD_TEAMS_WEBHOOK, PGWD_LOKI_URL, PGWD_PAGERDUTY_ROUTING_KEY, PGWD_WEBHOOK_URL, PGWD_EMAIL_SMTP_ADDR, PGWD_ALERTMANAGER_URL or PGWD_EXEC_COMMAND (or -slack-webhook / -teams-webhook / -loki-url / -pagerduty-routing-key / -webhook-url / -email-smtp-addr / -alertmanager-url / -exec-command), or use -dry-run")
+	}
+	if c.ForceNotification && !c.HasAnyNotifier() {
+		return invalid("force_notification", "force-notification requires at least one notifier (slack-webhook, teams-webhook, loki-url, pagerduty-routing-key, webhook-url, email-smtp-addr, alertmanager-url or exec-command)")
+	}
+	if c.NotifyOnConnectFailure && !c.HasAnyNotifier() {
+		return invalid("notify_on_connect_failure", "notify-on-connect-failure requires at least one notifier (slack-webhook, teams-webhook, loki-url, pagerduty-routing-key, webhook-url, email-smtp-addr, alertmanager-url or exec-command)")
+	}
+	return nil
+}
+
+func (c *Config) validateDefaultReceiver() error {
+	if c.ExecConcurrency < 0 {
+		return invalid("exec_concurrency", "exec-concurrency must be >= 0")
+	}
+	r := c.DefaultReceiver()
+	return r.validate()
+}
+
+func (c *Config) validateKubePostgres() error {
+	if c.KubePostgres != "" && c.DBURL == "" {
+		return invalid("kube_postgres", "kube-postgres requires PGWD_DB_URL or -db-url (use host localhost and the same port as -kube-local-port)")
+	}
+	return nil
+}
+
+func (c *Config) validateKubeLoki() error {
+	if c.KubeLoki == "" {
+		return nil
+	}
+	if c.LokiURL != "" {
+		return invalid("kube_loki", "use -kube-loki OR -loki-url, not both (-loki-url for exposed Loki, -kube-loki when Loki is inside the cluster)")
+	}
+	if c.KubeLokiLocalPort < 1 || c.KubeLokiLocalPort > 65535 {
+		return invalid("kube_loki_local_port", "kube-loki-local-port must be between 1 and 65535")
+	}
+	if c.KubeLokiRemotePort < 1 || c.KubeLokiRemotePort > 65535 {
+		return invalid("kube_loki_remote_port", "kube-loki-remote-port must be between 1 and 65535")
+	}
+	return nil
+}
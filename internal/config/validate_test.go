@@ -0,0 +1,98 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid := func() Config {
+		c := Defaults()
+		c.DBURL = "postgres://localhost/db"
+		c.SlackWebhook = "https://hooks.example/x"
+		return c
+	}
+	tests := []struct {
+		name    string
+		mutate  func(*Config)
+		wantKey string
+	}{
+		{"valid", func(*Config) {}, ""},
+		{"missing db url", func(c *Config) { c.DBURL = "" }, "db_url"},
+		{"stale without age", func(c *Config) { c.ThresholdStale = 1 }, "stale_age"},
+		{"bad application thresholds", func(c *Config) { c.ApplicationThresholds = "api" }, "application_thresholds"},
+		{"bad remediate action", func(c *Config) { c.RemediateStale, c.StaleAge, c.RemediateAction = true, 60, "kill" }, "remediate_action"},
+		{"cancel idle in transaction", func(c *Config) { c.RemediateIdleInTransactionAge, c.RemediateAction = 60, "cancel" }, "remediate_action"},
+		{"cancel stale", func(c *Config) { c.RemediateStale, c.StaleAge, c.RemediateAction = true, 60, "cancel" }, ""},
+		{"remediate max kills", func(c *Config) { c.RemediateStale, c.StaleAge, c.RemediateMaxKills = true, 60, 0 }, "remediate_max_kills"},
+		{"for once", func(c *Config) { c.For = 60 }, "for"},
+		{"for daemon", func(c *Config) { c.For, c.Interval = 60, 30 }, ""},
+		{"for once with state file", func(c *Config) { c.For, c.StateFile = 60, "/var/lib/pgwd/state.json" }, ""},
+		{"bad for thresholds", func(c *Config) { c.ForThresholds, c.Interval = "totl=60", 30 }, "for_thresholds"},
+		{"resolve hysteresis", func(c *Config) { c.ResolveHysteresis = 100 }, "resolve_hysteresis"},
+		{"pgbouncer without url", func(c *Config) { c.PgBouncerThresholdWaiting = 1 }, "pgbouncer_url"},
+		{"no notifier", func(c *Config) { c.SlackWebhook = "" }, "slack_webhook"},
+		{"no notifier dry run", func(c *Config) { c.SlackWebhook, c.DryRun = "", true }, ""},
+		{"teams only", func(c *Config) { c.SlackWebhook, c.TeamsWebhook = "", "https://example.webhook.office.com/x" }, ""},
+		{"webhook only", func(c *Config) { c.SlackWebhook, c.WebhookURL = "", "https://alerts.example/pgwd" }, ""},
+		{"invalid webhook method", func(c *Config) { c.WebhookURL, c.WebhookMethod = "https://alerts.example/pgwd", "DELETE" }, "webhook_method"},
+		{"invalid webhook headers", func(c *Config) { c.WebhookHeaders = "Authorization" }, "webhook_headers"},
+		{"invalid webhook template", func(c *Config) { c.WebhookTemplate = "{{.Message" }, "webhook_template"},
+		{"receiver with invalid webhook template", func(c *Config) {
+			c.Receivers = []Receiver{{Name: "gateway", WebhookURL: "https://alerts.example/pgwd", WebhookTemplate: "{{nosuchfunc .}}"}}
+		}, "receivers"},
+		{"email only", func(c *Config) {
+			c.SlackWebhook, c.EmailSMTPAddr, c.EmailFrom, c.EmailTo = "", "smtp.example.com", "pgwd@example.com", "dba@example.com, On call <oncall@example.com>"
+		}, ""},
+		{"email without recipients", func(c *Config) { c.EmailSMTPAddr, c.EmailFrom = "smtp.example.com", "pgwd@example.com" }, "email_to"},
+		{"email without sender", func(c *Config) { c.EmailSMTPAddr, c.EmailTo = "smtp.example.com", "dba@example.com" }, "email_from"},
+		{"invalid email tls", func(c *Config) {
+			c.EmailSMTPAddr, c.EmailFrom, c.EmailTo, c.EmailTLS = "smtp.example.com", "pgwd@example.com", "dba@example.com", "ssl"
+		}, "email_tls"},
+		{"alertmanager only", func(c *Config) { c.SlackWebhook, c.AlertmanagerURL = "", "http://am-0:9093, http://am-1:9093" }, ""},
+		{"invalid alertmanager url", func(c *Config) { c.AlertmanagerURL = "am-0:9093" }, "alertmanager_url"},
+		{"alertmanager without repeat", func(c *Config) { c.AlertmanagerURL, c.RepeatInterval = "http://am-0:9093", 0 }, "repeat_interval"},
+		{"receiver alertmanager without repeat", func(c *Config) {
+			c.Receivers, c.RepeatInterval = []Receiver{{Name: "am", AlertmanagerURL: "http://am-0:9093"}}, 0
+		}, "repeat_interval"},
+		{"exec only", func(c *Config) { c.SlackWebhook, c.ExecCommand = "", "/usr/local/bin/open-ticket --queue dba" }, ""},
+		{"negative exec timeout", func(c *Config) { c.ExecCommand, c.ExecTimeout = "true", -1 }, "exec_timeout"},
+		{"negative exec concurrency", func(c *Config) { c.ExecConcurrency = -1 }, "exec_concurrency"},
+		{"pagerduty only", func(c *Config) { c.SlackWebhook, c.PagerDutyRoutingKey = "", "R0UT1NG" }, ""},
+		{"routes", func(c *Config) {
+			c.Receivers = []Receiver{{Name: "paging", SlackWebhook: "https://hooks.example/p"}}
+			c.Routes = []Route{{Match: RouteMatch{Level: "danger|alert"}, Receivers: []string{"paging"}}}
+		}, ""},
+		{"receiver only", func(c *Config) {
+			c.SlackWebhook, c.Receivers = "", []Receiver{{Name: "paging", SlackWebhook: "https://hooks.example/p"}}
+		}, ""},
+		{"receiver without notifier", func(c *Config) { c.Receivers = []Receiver{{Name: "paging"}} }, "receivers"},
+		{"duplicate receiver", func(c *Config) {
+			c.Receivers = []Receiver{{Name: "a", LokiURL: "http://loki"}, {Name: "a", LokiURL: "http://loki"}}
+		}, "receivers"},
+		{"unknown route receiver", func(c *Config) { c.Routes = []Route{{Receivers: []string{"paging"}}} }, "routes"},
+		{"bad route match", func(c *Config) {
+			c.Receivers = []Receiver{{Name: "a", LokiURL: "http://loki"}}
+			c.Routes = []Route{{Match: RouteMatch{Threshold: "idle("}, Receivers: []string{"a"}}}
+		}, "routes"},
+		{"kube loki and loki url", func(c *Config) { c.KubeLoki, c.LokiURL = "svc/loki", "http://loki" }, "kube_loki"},
+		{"kube loki port", func(c *Config) { c.KubeLoki, c.KubeLokiLocalPort = "svc/loki", 70000 }, "kube_loki_local_port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.mutate(&c)
+			err := c.Validate()
+			if tt.wantKey == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) || verr.Key != tt.wantKey {
+				t.Errorf("Validate() = %v, want ValidationError for %q", err, tt.wantKey)
+			}
+		})
+	}
+}
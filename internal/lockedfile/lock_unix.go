@@ -0,0 +1,26 @@
+//go:build unix
+
+package lockedfile
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Lock takes an exclusive lock on path (created when missing), waiting for other holders, and returns the
+// function that releases it. flock locks are per open file, so they also exclude other goroutines of this process.
+func Lock(path string) (unlock func(), err error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,41 @@
+// Package lockedfile reads and writes small state files shared by concurrent pgwd processes (cron runs, the
+// silence command): an exclusive lock on a side file and atomic replacement of the data file.
+package lockedfile
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Update runs fn holding the lock on path+".lock". The data file itself is never locked because WriteAtomic
+// replaces it.
+func Update(path string, fn func() error) error {
+	unlock, err := Lock(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return fn()
+}
+
+// WriteAtomic replaces path with data: it writes a temporary file in the same directory, syncs it and renames it
+// over path, so readers see the old or the new file, never a partial one.
+func WriteAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,49 @@
+package lockedfile
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestUpdate_serializes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter")
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			err := Update(path, func() error {
+				raw, _ := os.ReadFile(path)
+				n, _ := strconv.Atoi(string(raw))
+				return WriteAtomic(path, []byte(strconv.Itoa(n+1)))
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+	if raw, _ := os.ReadFile(path); string(raw) != "20" {
+		t.Errorf("counter = %s, want 20: updates were lost", raw)
+	}
+}
+
+func TestWriteAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	for _, data := range []string{"old", "new"} {
+		if err := WriteAtomic(path, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if raw, _ := os.ReadFile(path); string(raw) != "new" {
+		t.Errorf("content = %q, want new", raw)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only the file (no temporary files)", len(entries))
+	}
+	if err := WriteAtomic(filepath.Join(dir, "missing", "state.json"), nil); err == nil {
+		t.Error("want an error for a missing directory")
+	}
+}
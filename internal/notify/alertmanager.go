@@ -0,0 +1,184 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// alertmanagerAlertsPath is the Alertmanager v2 API endpoint for posting alerts.
+const alertmanagerAlertsPath = "/api/v2/alerts"
+
+// alertmanagerLevels are the levels of 3-tier events; each is a separate alert in Alertmanager (level is a label).
+var alertmanagerLevels = []string{"attention", "alert", "danger"}
+
+// Alertmanager posts events as alerts to the Alertmanager v2 API, so they go through its grouping, inhibition and
+// routing. Resolved events set endsAt to now. When an event changes level, the alerts of the other levels of the
+// same condition are resolved in the same request. Test and remediation events are not alerts and are skipped;
+// connect failures and too many clients get no resolved event, so they leave endsAt to resolve_timeout.
+type Alertmanager struct {
+	URLs []string // Alertmanager base URLs (e.g. http://alertmanager:9093); each gets every alert (HA pairs)
+	// EndsAfter sets endsAt of firing alerts to now plus EndsAfter, so Alertmanager keeps them firing until pgwd
+	// re-sends them (see -repeat-interval, which must be > 0 with Alertmanager); 0 leaves endsAt unset and
+	// Alertmanager's resolve_timeout applies.
+	EndsAfter time.Duration
+	Client    *http.Client
+}
+
+// alertmanagerAlert is one postableAlert of the v2 API.
+type alertmanagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	StartsAt    time.Time         `json:"startsAt,omitzero"`
+	EndsAt      time.Time         `json:"endsAt,omitzero"`
+}
+
+// alertmanagerName is the alertname of a threshold, e.g. "PgwdIdleInTransaction" for idle_in_transaction.
+func alertmanagerName(threshold string) string {
+	var b strings.Builder
+	b.WriteString("Pgwd")
+	for _, w := range strings.Split(threshold, "_") {
+		if w != "" {
+			b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+		}
+	}
+	return b.String()
+}
+
+// alertmanagerLabels identify the condition of ev at level: alertname, threshold, level, cluster, database,
+// namespace, and the target, role, application and its metric or PgBouncer pool when set. Empty values are left out.
+func alertmanagerLabels(ev Event, level string) map[string]string {
+	labels := map[string]string{
+		"alertname": alertmanagerName(ev.Threshold),
+		"threshold": ev.Threshold,
+		"level":     level,
+	}
+	for k, v := range map[string]string{
+		"cluster": ev.Cluster, "database": ev.Database, "namespace": ev.Namespace,
+		"target": ev.Target, "role": ev.Role, "application": ev.Application, "metric": ev.Metric,
+	} {
+		if v != "" {
+			labels[k] = v
+		}
+	}
+	if p := ev.PgBouncerPool; p != nil {
+		labels["pgbouncer_pool"] = p.Database + "/" + p.User
+	}
+	return labels
+}
+
+// alertmanagerAnnotations carry the message and the counts of ev.
+func alertmanagerAnnotations(ev Event) map[string]string {
+	a := map[string]string{
+		"summary":         ev.Message,
+		"threshold_value": strconv.Itoa(ev.ThresholdValue),
+	}
+	switch p := ev.PgBouncerPool; {
+	case ev.Resolved:
+		a["description"] = resolvedText(ev)
+	case p != nil:
+		a["description"] = formatPgBouncerPool(*p) + thresholdSuffix(ev.Threshold, ev.ThresholdValue)
+	default:
+		a["description"] = connectionsText(ev)
+	}
+	if ev.PgBouncerPool == nil {
+		a["total"] = strconv.Itoa(ev.Stats.Total)
+		a["active"] = strconv.Itoa(ev.Stats.Active)
+		a["idle"] = strconv.Itoa(ev.Stats.Idle)
+	}
+	if ev.Value > 0 {
+		a["value"] = strconv.Itoa(ev.Value)
+	}
+	if ev.MaxConnections > 0 {
+		a["max_connections"] = strconv.Itoa(ev.MaxConnections)
+	}
+	if ev.Client != "" {
+		a["client"] = ev.Client
+	}
+	if len(ev.TopApplications) > 0 {
+		a["top_applications"] = formatTopApplications(ev.TopApplications)
+	}
+	return a
+}
+
+// alerts returns the alerts to post for ev at now: the alert of its level (firing, or resolved), plus for 3-tier
+// events the other levels resolved.
+func (am *Alertmanager) alerts(ev Event, now time.Time) []alertmanagerAlert {
+	level := eventLevel(ev)
+	annotations := alertmanagerAnnotations(ev)
+	firing := alertmanagerAlert{Labels: alertmanagerLabels(ev, level), Annotations: annotations, StartsAt: now}
+	switch {
+	case ev.Resolved:
+		firing.StartsAt, firing.EndsAt = now.Add(-ev.Duration), now
+	case ev.Threshold == "connect_failure" || ev.Threshold == "too_many_clients":
+		// No resolved event follows: Alertmanager's resolve_timeout ends the alert.
+	case am.EndsAfter > 0:
+		firing.EndsAt = now.Add(am.EndsAfter)
+	}
+	alerts := []alertmanagerAlert{firing}
+	if ev.Level == "" {
+		return alerts
+	}
+	for _, l := range alertmanagerLevels {
+		if l != level {
+			alerts = append(alerts, alertmanagerAlert{Labels: alertmanagerLabels(ev, l), Annotations: annotations, StartsAt: now, EndsAt: now})
+		}
+	}
+	return alerts
+}
+
+// alertsURL returns the v2 alerts endpoint of a base URL (kept when it already ends with it).
+func alertsURL(base string) string {
+	base = strings.TrimRight(base, "/")
+	if strings.HasSuffix(base, alertmanagerAlertsPath) {
+		return base
+	}
+	return base + alertmanagerAlertsPath
+}
+
+// Send posts ev to every Alertmanager and returns their errors joined. Test and remediation events are skipped.
+func (am *Alertmanager) Send(ctx context.Context, ev Event) error {
+	if ev.Threshold == "test" || ev.Threshold == "remediation" {
+		return nil
+	}
+	raw, err := json.Marshal(am.alerts(ev, time.Now().UTC()))
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, u := range am.URLs {
+		if err := am.post(ctx, alertsURL(u), raw); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (am *Alertmanager) post(ctx context.Context, url string, raw []byte) error {
+	client := am.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("alertmanager %s returned %s: %s", url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
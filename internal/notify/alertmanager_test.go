@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hrodrig/pgwd/internal/postgres"
+)
+
+// alertmanagerStandIn is a local Alertmanager that records the alerts posted to /api/v2/alerts.
+func alertmanagerStandIn(t *testing.T) (*httptest.Server, *[]alertmanagerAlert) {
+	t.Helper()
+	var got []alertmanagerAlert
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/alerts" || r.Method != http.MethodPost {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		var alerts []alertmanagerAlert
+		if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		got = append(got, alerts...)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+func TestAlertmanager_firing(t *testing.T) {
+	srv, got := alertmanagerStandIn(t)
+	am := &Alertmanager{URLs: []string{srv.URL}, EndsAfter: 2 * time.Hour}
+	ev := Event{
+		Stats:          postgres.ConnectionStats{Total: 96, Active: 40, Idle: 56},
+		Threshold:      "idle_in_transaction",
+		ThresholdValue: 50,
+		Value:          56,
+		Level:          "alert",
+		Message:        "Idle in transaction 56 >= 50",
+		Cluster:        "prod",
+		Database:       "app",
+	}
+	if err := am.Send(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+	if len(*got) != 3 {
+		t.Fatalf("got %d alerts, want the alert level firing and the other two resolved", len(*got))
+	}
+	a := (*got)[0]
+	want := map[string]string{"alertname": "PgwdIdleInTransaction", "threshold": "idle_in_transaction", "level": "alert", "cluster": "prod", "database": "app"}
+	if !maps.Equal(a.Labels, want) {
+		t.Errorf("labels = %v, want %v", a.Labels, want)
+	}
+	if a.Annotations["summary"] != ev.Message || a.Annotations["total"] != "96" || a.Annotations["value"] != "56" {
+		t.Errorf("annotations = %v", a.Annotations)
+	}
+	if d := a.EndsAt.Sub(a.StartsAt); d != 2*time.Hour {
+		t.Errorf("endsAt - startsAt = %s, want EndsAfter", d)
+	}
+	for _, other := range (*got)[1:] {
+		if other.Labels["level"] == "alert" || !other.EndsAt.Equal(other.StartsAt) {
+			t.Errorf("other level alert = %+v, want resolved now", other)
+		}
+	}
+}
+
+func TestAlertmanager_resolved(t *testing.T) {
+	srv, got := alertmanagerStandIn(t)
+	ev := Event{Threshold: "stale", Resolved: true, Duration: 10 * time.Minute, Peak: 4, ThresholdValue: 1, Message: "Resolved: stale back below 1"}
+	if err := (&Alertmanager{URLs: []string{srv.URL + "/api/v2/alerts"}}).Send(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+	if len(*got) != 1 {
+		t.Fatalf("got %d alerts, want 1 (no level set: no siblings)", len(*got))
+	}
+	a := (*got)[0]
+	if a.Labels["level"] != "attention" || a.EndsAt.IsZero() || a.EndsAt.Sub(a.StartsAt) != 10*time.Minute {
+		t.Errorf("resolved alert = %+v, want endsAt set and startsAt at the incident start", a)
+	}
+	if a.Annotations["description"] != "active for 10m0s, peak stale=4 (limit 1)" {
+		t.Errorf("description = %q", a.Annotations["description"])
+	}
+}
+
+func TestAlertmanager_errors_from_each_url(t *testing.T) {
+	srv, got := alertmanagerStandIn(t)
+	err := (&Alertmanager{URLs: []string{srv.URL + "/wrong/prefix", srv.URL}}).Send(context.Background(), Event{Threshold: "total"})
+	if err == nil || len(*got) != 1 {
+		t.Errorf("err=%v, %d alerts: a failing Alertmanager should not stop the others", err, len(*got))
+	}
+}
+
+func TestAlertmanager_one_off_events(t *testing.T) {
+	srv, got := alertmanagerStandIn(t)
+	am := &Alertmanager{URLs: []string{srv.URL}, EndsAfter: 2 * time.Hour}
+	for _, threshold := range []string{"test", "remediation"} {
+		if err := am.Send(context.Background(), Event{Threshold: threshold}); err != nil || len(*got) != 0 {
+			t.Errorf("%s: err=%v, %d alerts; want it skipped", threshold, err, len(*got))
+		}
+	}
+	tests := []struct {
+		threshold string
+		endsAt    bool
+	}{
+		{"connect_failure", false}, // no resolved event follows: Alertmanager's resolve_timeout ends it
+		{"too_many_clients", false},
+		{"pgbouncer_connect_failure", true},
+	}
+	for _, tt := range tests {
+		*got = nil
+		if err := am.Send(context.Background(), Event{Threshold: tt.threshold}); err != nil || len(*got) != 1 {
+			t.Fatalf("%s: err=%v, %d alerts", tt.threshold, err, len(*got))
+		}
+		if a := (*got)[0]; a.EndsAt.IsZero() == tt.endsAt {
+			t.Errorf("%s: endsAt = %v, want set %v", tt.threshold, a.EndsAt, tt.endsAt)
+		}
+	}
+}
+
+func TestAlertmanagerLabels_application_metric(t *testing.T) {
+	ev := Event{Threshold: "application", Application: "web", Metric: "idle", Database: "app"}
+	want := map[string]string{"alertname": "PgwdApplication", "threshold": "application", "level": "alert", "database": "app", "application": "web", "metric": "idle"}
+	if got := alertmanagerLabels(ev, "alert"); !maps.Equal(got, want) {
+		t.Errorf("labels = %v, want %v", got, want)
+	}
+}
+
+func TestAlertmanagerName(t *testing.T) {
+	for threshold, want := range map[string]string{"total": "PgwdTotal", "connect_failure": "PgwdConnectFailure", "pgbouncer_maxwait": "PgwdPgbouncerMaxwait"} {
+		if got := alertmanagerName(threshold); got != want {
+			t.Errorf("alertmanagerName(%s) = %s, want %s", threshold, got, want)
+		}
+	}
+}
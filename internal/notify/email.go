@@ -0,0 +1,315 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Email TLS modes: STARTTLS after connecting (default, port 587), implicit TLS (port 465) or none (port 25).
+const (
+	EmailTLSStartTLS = "starttls"
+	EmailTLSImplicit = "tls"
+	EmailTLSNone     = "none"
+)
+
+// Email sends events as multipart (plain text and HTML) email over SMTP. The body carries the same fields as the
+// Slack message; the subject names the level and database.
+type Email struct {
+	Addr     string   // SMTP server host:port; without a port, the default port of TLS
+	TLS      string   // EmailTLSStartTLS (empty), EmailTLSImplicit or EmailTLSNone
+	Auth     string   // "plain" (empty) or "login"; used when Username is set
+	Username string   // empty = no authentication
+	Password string   // of Username
+	From     string   // e.g. "pgwd <pgwd@example.com>"
+	To       []string // recipients
+	// TLSConfig overrides the TLS settings (e.g. RootCAs); nil = verify the server certificate for its host name.
+	TLSConfig *tls.Config
+}
+
+// emailHTML is the HTML body: the Slack message as a heading, the message and a table of facts.
+var emailHTML = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html><body style="font-family: sans-serif">
+<h2 style="color: {{.Color}}">pgwd – {{.Title}}</h2>
+<p><strong>{{.Message}}</strong></p>
+<table cellpadding="4">
+{{- range .Facts}}
+<tr><th align="left" valign="top">{{.Title}}</th><td>{{.Value}}</td></tr>
+{{- end}}
+</table>
+{{- if .Sessions}}
+<h3>Sessions</h3>
+<pre>{{.Sessions}}</pre>
+{{- end}}
+</body></html>
+`))
+
+// emailSubject is "[pgwd] LEVEL database: message", e.g. "[pgwd] DANGER app: Total connections 96 >= 95".
+func emailSubject(ev Event) string {
+	level := strings.ToUpper(eventLevel(ev))
+	switch {
+	case ev.Resolved:
+		level = "RESOLVED"
+	case ev.Threshold == "test":
+		level = "TEST"
+	}
+	s := "[pgwd] " + level
+	if ev.Database != "" {
+		s += " " + ev.Database
+	}
+	return s + ": " + ev.Message
+}
+
+// emailColor is the heading color: green for resolved and test events, else the Slack color of the level.
+func emailColor(ev Event) string {
+	if ev.Resolved || ev.Threshold == "test" {
+		return "#2EB67D"
+	}
+	switch eventLevel(ev) {
+	case "attention":
+		return "#B8860B" // dark yellow: readable on white
+	case "danger":
+		return "#CC0000"
+	default:
+		return "#FF8C00"
+	}
+}
+
+// emailText is the plain-text body.
+func emailText(ev Event, ts string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "pgwd – %s\n\n%s\n\n", eventTitle(ev), ev.Message)
+	for _, f := range eventFacts(ev, ts) {
+		fmt.Fprintf(&b, "%s: %s\n", f.Title, f.Value)
+	}
+	if len(ev.Sessions) > 0 {
+		b.WriteString("\nSessions:\n" + sessionsTable(ev.Sessions))
+	}
+	return b.String()
+}
+
+// message returns the RFC 5322 message of ev: headers and a multipart/alternative body.
+func (e *Email) message(ev Event, now time.Time) ([]byte, error) {
+	ts := now.Format("2006-01-02 15:04:05")
+	var sessions string
+	if len(ev.Sessions) > 0 {
+		sessions = strings.TrimRight(sessionsTable(ev.Sessions), "\n")
+	}
+	var html bytes.Buffer
+	err := emailHTML.Execute(&html, map[string]any{
+		"Color":    emailColor(ev),
+		"Title":    eventTitle(ev),
+		"Message":  ev.Message,
+		"Facts":    eventFacts(ev, ts),
+		"Sessions": sessions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", emailText(ev, ts)},
+		{"text/html; charset=utf-8", html.String()},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	var msg bytes.Buffer
+	for _, h := range [][2]string{
+		{"From", e.From},
+		{"To", strings.Join(e.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", emailSubject(ev))},
+		{"Date", now.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + mw.Boundary()},
+	} {
+		fmt.Fprintf(&msg, "%s: %s\r\n", h[0], h[1])
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// server returns the host:port to dial and the host name to verify.
+func (e *Email) server() (addr, host string) {
+	if h, _, err := net.SplitHostPort(e.Addr); err == nil {
+		return e.Addr, h
+	}
+	port := "587"
+	switch e.TLS {
+	case EmailTLSImplicit:
+		port = "465"
+	case EmailTLSNone:
+		port = "25"
+	}
+	return net.JoinHostPort(e.Addr, port), e.Addr
+}
+
+func (e *Email) tlsConfig(host string) *tls.Config {
+	if e.TLSConfig != nil {
+		return e.TLSConfig
+	}
+	return &tls.Config{ServerName: host}
+}
+
+// dial connects to the SMTP server, with TLS from the start in implicit TLS mode.
+func (e *Email) dial(ctx context.Context, addr, host string) (net.Conn, error) {
+	if e.TLS == EmailTLSImplicit {
+		d := &tls.Dialer{Config: e.tlsConfig(host)}
+		return d.DialContext(ctx, "tcp", addr)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+func (e *Email) auth(host string) smtp.Auth {
+	if e.Auth == "login" {
+		return &loginAuth{username: e.Username, password: e.Password, host: host}
+	}
+	return smtp.PlainAuth("", e.Username, e.Password, host)
+}
+
+// Send delivers ev to every recipient in one SMTP transaction.
+func (e *Email) Send(ctx context.Context, ev Event) error {
+	msg, err := e.message(ev, time.Now())
+	if err != nil {
+		return err
+	}
+	addr, host := e.server()
+	conn, err := e.dial(ctx, addr, host)
+	if err != nil {
+		return err
+	}
+	// net/smtp has no context support: closing the connection aborts a send in progress.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if err := e.secure(c, host); err != nil {
+		return err
+	}
+	if err := e.deliver(c, msg); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// secure upgrades the connection with STARTTLS (unless TLS is implicit or none) and authenticates.
+func (e *Email) secure(c *smtp.Client, host string) error {
+	if e.TLS == "" || e.TLS == EmailTLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS (use email-tls tls or none)")
+		}
+		if err := c.StartTLS(e.tlsConfig(host)); err != nil {
+			return err
+		}
+	}
+	if e.Username == "" {
+		return nil
+	}
+	return c.Auth(e.auth(host))
+}
+
+// deliver sends msg from From to every To.
+func (e *Email) deliver(c *smtp.Client, msg []byte) error {
+	from, err := mail.ParseAddress(e.From)
+	if err != nil {
+		return fmt.Errorf("email from: %w", err)
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range e.To {
+		rcpt, err := mail.ParseAddress(to)
+		if err != nil {
+			return fmt.Errorf("email to: %w", err)
+		}
+		if err := c.Rcpt(rcpt.Address); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// loginAuth is the LOGIN SASL mechanism (username and password prompts), which some servers (e.g. Office 365)
+// offer instead of PLAIN. Like smtp.PlainAuth, it only sends credentials over TLS or to localhost.
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && server.Name != "localhost" && server.Name != "127.0.0.1" && server.Name != "::1" {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+	}
+}
+
+// ParseEmailAddresses parses a comma-separated address list (RFC 5322, e.g. "dba@example.com, On call
+// <oncall@example.com>") into one address per recipient.
+func ParseEmailAddresses(s string) ([]string, error) {
+	list, err := mail.ParseAddressList(s)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, len(list))
+	for i, a := range list {
+		addrs[i] = a.String()
+	}
+	return addrs, nil
+}
@@ -0,0 +1,271 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hrodrig/pgwd/internal/postgres"
+)
+
+// testCertificate returns a self-signed certificate for 127.0.0.1 and a client config that trusts it.
+func testCertificate(t *testing.T) (server, client *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		&tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+}
+
+// smtpMail is what the stand-in received in one session.
+type smtpMail struct {
+	secure bool
+	auth   string // PLAIN: "\x00user\x00pass"; LOGIN: "user:pass"
+	from   string
+	to     []string
+	data   string
+}
+
+// smtpStandIn is an in-process SMTP server for one session. With tlsConfig it offers STARTTLS, or speaks TLS
+// from the start when implicit is set.
+type smtpStandIn struct {
+	tlsConfig *tls.Config
+	implicit  bool
+	got       chan smtpMail
+}
+
+func startSMTP(t *testing.T, s *smtpStandIn) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s.got = make(chan smtpMail, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if s.implicit {
+			conn = tls.Server(conn, s.tlsConfig)
+		}
+		s.got <- s.session(conn)
+	}()
+	return ln.Addr().String()
+}
+
+func (s *smtpStandIn) session(conn net.Conn) smtpMail {
+	m := smtpMail{secure: s.implicit}
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 127.0.0.1 ESMTP stand-in")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return m
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO":
+			s.ehlo(tp, m.secure)
+		case "STARTTLS":
+			tp.PrintfLine("220 ready")
+			conn = tls.Server(conn, s.tlsConfig)
+			tp, m.secure = textproto.NewConn(conn), true
+		case "AUTH":
+			m.auth = smtpAuth(tp, arg)
+		case "MAIL":
+			m.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			m.to = append(m.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, _ := tp.ReadDotBytes()
+			m.data = string(data)
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return m
+		default:
+			tp.PrintfLine("250 ok")
+		}
+	}
+}
+
+func (s *smtpStandIn) ehlo(tp *textproto.Conn, secure bool) {
+	tp.PrintfLine("250-127.0.0.1")
+	if s.tlsConfig != nil && !secure {
+		tp.PrintfLine("250-STARTTLS")
+	}
+	tp.PrintfLine("250 AUTH PLAIN LOGIN")
+}
+
+func smtpAuth(tp *textproto.Conn, arg string) string {
+	mech, initial, _ := strings.Cut(arg, " ")
+	decode := func(s string) string {
+		b, _ := base64.StdEncoding.DecodeString(s)
+		return string(b)
+	}
+	var auth string
+	if mech == "PLAIN" {
+		auth = decode(initial)
+	} else {
+		tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Username:")))
+		user, _ := tp.ReadLine()
+		tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Password:")))
+		pass, _ := tp.ReadLine()
+		auth = decode(user) + ":" + decode(pass)
+	}
+	tp.PrintfLine("235 authenticated")
+	return auth
+}
+
+// emailParts parses a received message into its headers and decoded parts by content type.
+func emailParts(t *testing.T, data string) (mail.Header, map[string]string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string]string{}
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(p)
+		mediaType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		parts[mediaType] = string(b)
+	}
+	return msg.Header, parts
+}
+
+func TestEmail_Send_starttls(t *testing.T) {
+	serverTLS, clientTLS := testCertificate(t)
+	srv := &smtpStandIn{tlsConfig: serverTLS}
+	e := &Email{
+		Addr:      startSMTP(t, srv),
+		Username:  "pgwd",
+		Password:  "s3cret",
+		From:      "pgwd <pgwd@example.com>",
+		To:        []string{"dba@example.com", "On call <oncall@example.com>"},
+		TLSConfig: clientTLS,
+	}
+	ev := Event{
+		Stats:          postgres.ConnectionStats{Total: 96, Active: 40, Idle: 56},
+		Threshold:      "total",
+		ThresholdValue: 95,
+		Level:          "danger",
+		Message:        "Total connections 96 >= 95 <app>",
+		Cluster:        "prod",
+		Database:       "app",
+	}
+	if err := e.Send(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+	m := <-srv.got
+	if !m.secure || m.auth != "\x00pgwd\x00s3cret" || m.from != "pgwd@example.com" {
+		t.Errorf("secure=%v auth=%q from=%q", m.secure, m.auth, m.from)
+	}
+	if !slices.Equal(m.to, []string{"dba@example.com", "oncall@example.com"}) {
+		t.Errorf("recipients = %v", m.to)
+	}
+	header, parts := emailParts(t, m.data)
+	if got := header.Get("Subject"); got != "[pgwd] DANGER app: Total connections 96 >= 95 <app>" {
+		t.Errorf("subject = %q", got)
+	}
+	if text := parts["text/plain"]; !strings.Contains(text, "Connections: total=96 active=40 idle=56 (limit total=95)\n") || !strings.Contains(text, "Cluster: prod\n") {
+		t.Errorf("text part:\n%s", text)
+	}
+	if html := parts["text/html"]; !strings.Contains(html, "<th align=\"left\" valign=\"top\">Database</th><td>app</td>") || !strings.Contains(html, "96 &gt;= 95 &lt;app&gt;") {
+		t.Errorf("html part:\n%s", html)
+	}
+}
+
+func TestEmail_Send_implicit_tls_login(t *testing.T) {
+	serverTLS, clientTLS := testCertificate(t)
+	srv := &smtpStandIn{tlsConfig: serverTLS, implicit: true}
+	e := &Email{Addr: startSMTP(t, srv), TLS: EmailTLSImplicit, Auth: "login", Username: "pgwd", Password: "s3cret",
+		From: "pgwd@example.com", To: []string{"dba@example.com"}, TLSConfig: clientTLS}
+	if err := e.Send(context.Background(), Event{Threshold: "test", Message: "Test"}); err != nil {
+		t.Fatal(err)
+	}
+	if m := <-srv.got; !m.secure || m.auth != "pgwd:s3cret" {
+		t.Errorf("secure=%v auth=%q, want LOGIN over TLS", m.secure, m.auth)
+	}
+}
+
+func TestEmail_Send_requires_starttls(t *testing.T) {
+	srv := &smtpStandIn{}
+	e := &Email{Addr: startSMTP(t, srv), From: "pgwd@example.com", To: []string{"dba@example.com"}}
+	if err := e.Send(context.Background(), Event{Threshold: "test"}); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("Send() = %v, want a STARTTLS error", err)
+	}
+	e.TLS = EmailTLSNone
+	srv2 := &smtpStandIn{}
+	e.Addr = startSMTP(t, srv2)
+	if err := e.Send(context.Background(), Event{Threshold: "test"}); err != nil {
+		t.Errorf("Send() without TLS = %v", err)
+	}
+}
+
+func TestEmailSubject(t *testing.T) {
+	tests := []struct {
+		ev   Event
+		want string
+	}{
+		{Event{Threshold: "idle", Level: "alert", Database: "app", Message: "m"}, "[pgwd] ALERT app: m"},
+		{Event{Threshold: "connect_failure", Message: "m"}, "[pgwd] DANGER: m"},
+		{Event{Threshold: "total", Level: "danger", Resolved: true, Database: "app", Message: "m"}, "[pgwd] RESOLVED app: m"},
+		{Event{Threshold: "test", Message: "m"}, "[pgwd] TEST: m"},
+	}
+	for _, tt := range tests {
+		if got := emailSubject(tt.ev); got != tt.want {
+			t.Errorf("emailSubject() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// execStderrLength is how much of a failed command's stderr goes into the error.
+const execStderrLength = 512
+
+// Exec runs a command for each event: the event as JSON on stdin (as the default webhook body) and its key fields
+// in PGWD_EVENT_* environment variables. The command runs through the shell (sh -c, or cmd /C on Windows) and
+// inherits pgwd's environment without its PGWD_* variables (which hold the database URL and notifier secrets).
+// Exit status 0 is success; any other status, a timeout or a failure to start is an
+// error with the status and the end of stderr.
+type Exec struct {
+	Command string
+	Timeout time.Duration // kill the command after this long; 0 = only when the check is cancelled
+	// Slots bounds how many commands run at once: a send waits for a free slot (see NewExecSlots). Senders that
+	// share the channel share the limit; nil = unlimited.
+	Slots chan struct{}
+}
+
+// NewExecSlots returns a Slots channel for at most n concurrent commands; nil (unlimited) when n <= 0.
+func NewExecSlots(n int) chan struct{} {
+	if n <= 0 {
+		return nil
+	}
+	return make(chan struct{}, n)
+}
+
+// execEnv returns the PGWD_EVENT_* variables of ev.
+func execEnv(ev Event) []string {
+	vars := [][2]string{
+		{"THRESHOLD", ev.Threshold},
+		{"THRESHOLD_VALUE", strconv.Itoa(ev.ThresholdValue)},
+		{"VALUE", strconv.Itoa(ev.Value)},
+		{"LEVEL", eventLevel(ev)},
+		{"MESSAGE", ev.Message},
+		{"RESOLVED", strconv.FormatBool(ev.Resolved)},
+		{"DURATION", strconv.Itoa(int(ev.Duration.Seconds()))},
+		{"PEAK", strconv.Itoa(ev.Peak)},
+		{"TARGET", ev.Target},
+		{"CLUSTER", ev.Cluster},
+		{"DATABASE", ev.Database},
+		{"NAMESPACE", ev.Namespace},
+		{"CLIENT", ev.Client},
+		{"ROLE", ev.Role},
+		{"APPLICATION", ev.Application},
+		{"TOTAL", strconv.Itoa(ev.Stats.Total)},
+		{"ACTIVE", strconv.Itoa(ev.Stats.Active)},
+		{"IDLE", strconv.Itoa(ev.Stats.Idle)},
+		{"MAX_CONNECTIONS", strconv.Itoa(ev.MaxConnections)},
+	}
+	env := make([]string, len(vars))
+	for i, v := range vars {
+		env[i] = "PGWD_EVENT_" + v[0] + "=" + v[1]
+	}
+	return env
+}
+
+// execBaseEnv returns pgwd's environment without the PGWD_* variables.
+func execBaseEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "PGWD_") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// shellCommand returns the shell invocation of command for the current OS.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// Send runs the command for ev and waits for it.
+func (e *Exec) Send(ctx context.Context, ev Event) error {
+	raw, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if e.Slots != nil {
+		select {
+		case e.Slots <- struct{}{}:
+			defer func() { <-e.Slots }()
+		case <-ctx.Done():
+			return fmt.Errorf("exec %q: waiting for a free slot: %w", e.Command, ctx.Err())
+		}
+	}
+	cmdCtx := ctx
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		cmdCtx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+	var stderr bytes.Buffer
+	cmd := shellCommand(cmdCtx, e.Command)
+	cmd.Stdin = bytes.NewReader(raw)
+	cmd.Stderr = &stderr
+	cmd.Env = append(execBaseEnv(), execEnv(ev)...)
+	// Children that keep stderr open must not hold Wait after the command is killed.
+	cmd.WaitDelay = time.Second
+	err = cmd.Run()
+	if err == nil {
+		return nil
+	}
+	switch {
+	case ctx.Err() != nil:
+		err = fmt.Errorf("killed: %w", ctx.Err())
+	case cmdCtx.Err() != nil:
+		err = fmt.Errorf("timed out after %s", e.Timeout)
+	}
+	msg := stderr.String()
+	if len(msg) > execStderrLength {
+		msg = "…" + msg[len(msg)-execStderrLength:]
+	}
+	if msg = strings.TrimSpace(msg); msg != "" {
+		return fmt.Errorf("exec %q: %w: %s", e.Command, err, msg)
+	}
+	return fmt.Errorf("exec %q: %w", e.Command, err)
+}
@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hrodrig/pgwd/internal/postgres"
+)
+
+func skipWithoutShell(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("tests use sh")
+	}
+}
+
+func TestExec_stdin_and_env(t *testing.T) {
+	skipWithoutShell(t)
+	dir := t.TempDir()
+	t.Setenv("PGWD_DB_URL", "postgres://pgwd:secret@db/app")
+	t.Setenv("EXEC_TEST_INHERITED", "yes")
+	e := &Exec{Command: "cd '" + dir + "' && cat > event.json && env | grep '^PGWD_\\|^EXEC_TEST_' > event.env"}
+	ev := Event{
+		Stats:          postgres.ConnectionStats{Total: 96, Active: 40, Idle: 56},
+		Threshold:      "total",
+		ThresholdValue: 95,
+		Value:          96,
+		Level:          "danger",
+		Message:        "Total connections 96 >= 95",
+		Target:         "billing",
+		Database:       "app",
+	}
+	if err := e.Send(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, "event.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Event
+	if err := json.Unmarshal(raw, &got); err != nil || got.Message != ev.Message || got.Stats.Total != 96 {
+		t.Errorf("stdin %s: %v", raw, err)
+	}
+	env, _ := os.ReadFile(filepath.Join(dir, "event.env"))
+	for _, want := range []string{"PGWD_EVENT_THRESHOLD=total", "PGWD_EVENT_LEVEL=danger", "PGWD_EVENT_VALUE=96", "PGWD_EVENT_TARGET=billing",
+		"PGWD_EVENT_DATABASE=app", "PGWD_EVENT_TOTAL=96", "PGWD_EVENT_RESOLVED=false", "PGWD_EVENT_MESSAGE=Total connections 96 >= 95"} {
+		if !strings.Contains(string(env), want+"\n") {
+			t.Errorf("environment lacks %s:\n%s", want, env)
+		}
+	}
+	if !strings.Contains(string(env), "EXEC_TEST_INHERITED=yes\n") || strings.Contains(string(env), "PGWD_DB_URL") {
+		t.Errorf("environment should inherit pgwd's variables except PGWD_*:\n%s", env)
+	}
+}
+
+func TestExec_exit_status(t *testing.T) {
+	skipWithoutShell(t)
+	err := (&Exec{Command: "echo 'ticket API down' >&2; exit 3"}).Send(context.Background(), Event{Threshold: "test"})
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") || !strings.Contains(err.Error(), "ticket API down") {
+		t.Errorf("Send() = %v, want the exit status and stderr", err)
+	}
+}
+
+func TestExec_timeout(t *testing.T) {
+	skipWithoutShell(t)
+	start := time.Now()
+	err := (&Exec{Command: "sleep 10", Timeout: 100 * time.Millisecond}).Send(context.Background(), Event{Threshold: "test"})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Errorf("Send() = %v, want a timeout", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Send() took %s, want the command killed", d)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = (&Exec{Command: "sleep 10", Timeout: time.Minute}).Send(ctx, Event{Threshold: "test"})
+	if err == nil || !strings.Contains(err.Error(), "killed: context deadline exceeded") {
+		t.Errorf("Send() with the check deadline expired = %v, want killed, not timed out", err)
+	}
+}
+
+func TestExec_waits_for_a_slot(t *testing.T) {
+	skipWithoutShell(t)
+	slots := NewExecSlots(1)
+	slots <- struct{}{} // another command holds the only slot
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := (&Exec{Command: "true", Slots: slots}).Send(ctx, Event{}); err == nil || !strings.Contains(err.Error(), "free slot") {
+		t.Errorf("Send() = %v, want to give up waiting for a slot", err)
+	}
+	<-slots
+	if err := (&Exec{Command: "true", Slots: slots}).Send(context.Background(), Event{}); err != nil || len(slots) != 0 {
+		t.Errorf("Send() = %v with %d slots held, want success and the slot released", err, len(slots))
+	}
+	if NewExecSlots(0) != nil {
+		t.Error("NewExecSlots(0) should be unlimited (nil)")
+	}
+}
@@ -54,6 +54,10 @@ func buildLokiLabels(l *Loki, ev Event) map[string]string {
 	}
 	labels["threshold"] = ev.Threshold
 	labels["level"] = eventLevel(ev)
+	labels["status"] = "firing"
+	if ev.Resolved {
+		labels["status"] = "resolved"
+	}
 	if ev.Namespace != "" {
 		labels["namespace"] = ev.Namespace
 	}
@@ -63,45 +67,67 @@ func buildLokiLabels(l *Loki, ev Event) map[string]string {
 	if ev.Cluster != "" {
 		labels["cluster"] = ev.Cluster
 	}
+	if ev.Role != "" {
+		labels["role"] = ev.Role
+	}
+	if ev.Application != "" {
+		labels["application"] = ev.Application
+	}
 	return labels
 }
 
 func buildLokiLine(ev Event) string {
 	prefix := "pgwd:"
-	if ev.Cluster != "" || ev.Database != "" {
-		var parts []string
-		if ev.Cluster != "" {
-			parts = append(parts, fmt.Sprintf("cluster=%s", ev.Cluster))
-		}
-		if ev.Database != "" {
-			parts = append(parts, fmt.Sprintf("database=%s", ev.Database))
-		}
+	var parts []string
+	if ev.Cluster != "" {
+		parts = append(parts, fmt.Sprintf("cluster=%s", ev.Cluster))
+	}
+	if ev.Database != "" {
+		parts = append(parts, fmt.Sprintf("database=%s", ev.Database))
+	}
+	if ev.Role != "" {
+		parts = append(parts, fmt.Sprintf("role=%s", ev.Role))
+	}
+	if ev.Application != "" {
+		parts = append(parts, fmt.Sprintf("application=%s", ev.Application))
+	}
+	if len(parts) > 0 {
 		prefix = fmt.Sprintf("pgwd [%s]:", strings.Join(parts, " "))
 	}
-	line := fmt.Sprintf("%s %s | total=%d active=%d idle=%d", prefix, ev.Message, ev.Stats.Total, ev.Stats.Active, ev.Stats.Idle)
-	line += lokiLineSuffix(ev)
+	var line string
+	if ev.Resolved {
+		return fmt.Sprintf("%s %s | %s", prefix, ev.Message, resolvedText(ev))
+	}
+	if p := ev.PgBouncerPool; p != nil {
+		line = fmt.Sprintf("%s %s | pool=%s/%s %s%s", prefix, ev.Message, p.Database, p.User, formatPgBouncerPool(*p), thresholdSuffix(ev.Threshold, ev.ThresholdValue))
+	} else {
+		line = fmt.Sprintf("%s %s | total=%d active=%d idle=%d", prefix, ev.Message, ev.Stats.Total, ev.Stats.Active, ev.Stats.Idle)
+		line += extraCounts(ev.Stats)
+		line += lokiLineSuffix(ev)
+	}
+	if len(ev.TopApplications) > 0 {
+		line += " | top applications: " + formatTopApplications(ev.TopApplications)
+	}
+	for _, sess := range ev.Sessions {
+		line += " | session: " + formatSession(sess)
+	}
 	return line
 }
 
 func lokiLineSuffix(ev Event) string {
-	s := ""
-	if ev.MaxConnections > 0 {
-		s = fmt.Sprintf(" max_connections=%d", ev.MaxConnections)
-		if ev.MaxConnectionsIsOverride {
-			s += " (test override)"
-		}
-	}
-	return s + thresholdSuffix(ev.Threshold, ev.ThresholdValue)
+	return maxConnectionsText(ev) + thresholdSuffix(ev.Threshold, ev.ThresholdValue)
 }
 
 func thresholdSuffix(threshold string, value int) string {
 	switch threshold {
 	case "test":
 		return " (delivery check)"
-	case "connect_failure":
+	case "connect_failure", "pgbouncer_connect_failure":
 		return " (connection failed)"
 	case "too_many_clients":
 		return " (too many clients — DB saturated)"
+	case "remediation":
+		return fmt.Sprintf(" (remediation after %ds)", value)
 	default:
 		return fmt.Sprintf(" (limit %s=%d)", threshold, value)
 	}
@@ -151,9 +177,12 @@ func eventLevel(ev Event) string {
 // thresholdToLevel maps threshold to severity level for Loki labels (attention, alert, danger).
 func thresholdToLevel(threshold string) string {
 	switch threshold {
-	case "too_many_clients", "connect_failure":
+	case "too_many_clients", "connect_failure", "pgbouncer_connect_failure":
 		return "danger"
-	case "total", "active", "idle", "stale":
+	case "total", "active", "idle", "stale", "role", "role_connlimit", "application",
+		"idle_in_transaction", "idle_in_transaction_age", "long_query", "long_transaction",
+		"blocked", "blocked_wait", "remediation",
+		"pgbouncer_waiting", "pgbouncer_maxwait", "pgbouncer_clients", "pgbouncer_servers":
 		return "attention"
 	case "test":
 		return "attention"
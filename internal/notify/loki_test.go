@@ -3,8 +3,11 @@ package notify
 import (
 	"encoding/json"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/hrodrig/pgwd/internal/pgbouncer"
 	"github.com/hrodrig/pgwd/internal/postgres"
 )
 
@@ -64,6 +67,136 @@ func TestLoki_PushPayload_omits_empty_database_and_cluster(t *testing.T) {
 	}
 }
 
+func TestLoki_PushPayload_includes_role(t *testing.T) {
+	loki := &Loki{URL: "http://localhost:3100/loki/api/v1/push"}
+	ev := Event{
+		Stats:          postgres.ConnectionStats{Total: 50, Active: 10, Idle: 40},
+		Threshold:      "role_connlimit",
+		ThresholdValue: 42,
+		Message:        "Role app connections 45 >= 42 (85% of rolconnlimit 50) — alert",
+		Level:          "alert",
+		Database:       "myapp",
+		Role:           "app",
+	}
+	raw, err := loki.PushPayload(ev)
+	if err != nil {
+		t.Fatalf("PushPayload: %v", err)
+	}
+	var body lokiPushBody
+	if err := json.Unmarshal(raw, &body); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got := body.Streams[0].Stream["role"]; got != "app" {
+		t.Errorf("labels[%q] = %q, want app", "role", got)
+	}
+	line := body.Streams[0].Values[0][1]
+	if !strings.HasPrefix(line, "pgwd [database=myapp role=app]:") {
+		t.Errorf("line prefix: got %q", line)
+	}
+}
+
+func TestBuildLokiLine_application(t *testing.T) {
+	ev := Event{
+		Stats:          postgres.ConnectionStats{Total: 80, Active: 10, Idle: 70},
+		Threshold:      "application",
+		ThresholdValue: 50,
+		Message:        "Application billing-api idle connections 55 >= 50",
+		Application:    "billing-api",
+		TopApplications: []postgres.ApplicationConnectionStats{
+			{Application: "billing-api", ConnectionStats: postgres.ConnectionStats{Total: 60, Active: 5, Idle: 55}},
+			{Application: "", ConnectionStats: postgres.ConnectionStats{Total: 20, Active: 5, Idle: 15}},
+		},
+	}
+	want := "pgwd [application=billing-api]: Application billing-api idle connections 55 >= 50 | total=80 active=10 idle=70 (limit application=50)" +
+		" | top applications: billing-api=60 (active=5 idle=55), (unnamed)=20 (active=5 idle=15)"
+	if got := buildLokiLine(ev); got != want {
+		t.Errorf("buildLokiLine:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestThresholdSuffix(t *testing.T) {
+	tests := []struct {
+		threshold string
+		value     int
+		want      string
+	}{
+		{"total", 80, " (limit total=80)"},
+		{"test", 0, " (delivery check)"},
+		{"connect_failure", 0, " (connection failed)"},
+		{"pgbouncer_connect_failure", 0, " (connection failed)"},
+		{"too_many_clients", 0, " (too many clients — DB saturated)"},
+		{"remediation", 60, " (remediation after 60s)"},
+	}
+	for _, tt := range tests {
+		if got := thresholdSuffix(tt.threshold, tt.value); got != tt.want {
+			t.Errorf("thresholdSuffix(%s, %d) = %q, want %q", tt.threshold, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestBuildLokiLine_remediation(t *testing.T) {
+	ev := Event{
+		Stats:          postgres.ConnectionStats{Total: 12, Active: 2, Idle: 4},
+		Threshold:      "remediation",
+		ThresholdValue: 60,
+		Message:        "Terminated pid 4242 (user app, application web, idle in transaction 90s > 60s)",
+	}
+	want := "pgwd: Terminated pid 4242 (user app, application web, idle in transaction 90s > 60s) | total=12 active=2 idle=4 (remediation after 60s)"
+	if got := buildLokiLine(ev); got != want {
+		t.Errorf("buildLokiLine:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestBuildLokiLine_extra_counts(t *testing.T) {
+	ev := Event{
+		Stats:          postgres.ConnectionStats{Total: 12, Active: 2, Idle: 4, IdleInTransaction: 5, IdleInTransactionAborted: 1, Excluded: 7},
+		Threshold:      "idle_in_transaction",
+		ThresholdValue: 5,
+		Message:        "Idle in transaction connections 6 >= 5",
+	}
+	want := "pgwd: Idle in transaction connections 6 >= 5 | total=12 active=2 idle=4 idle_in_transaction=5 idle_in_transaction_aborted=1 excluded=7 (limit idle_in_transaction=5)"
+	if got := buildLokiLine(ev); got != want {
+		t.Errorf("buildLokiLine:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestBuildLokiLine_sessions(t *testing.T) {
+	ev := Event{
+		Stats:          postgres.ConnectionStats{Total: 3, Active: 2, Idle: 1},
+		Threshold:      "long_query",
+		ThresholdValue: 300,
+		Message:        "Long-running queries (> 300s): 1, oldest pid 4242 running 812s",
+		Sessions: []postgres.Session{
+			{PID: 4242, User: "app", Application: "billing-api", ClientAddr: "10.0.0.5", State: "active", AgeSeconds: 812, BackendAgeSeconds: 3600, Query: "SELECT *\n  FROM invoices"},
+		},
+	}
+	want := "pgwd: Long-running queries (> 300s): 1, oldest pid 4242 running 812s | total=3 active=2 idle=1 (limit long_query=300)" +
+		` | session: pid=4242 user=app application=billing-api client=10.0.0.5 state=active age=812s backend_age=3600s query="SELECT * FROM invoices"`
+	if got := buildLokiLine(ev); got != want {
+		t.Errorf("buildLokiLine:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestBuildLokiLine_effective_max_connections(t *testing.T) {
+	ev := Event{
+		Stats:                   postgres.ConnectionStats{Total: 93, Active: 10, Idle: 83},
+		Threshold:               "total",
+		ThresholdValue:          92,
+		Level:                   "danger",
+		Message:                 "Total connections 93 >= 92 (95% of effective max) — danger",
+		MaxConnections:          100,
+		EffectiveMaxConnections: 97,
+	}
+	want := "pgwd: Total connections 93 >= 92 (95% of effective max) — danger | total=93 active=10 idle=83 max_connections=100 effective_max_connections=97 (limit total=92)"
+	if got := buildLokiLine(ev); got != want {
+		t.Errorf("buildLokiLine:\n got %q\nwant %q", got, want)
+	}
+	ev.EffectiveMaxConnections = 100
+	if got := buildLokiLine(ev); strings.Contains(got, "effective_max_connections") {
+		t.Errorf("effective_max_connections should be omitted when equal to max, got %q", got)
+	}
+}
+
 func TestParseLokiLabels(t *testing.T) {
 	tests := []struct {
 		name string
@@ -89,3 +222,37 @@ func TestParseLokiLabels(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildLokiLine_pgbouncer_pool(t *testing.T) {
+	pool := pgbouncer.Pool{Database: "app", User: "billing", ClientActive: 40, ClientWaiting: 7, ServerActive: 20, MaxWaitSeconds: 12, Mode: "transaction"}
+	ev := Event{
+		Threshold:      "pgbouncer_waiting",
+		ThresholdValue: 5,
+		Message:        "PgBouncer pool app/billing waiting clients 7 >= 5",
+		Database:       "app",
+		Role:           "billing",
+		PgBouncerPool:  &pool,
+	}
+	got := buildLokiLine(ev)
+	want := "pgwd [database=app role=billing]: PgBouncer pool app/billing waiting clients 7 >= 5 | pool=app/billing " +
+		"cl_active=40 cl_waiting=7 sv_active=20 sv_idle=0 sv_used=0 maxwait=12s pool_mode=transaction (limit pgbouncer_waiting=5)"
+	if got != want {
+		t.Errorf("buildLokiLine:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestLoki_resolved(t *testing.T) {
+	loki := &Loki{URL: "http://localhost:3100/loki/api/v1/push"}
+	ev := Event{Threshold: "idle", ThresholdValue: 50, Message: "Idle connections 60 >= 50"}
+	if got := buildLokiLabels(loki, ev)["status"]; got != "firing" {
+		t.Errorf("status label = %q, want firing", got)
+	}
+	ev.Resolved, ev.Duration, ev.Peak, ev.Message = true, 90*time.Second, 64, "Resolved: idle back below 50"
+	if got := buildLokiLabels(loki, ev)["status"]; got != "resolved" {
+		t.Errorf("status label = %q, want resolved", got)
+	}
+	want := "pgwd: Resolved: idle back below 50 | active for 1m30s, peak idle=64 (limit 50)"
+	if got := buildLokiLine(ev); got != want {
+		t.Errorf("buildLokiLine = %q, want %q", got, want)
+	}
+}
@@ -2,30 +2,258 @@ package notify
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/hrodrig/pgwd/internal/pgbouncer"
 	"github.com/hrodrig/pgwd/internal/postgres"
 )
 
+// sessionsQueryLength is the number of characters of query text shown in sessions tables.
+const sessionsQueryLength = 60
+
 // Event is sent to Slack and/or Loki when a threshold is exceeded.
 type Event struct {
 	Stats          postgres.ConnectionStats
 	Threshold      string // e.g. "total", "active", "idle"
 	ThresholdValue int
-	Message        string
+	// Value is the observed value compared with ThresholdValue (connections, sessions or seconds).
+	Value   int
+	Message string
+	// BelowThreshold marks a check under ThresholdValue but within the resolve hysteresis: it keeps a firing
+	// alert from resolving and is never sent.
+	BelowThreshold bool
+	// Unevaluated marks a threshold a check could not evaluate (a failed query, PgBouncer unreachable, the check
+	// timeout): the alerts of Threshold (every threshold when empty, e.g. Postgres unreachable), in Database when
+	// set, are kept as they are instead of resolving. It is never sent.
+	Unevaluated bool
+	// Resolved marks the end of a firing alert. Duration is how long it was active and Peak its highest Value.
+	Resolved bool
+	Duration time.Duration
+	Peak     int
 	// Level is the severity for 3-tier alerts: "attention", "alert", "danger". When set, Loki and Slack use it. When empty, derived from threshold.
 	Level string
 	// MaxConnections is the server max_connections (0 = unknown, e.g. connect_failure).
 	MaxConnections int
+	// EffectiveMaxConnections is MaxConnections minus superuser_reserved_connections and reserved_connections:
+	// what non-superusers can actually use. Level percentages are relative to it. 0 = unknown.
+	EffectiveMaxConnections int
 	// MaxConnectionsIsOverride is true when MaxConnections came from -test-max-connections (test override), so total can exceed it.
 	MaxConnectionsIsOverride bool
+	// Target is the name of the -targets entry the event comes from; empty in single-database mode.
+	Target string
 	// Optional context for Slack (health-check style): cluster, client (host/service/pod), namespace, database.
 	Cluster   string
 	Client    string
 	Namespace string
 	Database  string // database name from connection URL (e.g. for non-Kube runs)
+	// Role is the database role (usename) for per-role thresholds ("role", "role_connlimit"); empty otherwise.
+	Role string
+	// Application is the application_name of the database clients for per-application thresholds ("application"); empty otherwise.
+	Application string
+	// Metric is the connection count an "application" threshold compares: total, active or idle; empty otherwise.
+	Metric string
+	// TopApplications lists the busiest application_name values in the database when the event fired (busiest first).
+	TopApplications []postgres.ApplicationConnectionStats
+	// Sessions lists the offending sessions (e.g. long-running queries, long transactions), oldest first.
+	Sessions []postgres.Session
+	// PgBouncerPool is the PgBouncer pool (SHOW POOLS row) for PgBouncer thresholds ("pgbouncer_*"); nil otherwise.
+	// When set, notifiers show its client/server counts instead of the Postgres connection counts.
+	PgBouncerPool *pgbouncer.Pool
 }
 
 // Sender can send an event to a destination (Slack, Loki).
 type Sender interface {
 	Send(ctx context.Context, ev Event) error
 }
+
+// fact is one "Name: value" row of a message (JSON as in an Adaptive Card FactSet).
+type fact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// eventTitle is what happened, as in the Slack title: "Danger", "Resolved", "Connection failure", ...
+func eventTitle(ev Event) string {
+	if ev.Resolved {
+		return "Resolved"
+	}
+	switch ev.Threshold {
+	case "test":
+		return "Test notification"
+	case "connect_failure", "pgbouncer_connect_failure":
+		return "Connection failure"
+	case "too_many_clients":
+		return "URGENT: too many clients (DB saturated)"
+	case "remediation":
+		return "Remediation"
+	}
+	switch ev.Level {
+	case "attention":
+		return "Attention"
+	case "alert":
+		return "Alert"
+	case "danger":
+		return "Danger"
+	default:
+		return "Threshold exceeded"
+	}
+}
+
+// eventFacts returns the "Name: value" rows of the Slack message without its sessions table, in the same order:
+// connections, cluster, database, ..., client, namespace, time. Empty values are left out.
+func eventFacts(ev Event, ts string) []fact {
+	var facts []fact
+	add := func(title, value string) {
+		if value != "" {
+			facts = append(facts, fact{title, value})
+		}
+	}
+	switch p := ev.PgBouncerPool; {
+	case ev.Resolved:
+		add("Resolved", resolvedText(ev))
+	case p != nil:
+		add("PgBouncer pool", p.Database+"/"+p.User+": "+formatPgBouncerPool(*p)+thresholdSuffix(ev.Threshold, ev.ThresholdValue))
+	default:
+		add("Connections", connectionsText(ev))
+	}
+	add("Cluster", ev.Cluster)
+	add("Database", ev.Database)
+	add("Role", ev.Role)
+	add("Application", ev.Application)
+	if len(ev.TopApplications) > 0 {
+		add("Top applications", formatTopApplications(ev.TopApplications))
+	}
+	add("Client", ev.Client)
+	add("Namespace", ev.Namespace)
+	add("Time", ts)
+	return facts
+}
+
+// applicationName returns the application_name for display ("(unnamed)" when clients did not set one).
+func applicationName(app string) string {
+	if app == "" {
+		return "(unnamed)"
+	}
+	return app
+}
+
+// formatTopApplications renders e.g. "billing-api=55 (active=5 idle=50), web=20 (active=2 idle=18)".
+func formatTopApplications(apps []postgres.ApplicationConnectionStats) string {
+	parts := make([]string, 0, len(apps))
+	for _, a := range apps {
+		parts = append(parts, fmt.Sprintf("%s=%d (active=%d idle=%d)", applicationName(a.Application), a.Total, a.Active, a.Idle))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// extraCounts renders " idle_in_transaction=N idle_in_transaction_aborted=M excluded=K" for the
+// connections line; each part only when non-zero so the common case stays short.
+func extraCounts(s postgres.ConnectionStats) string {
+	out := ""
+	if s.IdleInTransaction > 0 {
+		out += fmt.Sprintf(" idle_in_transaction=%d", s.IdleInTransaction)
+	}
+	if s.IdleInTransactionAborted > 0 {
+		out += fmt.Sprintf(" idle_in_transaction_aborted=%d", s.IdleInTransactionAborted)
+	}
+	if s.Excluded > 0 {
+		out += fmt.Sprintf(" excluded=%d", s.Excluded)
+	}
+	return out
+}
+
+// formatPgBouncerPool renders e.g. "cl_active=40 cl_waiting=7 sv_active=20 sv_idle=0 sv_used=3 maxwait=12s pool_mode=transaction".
+func formatPgBouncerPool(p pgbouncer.Pool) string {
+	line := fmt.Sprintf("cl_active=%d cl_waiting=%d sv_active=%d sv_idle=%d sv_used=%d maxwait=%ds",
+		p.ClientActive, p.ClientWaiting, p.ServerActive, p.ServerIdle, p.ServerUsed, p.MaxWaitSeconds)
+	if p.Mode != "" {
+		line += " pool_mode=" + p.Mode
+	}
+	return line
+}
+
+// formatSession renders one session on a single line, e.g.
+// pid=1234 user=app application=billing-api client=10.0.0.5 state=active age=812s backend_age=3600s query="SELECT ...".
+func formatSession(s postgres.Session) string {
+	line := fmt.Sprintf("pid=%d user=%s application=%s client=%s state=%s age=%ds backend_age=%ds",
+		s.PID, s.User, applicationName(s.Application), sessionClient(s), s.State, s.AgeSeconds, s.BackendAgeSeconds)
+	if q := oneLine(s.Query); q != "" {
+		line += fmt.Sprintf(" query=%q", q)
+	}
+	return line
+}
+
+// sessionsTable renders the offender snapshot as a plain-text table with aligned columns and truncated queries.
+func sessionsTable(sessions []postgres.Session) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PID\tUSER\tAPPLICATION\tCLIENT\tSTATE\tAGE\tBACKEND AGE\tQUERY")
+	for _, s := range sessions {
+		q := oneLine(s.Query)
+		if r := []rune(q); len(r) > sessionsQueryLength {
+			q = string(r[:sessionsQueryLength]) + "…"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%ds\t%ds\t%s\n",
+			s.PID, s.User, applicationName(s.Application), sessionClient(s), s.State, s.AgeSeconds, s.BackendAgeSeconds, q)
+	}
+	w.Flush()
+	return b.String()
+}
+
+// sessionClient returns the client address, or "local" for Unix socket connections.
+func sessionClient(s postgres.Session) string {
+	if s.ClientAddr == "" {
+		return "local"
+	}
+	return s.ClientAddr
+}
+
+// oneLine collapses whitespace (newlines, indentation) in query text.
+func oneLine(q string) string {
+	return strings.Join(strings.Fields(q), " ")
+}
+
+// resolvedText renders a resolved event's summary, e.g. "active for 12m0s, peak total=95 (limit 80)".
+func resolvedText(ev Event) string {
+	return fmt.Sprintf("active for %s, peak %s=%d (limit %d)", ev.Duration.Round(time.Second), ev.Threshold, ev.Peak, ev.ThresholdValue)
+}
+
+// connectionsText renders the connection counts of ev and what it was compared with, e.g.
+// "total=85 active=40 idle=45 max_connections=100 (limit total=80)".
+func connectionsText(ev Event) string {
+	line := fmt.Sprintf("total=%d active=%d idle=%d", ev.Stats.Total, ev.Stats.Active, ev.Stats.Idle)
+	line += extraCounts(ev.Stats)
+	line += maxConnectionsText(ev)
+	switch ev.Threshold {
+	case "test":
+		line += " (delivery check)"
+	case "connect_failure", "pgbouncer_connect_failure":
+		line += " (connection failed)"
+	case "too_many_clients":
+		line += " (too many clients — DB saturated)"
+	case "remediation":
+		line += fmt.Sprintf(" (remediation after %ds)", ev.ThresholdValue)
+	default:
+		line += fmt.Sprintf(" (limit %s=%d)", ev.Threshold, ev.ThresholdValue)
+	}
+	return line
+}
+
+// maxConnectionsText renders " max_connections=100 effective_max_connections=97 (test override)" for the
+// connections line; effective only when lower than max, "" when max is unknown.
+func maxConnectionsText(ev Event) string {
+	if ev.MaxConnections <= 0 {
+		return ""
+	}
+	s := fmt.Sprintf(" max_connections=%d", ev.MaxConnections)
+	if ev.EffectiveMaxConnections > 0 && ev.EffectiveMaxConnections < ev.MaxConnections {
+		s += fmt.Sprintf(" effective_max_connections=%d", ev.EffectiveMaxConnections)
+	}
+	if ev.MaxConnectionsIsOverride {
+		s += " (test override)"
+	}
+	return s
+}
@@ -0,0 +1,32 @@
+package notify
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hrodrig/pgwd/internal/postgres"
+)
+
+func TestEventFacts_in_slack_order(t *testing.T) {
+	ev := Event{
+		Stats:          postgres.ConnectionStats{Total: 80, Active: 10, Idle: 70},
+		Threshold:      "application",
+		ThresholdValue: 50,
+		Level:          "alert",
+		Cluster:        "prod",
+		Database:       "myapp",
+		Application:    "billing-api",
+		Client:         "vm-1",
+	}
+	want := []fact{
+		{"Connections", "total=80 active=10 idle=70 (limit application=50)"},
+		{"Cluster", "prod"},
+		{"Database", "myapp"},
+		{"Application", "billing-api"},
+		{"Client", "vm-1"},
+		{"Time", "2026-03-13 10:00:00"},
+	}
+	if got := eventFacts(ev, "2026-03-13 10:00:00"); !reflect.DeepEqual(got, want) {
+		t.Errorf("eventFacts:\n got %v\nwant %v", got, want)
+	}
+}
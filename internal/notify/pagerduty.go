@@ -0,0 +1,192 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// PagerDutyEventsURL is the PagerDuty Events API v2 endpoint (EU accounts use https://events.eu.pagerduty.com/v2/enqueue).
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// pagerDutySummaryLength is the longest summary PagerDuty accepts.
+const pagerDutySummaryLength = 1024
+
+// PagerDuty sends events to the PagerDuty Events API v2: threshold events trigger an incident and resolved events
+// resolve it. The dedup key is stable per condition (target, database, threshold and its role, application or
+// pool), so repeats and level changes update the open incident instead of opening new ones. Connect failures
+// never get a resolved event, so their trigger is followed by a resolve; test and remediation events are not
+// sent (they are not incidents).
+type PagerDuty struct {
+	RoutingKey string // integration key of an Events API v2 service integration
+	URL        string // empty = PagerDutyEventsURL
+	Client     *http.Client
+}
+
+// pagerDutyEvent is the Events API v2 request body.
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"` // trigger or resolve
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"` // trigger only
+}
+
+type pagerDutyPayload struct {
+	Summary       string         `json:"summary"`
+	Source        string         `json:"source"`
+	Severity      string         `json:"severity"`
+	Timestamp     string         `json:"timestamp,omitempty"`
+	Component     string         `json:"component,omitempty"`
+	Group         string         `json:"group,omitempty"`
+	Class         string         `json:"class,omitempty"`
+	CustomDetails map[string]any `json:"custom_details,omitempty"`
+}
+
+// pagerDutyDedupKey identifies the condition of ev, independent of its level and values.
+func pagerDutyDedupKey(ev Event) string {
+	parts := []string{"pgwd", ev.Target, ev.Database, ev.Threshold}
+	switch {
+	case ev.PgBouncerPool != nil:
+		parts = append(parts, ev.PgBouncerPool.Database+"/"+ev.PgBouncerPool.User)
+	case ev.Role != "":
+		parts = append(parts, "role="+ev.Role)
+	case ev.Application != "":
+		parts = append(parts, "application="+ev.Application, "metric="+ev.Metric)
+	}
+	return strings.Join(parts, ":")
+}
+
+// pagerDutySeverity maps the event level to a PagerDuty severity: danger is critical, alert is error, attention is
+// warning.
+func pagerDutySeverity(ev Event) string {
+	switch eventLevel(ev) {
+	case "danger":
+		return "critical"
+	case "alert":
+		return "error"
+	default:
+		return "warning"
+	}
+}
+
+// pagerDutyDetails are the custom details of a trigger: where the event comes from and the connection counts.
+func pagerDutyDetails(ev Event) map[string]any {
+	d := map[string]any{
+		"threshold":       ev.Threshold,
+		"threshold_value": ev.ThresholdValue,
+		"level":           eventLevel(ev),
+	}
+	for k, v := range map[string]string{
+		"target": ev.Target, "cluster": ev.Cluster, "database": ev.Database, "namespace": ev.Namespace,
+		"client": ev.Client, "role": ev.Role, "application": ev.Application, "metric": ev.Metric,
+	} {
+		if v != "" {
+			d[k] = v
+		}
+	}
+	if ev.Value > 0 {
+		d["value"] = ev.Value
+	}
+	if p := ev.PgBouncerPool; p != nil {
+		d["pgbouncer_pool"] = p.Database + "/" + p.User
+		d["pgbouncer"] = formatPgBouncerPool(*p)
+		return d
+	}
+	d["connections"] = map[string]int{"total": ev.Stats.Total, "active": ev.Stats.Active, "idle": ev.Stats.Idle}
+	if ev.MaxConnections > 0 {
+		d["max_connections"] = ev.MaxConnections
+	}
+	if ev.EffectiveMaxConnections > 0 {
+		d["effective_max_connections"] = ev.EffectiveMaxConnections
+	}
+	if len(ev.TopApplications) > 0 {
+		d["top_applications"] = formatTopApplications(ev.TopApplications)
+	}
+	if len(ev.Sessions) > 0 {
+		sessions := make([]string, len(ev.Sessions))
+		for i, s := range ev.Sessions {
+			sessions[i] = formatSession(s)
+		}
+		d["sessions"] = sessions
+	}
+	return d
+}
+
+// body returns the Events API v2 request for ev: a resolve for resolved events, else a trigger.
+func (p *PagerDuty) body(ev Event) ([]byte, error) {
+	pe := pagerDutyEvent{RoutingKey: p.RoutingKey, EventAction: "trigger", DedupKey: pagerDutyDedupKey(ev)}
+	if ev.Resolved {
+		pe.EventAction = "resolve"
+		return json.Marshal(pe)
+	}
+	source := ev.Client
+	if source == "" {
+		source = "pgwd"
+	}
+	summary := ev.Message
+	if r := []rune(summary); len(r) > pagerDutySummaryLength {
+		summary = string(r[:pagerDutySummaryLength])
+	}
+	pe.Payload = &pagerDutyPayload{
+		Summary:       summary,
+		Source:        source,
+		Severity:      pagerDutySeverity(ev),
+		Timestamp:     time.Now().UTC().Format(time.RFC3339),
+		Component:     ev.Database,
+		Group:         ev.Cluster,
+		Class:         ev.Threshold,
+		CustomDetails: pagerDutyDetails(ev),
+	}
+	return json.Marshal(pe)
+}
+
+// Send posts ev to the Events API: a trigger and then a resolve for connect failures, nothing for test and
+// remediation events.
+func (p *PagerDuty) Send(ctx context.Context, ev Event) error {
+	switch ev.Threshold {
+	case "test", "remediation":
+		return nil
+	case "connect_failure", "too_many_clients":
+		if err := p.post(ctx, ev); err != nil || ev.Resolved {
+			return err
+		}
+		ev.Resolved = true
+	}
+	return p.post(ctx, ev)
+}
+
+// post sends the Events API request for ev.
+func (p *PagerDuty) post(ctx context.Context, ev Event) error {
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	url := p.URL
+	if url == "" {
+		url = PagerDutyEventsURL
+	}
+	raw, err := p.body(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pagerduty returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
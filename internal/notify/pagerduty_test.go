@@ -0,0 +1,180 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hrodrig/pgwd/internal/postgres"
+)
+
+// pagerDutyStandIn is a local Events API v2 that records the request bodies it accepts.
+func pagerDutyStandIn(t *testing.T, status int) (*httptest.Server, *[]pagerDutyEvent) {
+	t.Helper()
+	var got []pagerDutyEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with Content-Type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		var ev pagerDutyEvent
+		raw, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			t.Errorf("body: %v", err)
+		}
+		got = append(got, ev)
+		w.WriteHeader(status)
+		io.WriteString(w, `{"status":"success","message":"Event processed"}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+// pagerDutyEventFixture is a danger total event of the billing target.
+func pagerDutyEventFixture() Event {
+	return Event{
+		Stats:          postgres.ConnectionStats{Total: 96, Active: 40, Idle: 56},
+		Threshold:      "total",
+		ThresholdValue: 95,
+		Value:          96,
+		Level:          "danger",
+		Message:        "Total connections 96 >= 95",
+		MaxConnections: 100,
+		Target:         "billing",
+		Cluster:        "prod",
+		Database:       "app",
+		Client:         "vm-1",
+	}
+}
+
+func TestPagerDuty_trigger(t *testing.T) {
+	srv, got := pagerDutyStandIn(t, http.StatusAccepted)
+	if err := (&PagerDuty{RoutingKey: "R0UT1NG", URL: srv.URL}).Send(context.Background(), pagerDutyEventFixture()); err != nil {
+		t.Fatal(err)
+	}
+	trigger := (*got)[0]
+	if trigger.RoutingKey != "R0UT1NG" || trigger.EventAction != "trigger" || trigger.DedupKey != "pgwd:billing:app:total" {
+		t.Errorf("trigger = %+v", trigger)
+	}
+	p := trigger.Payload
+	if p == nil || p.Severity != "critical" || p.Summary != "Total connections 96 >= 95" || p.Source != "vm-1" || p.Group != "prod" || p.Component != "app" {
+		t.Fatalf("payload = %+v", p)
+	}
+	if conns, _ := p.CustomDetails["connections"].(map[string]any); conns["total"] != float64(96) || conns["idle"] != float64(56) {
+		t.Errorf("custom details = %v", p.CustomDetails)
+	}
+}
+
+func TestPagerDutyDedupKey_application_metric(t *testing.T) {
+	idle := Event{Target: "billing", Database: "app", Threshold: "application", Application: "web", Metric: "idle"}
+	total := idle
+	total.Metric = "total"
+	if got := pagerDutyDedupKey(idle); got != "pgwd:billing:app:application:application=web:metric=idle" {
+		t.Errorf("dedup key = %q", got)
+	}
+	if pagerDutyDedupKey(idle) == pagerDutyDedupKey(total) {
+		t.Error("dedup key should include the application metric")
+	}
+}
+
+func TestPagerDutyDetails(t *testing.T) {
+	d := pagerDutyDetails(pagerDutyEventFixture())
+	for k, want := range map[string]any{"target": "billing", "cluster": "prod", "database": "app", "level": "danger", "value": 96, "max_connections": 100} {
+		if d[k] != want {
+			t.Errorf("%s = %v, want %v", k, d[k], want)
+		}
+	}
+	if _, ok := d["namespace"]; ok {
+		t.Error("empty namespace should be left out")
+	}
+}
+
+func TestPagerDuty_resolve(t *testing.T) {
+	srv, got := pagerDutyStandIn(t, http.StatusAccepted)
+	pd := &PagerDuty{RoutingKey: "R0UT1NG", URL: srv.URL}
+	ev := pagerDutyEventFixture()
+	pd.Send(context.Background(), ev)
+	ev.Resolved, ev.Level, ev.Message = true, "", "Resolved: total back below 95"
+	if err := pd.Send(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+	trigger, resolve := (*got)[0], (*got)[1]
+	if resolve.EventAction != "resolve" || resolve.DedupKey != trigger.DedupKey || resolve.Payload != nil {
+		t.Errorf("resolve = %+v, want the trigger's dedup key and no payload", resolve)
+	}
+}
+
+func TestPagerDuty_one_off_events(t *testing.T) {
+	srv, got := pagerDutyStandIn(t, http.StatusAccepted)
+	pd := &PagerDuty{RoutingKey: "R0UT1NG", URL: srv.URL}
+	for _, threshold := range []string{"test", "remediation"} {
+		if err := pd.Send(context.Background(), Event{Threshold: threshold, Message: "m"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(*got) != 0 {
+		t.Fatalf("test and remediation events sent %+v, want nothing", *got)
+	}
+	if err := pd.Send(context.Background(), Event{Threshold: "connect_failure", Target: "billing", Message: "down"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(*got) != 2 || (*got)[0].EventAction != "trigger" || (*got)[1].EventAction != "resolve" || (*got)[1].DedupKey != (*got)[0].DedupKey {
+		t.Errorf("connect failure sent %+v, want a trigger and a resolve of the same incident", *got)
+	}
+}
+
+func TestPagerDuty_summary_truncated_on_a_rune(t *testing.T) {
+	ev := pagerDutyEventFixture()
+	ev.Message = strings.Repeat("é", pagerDutySummaryLength+1)
+	raw, err := (&PagerDuty{}).body(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pe pagerDutyEvent
+	if err := json.Unmarshal(raw, &pe); err != nil {
+		t.Fatal(err)
+	}
+	if got := pe.Payload.Summary; got != strings.Repeat("é", pagerDutySummaryLength) {
+		t.Errorf("summary has %d bytes, want %d runes of é", len(got), pagerDutySummaryLength)
+	}
+}
+
+func TestPagerDuty_error_status(t *testing.T) {
+	srv, _ := pagerDutyStandIn(t, http.StatusBadRequest)
+	err := (&PagerDuty{RoutingKey: "bad", URL: srv.URL}).Send(context.Background(), Event{Threshold: "total"})
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Send() = %v, want an error with the status", err)
+	}
+}
+
+func TestPagerDutySeverity(t *testing.T) {
+	tests := []struct {
+		ev   Event
+		want string
+	}{
+		{Event{Threshold: "total", Level: "danger"}, "critical"},
+		{Event{Threshold: "total", Level: "alert"}, "error"},
+		{Event{Threshold: "total", Level: "attention"}, "warning"},
+		{Event{Threshold: "too_many_clients"}, "critical"},
+		{Event{Threshold: "idle"}, "warning"},
+	}
+	for _, tt := range tests {
+		if got := pagerDutySeverity(tt.ev); got != tt.want {
+			t.Errorf("pagerDutySeverity(%s/%s) = %s, want %s", tt.ev.Threshold, tt.ev.Level, got, tt.want)
+		}
+	}
+}
+
+func TestPagerDutyDedupKey_ignores_level_and_values(t *testing.T) {
+	a := pagerDutyDedupKey(Event{Target: "t", Database: "app", Threshold: "role", Role: "web", Level: "alert", Value: 10})
+	b := pagerDutyDedupKey(Event{Target: "t", Database: "app", Threshold: "role", Role: "web", Level: "danger", Value: 20})
+	if a != b || a != "pgwd:t:app:role:role=web" {
+		t.Errorf("dedup keys %q, %q", a, b)
+	}
+	if a == pagerDutyDedupKey(Event{Target: "t", Database: "app", Threshold: "role", Role: "batch"}) {
+		t.Error("dedup key should include the role")
+	}
+}
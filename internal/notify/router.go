@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// Route sends the events it matches to Senders. Each non-nil pattern must match its field; Level is the event's
+// level, derived from the threshold when the event has none (as in the Loki level label).
+type Route struct {
+	Level, Threshold, Database, Cluster *regexp.Regexp
+	Senders                             []Sender
+	Continue                            bool // also try the next routes after a match
+}
+
+func (r *Route) matches(ev Event) bool {
+	for _, m := range []struct {
+		re    *regexp.Regexp
+		value string
+	}{{r.Level, eventLevel(ev)}, {r.Threshold, ev.Threshold}, {r.Database, ev.Database}, {r.Cluster, ev.Cluster}} {
+		if m.re != nil && !m.re.MatchString(m.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Router is a Sender that routes each event: to the senders of the first route that matches it (and of later
+// matching routes while the matched ones have Continue), or to Default when no route matches.
+type Router struct {
+	Routes  []Route
+	Default []Sender
+}
+
+// Send sends ev to every sender it is routed to, once each, and returns their errors joined. It returns an error
+// when ev matches no route and there is no default.
+func (r *Router) Send(ctx context.Context, ev Event) error {
+	senders := r.Senders(ev)
+	if len(senders) == 0 {
+		return fmt.Errorf("no route matches the %s event and there is no default receiver", ev.Threshold)
+	}
+	var errs []error
+	for _, s := range senders {
+		if err := s.Send(ctx, ev); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Senders returns the senders ev is routed to, each once. Callers that need to know which of them accepted ev
+// send to them one by one instead of calling Send.
+func (r *Router) Senders(ev Event) []Sender {
+	var senders []Sender
+	matched := false
+	for i := range r.Routes {
+		rt := &r.Routes[i]
+		if !rt.matches(ev) {
+			continue
+		}
+		matched = true
+		for _, s := range rt.Senders {
+			if !slices.Contains(senders, s) {
+				senders = append(senders, s)
+			}
+		}
+		if !rt.Continue {
+			break
+		}
+	}
+	if !matched {
+		return r.Default
+	}
+	return senders
+}
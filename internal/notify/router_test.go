@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+// recorder is a Sender that records the events it receives.
+type recorder struct {
+	name   string
+	events []Event
+	err    error
+}
+
+func (r *recorder) Send(_ context.Context, ev Event) error {
+	r.events = append(r.events, ev)
+	return r.err
+}
+
+func TestRouter(t *testing.T) {
+	paging, logs, tests, fallback := &recorder{name: "paging"}, &recorder{name: "logs"}, &recorder{name: "tests"}, &recorder{name: "default"}
+	r := &Router{
+		Routes: []Route{
+			{Threshold: regexp.MustCompile("^(?:test)$"), Senders: []Sender{tests}},
+			{Level: regexp.MustCompile("^(?:danger)$"), Senders: []Sender{paging, logs}, Continue: true},
+			{Level: regexp.MustCompile("^(?:attention|danger)$"), Senders: []Sender{logs}},
+		},
+		Default: []Sender{fallback},
+	}
+	events := []Event{
+		{Threshold: "test"},                   // tests only: first match wins
+		{Threshold: "total", Level: "danger"}, // paging and logs (once, despite Continue)
+		{Threshold: "too_many_clients"},       // no Level: derived as danger
+		{Threshold: "idle", Level: "attention"},
+		{Threshold: "total", Level: "alert"}, // no route: default
+	}
+	for _, ev := range events {
+		if err := r.Send(context.Background(), ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range []struct {
+		r    *recorder
+		want []string
+	}{
+		{tests, []string{"test"}},
+		{paging, []string{"total", "too_many_clients"}},
+		{logs, []string{"total", "too_many_clients", "idle"}},
+		{fallback, []string{"total"}},
+	} {
+		var got []string
+		for _, ev := range tt.r.events {
+			got = append(got, ev.Threshold)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s got %v, want %v", tt.r.name, got, tt.want)
+		}
+	}
+}
+
+func TestRouter_database_and_cluster(t *testing.T) {
+	prod := &recorder{}
+	r := &Router{Routes: []Route{{Database: regexp.MustCompile("^(?:billing)$"), Cluster: regexp.MustCompile("^(?:prod-.*)$"), Senders: []Sender{prod}}}}
+	r.Send(context.Background(), Event{Database: "billing", Cluster: "prod-eu"})
+	r.Send(context.Background(), Event{Database: "billing", Cluster: "staging"})
+	if len(prod.events) != 1 {
+		t.Errorf("got %d events, want 1 (all patterns must match)", len(prod.events))
+	}
+}
+
+func TestRouter_errors_are_joined(t *testing.T) {
+	a, b := &recorder{err: errors.New("a failed")}, &recorder{}
+	r := &Router{Default: []Sender{a, b}}
+	if err := r.Send(context.Background(), Event{}); err == nil || len(b.events) != 1 {
+		t.Errorf("err=%v, b got %d events: one failing sender should not stop the others", err, len(b.events))
+	}
+}
+
+func TestRouter_no_route_without_default(t *testing.T) {
+	r := &Router{Routes: []Route{{Level: regexp.MustCompile("^(?:danger)$"), Senders: []Sender{&recorder{}}}}}
+	if got := r.Senders(Event{Threshold: "idle", Level: "attention"}); len(got) != 0 {
+		t.Errorf("Senders = %v, want none", got)
+	}
+	if err := r.Send(context.Background(), Event{Threshold: "idle", Level: "attention"}); err == nil {
+		t.Error("an event no route matches without a default should be an error, not delivered")
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/hrodrig/pgwd/internal/postgres"
 )
 
 // Slack sends events to Slack via Incoming Webhook.
@@ -16,71 +19,80 @@ type Slack struct {
 }
 
 func slackHeader(ev Event, ts string) string {
-	var h string
-	switch ev.Threshold {
-	case "test":
-		h = ":white_check_mark: *pgwd* – Test notification\n"
-	case "connect_failure":
-		h = ":warning: *pgwd* – Connection failure\n"
-	case "too_many_clients":
-		h = ":rotating_light: *pgwd* – URGENT: too many clients (DB saturated)\n"
-	default:
-		if ev.Level != "" {
-			switch ev.Level {
-			case "attention":
-				h = ":large_yellow_circle: *pgwd* – Attention\n"
-			case "alert":
-				h = ":large_orange_circle: *pgwd* – Alert\n"
-			case "danger":
-				h = ":red_circle: *pgwd* – Danger\n"
-			default:
-				h = ":warning: *pgwd* – Threshold exceeded\n"
-			}
-		} else {
-			h = ":warning: *pgwd* – Threshold exceeded\n"
-		}
-	}
+	h := slackTitle(ev)
 	h += "*" + ev.Message + "*\n"
 	// Most important first: Connections, Cluster, Database, then Client, Namespace, Time
 	h += slackConnLine(ev) + "\n"
-	if ev.Cluster != "" {
-		h += fmt.Sprintf("• *Cluster*: %s\n", ev.Cluster)
-	}
-	if ev.Database != "" {
-		h += fmt.Sprintf("• *Database*: %s\n", ev.Database)
-	}
-	if ev.Client != "" {
-		h += fmt.Sprintf("• *Client*: %s\n", ev.Client)
+	h += slackField("Cluster", ev.Cluster)
+	h += slackField("Database", ev.Database)
+	h += slackField("Role", ev.Role)
+	h += slackField("Application", ev.Application)
+	if len(ev.TopApplications) > 0 {
+		h += slackField("Top applications", formatTopApplications(ev.TopApplications))
 	}
-	if ev.Namespace != "" {
-		h += fmt.Sprintf("• *Namespace*: %s\n", ev.Namespace)
+	if len(ev.Sessions) > 0 {
+		h += slackSessionsTable(ev.Sessions)
 	}
+	h += slackField("Client", ev.Client)
+	h += slackField("Namespace", ev.Namespace)
 	h += fmt.Sprintf("• *Time*: %s\n", ts)
 	return h
 }
 
-func slackConnLine(ev Event) string {
-	line := fmt.Sprintf("• *Connections*: total=%d active=%d idle=%d", ev.Stats.Total, ev.Stats.Active, ev.Stats.Idle)
-	if ev.MaxConnections > 0 {
-		line += fmt.Sprintf(" max_connections=%d", ev.MaxConnections)
-		if ev.MaxConnectionsIsOverride {
-			line += " (test override)"
-		}
+// slackField returns a "• *Name*: value" line, or "" when value is empty.
+func slackField(name, value string) string {
+	if value == "" {
+		return ""
+	}
+	return fmt.Sprintf("• *%s*: %s\n", name, value)
+}
+
+// slackSessionsTable renders the offender snapshot as a monospace table in a code block.
+func slackSessionsTable(sessions []postgres.Session) string {
+	// A backtick in query text would close the code block.
+	return "• *Sessions*:\n```\n" + strings.ReplaceAll(sessionsTable(sessions), "`", "'") + "```\n"
+}
+
+func slackTitle(ev Event) string {
+	if ev.Resolved {
+		return ":large_green_circle: *pgwd* – Resolved\n"
 	}
 	switch ev.Threshold {
 	case "test":
-		line += " (delivery check)"
-	case "connect_failure":
-		line += " (connection failed)"
+		return ":white_check_mark: *pgwd* – Test notification\n"
+	case "connect_failure", "pgbouncer_connect_failure":
+		return ":warning: *pgwd* – Connection failure\n"
 	case "too_many_clients":
-		line += " (too many clients — DB saturated)"
+		return ":rotating_light: *pgwd* – URGENT: too many clients (DB saturated)\n"
+	case "remediation":
+		return ":hammer_and_wrench: *pgwd* – Remediation\n"
+	}
+	switch ev.Level {
+	case "attention":
+		return ":large_yellow_circle: *pgwd* – Attention\n"
+	case "alert":
+		return ":large_orange_circle: *pgwd* – Alert\n"
+	case "danger":
+		return ":red_circle: *pgwd* – Danger\n"
 	default:
-		line += fmt.Sprintf(" (limit %s=%d)", ev.Threshold, ev.ThresholdValue)
+		return ":warning: *pgwd* – Threshold exceeded\n"
 	}
-	return line
+}
+
+func slackConnLine(ev Event) string {
+	if ev.Resolved {
+		return "• *Resolved*: " + resolvedText(ev)
+	}
+	if p := ev.PgBouncerPool; p != nil {
+		return fmt.Sprintf("• *PgBouncer pool* %s/%s: %s%s", p.Database, p.User, formatPgBouncerPool(*p), thresholdSuffix(ev.Threshold, ev.ThresholdValue))
+	}
+	return "• *Connections*: " + connectionsText(ev)
 }
 
 func slackColor(ev Event) string {
+	if ev.Resolved {
+		return "good" // green
+	}
 	if ev.Level != "" {
 		switch ev.Level {
 		case "attention":
@@ -94,7 +106,7 @@ func slackColor(ev Event) string {
 	switch ev.Threshold {
 	case "test":
 		return "good"
-	case "connect_failure", "too_many_clients":
+	case "connect_failure", "pgbouncer_connect_failure", "too_many_clients":
 		return "danger"
 	default:
 		return "warning"
@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hrodrig/pgwd/internal/postgres"
+)
+
+func TestSlackHeader_fields_in_order(t *testing.T) {
+	ev := Event{
+		Stats:          postgres.ConnectionStats{Total: 80, Active: 10, Idle: 70},
+		Threshold:      "application",
+		ThresholdValue: 50,
+		Message:        "Application billing-api idle connections 55 >= 50",
+		Level:          "alert",
+		Cluster:        "prod",
+		Database:       "myapp",
+		Application:    "billing-api",
+		Client:         "vm-1",
+	}
+	got := slackHeader(ev, "2026-03-13 10:00:00")
+	want := ":large_orange_circle: *pgwd* – Alert\n" +
+		"*Application billing-api idle connections 55 >= 50*\n" +
+		"• *Connections*: total=80 active=10 idle=70 (limit application=50)\n" +
+		"• *Cluster*: prod\n" +
+		"• *Database*: myapp\n" +
+		"• *Application*: billing-api\n" +
+		"• *Client*: vm-1\n" +
+		"• *Time*: 2026-03-13 10:00:00\n"
+	if got != want {
+		t.Errorf("slackHeader:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestSlackHeader_omits_empty_fields(t *testing.T) {
+	got := slackHeader(Event{Threshold: "test", Message: "Test"}, "now")
+	for _, field := range []string{"Cluster", "Database", "Role", "Application", "Top applications", "Client", "Namespace"} {
+		if strings.Contains(got, "*"+field+"*") {
+			t.Errorf("slackHeader: %s should be omitted when empty, got %q", field, got)
+		}
+	}
+}
+
+func TestSlackSessionsTable(t *testing.T) {
+	got := slackSessionsTable([]postgres.Session{
+		{PID: 4242, User: "app", Application: "billing-api", ClientAddr: "10.0.0.5", State: "idle", AgeSeconds: 700, BackendAgeSeconds: 700, Query: "SELECT `x`\n FROM t"},
+		{PID: 17, User: "postgres", State: "active", AgeSeconds: 3, BackendAgeSeconds: 90},
+	})
+	want := "• *Sessions*:\n```\n" +
+		"PID   USER      APPLICATION  CLIENT    STATE   AGE   BACKEND AGE  QUERY\n" +
+		"4242  app       billing-api  10.0.0.5  idle    700s  700s         SELECT 'x' FROM t\n" +
+		"17    postgres  (unnamed)    local     active  3s    90s          \n" +
+		"```\n"
+	if got != want {
+		t.Errorf("slackSessionsTable:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestSlackTitle(t *testing.T) {
+	tests := []struct {
+		ev   Event
+		want string
+	}{
+		{Event{Threshold: "connect_failure"}, ":warning: *pgwd* – Connection failure\n"},
+		{Event{Threshold: "pgbouncer_connect_failure", Level: "danger"}, ":warning: *pgwd* – Connection failure\n"},
+		{Event{Threshold: "too_many_clients"}, ":rotating_light: *pgwd* – URGENT: too many clients (DB saturated)\n"},
+		{Event{Threshold: "total", Level: "danger"}, ":red_circle: *pgwd* – Danger\n"},
+	}
+	for _, tt := range tests {
+		if got := slackTitle(tt.ev); got != tt.want {
+			t.Errorf("slackTitle(%s) = %q, want %q", tt.ev.Threshold, got, tt.want)
+		}
+	}
+}
+
+func TestSlackHeader_pgbouncer_connect_failure(t *testing.T) {
+	ev := Event{Threshold: "pgbouncer_connect_failure", Level: "danger", Message: "pgwd could not connect to the PgBouncer admin console."}
+	if got := slackHeader(ev, "now"); !strings.Contains(got, "(connection failed)") || strings.Contains(got, "limit") {
+		t.Errorf("slackHeader: want the connection failure text, got %q", got)
+	}
+	if got := slackColor(Event{Threshold: "pgbouncer_connect_failure"}); got != "danger" {
+		t.Errorf("slackColor = %s, want danger", got)
+	}
+}
+
+func TestSlackHeader_remediation(t *testing.T) {
+	got := slackHeader(Event{Threshold: "remediation", ThresholdValue: 600, Message: "Terminated pid 4242"}, "now")
+	if !strings.HasPrefix(got, ":hammer_and_wrench: *pgwd* – Remediation\n") {
+		t.Errorf("slackHeader: want remediation title, got %q", got)
+	}
+	if !strings.Contains(got, "(remediation after 600s)") {
+		t.Errorf("slackHeader: want remediation limit, got %q", got)
+	}
+}
+
+func TestSlackHeader_resolved(t *testing.T) {
+	ev := Event{Threshold: "total", ThresholdValue: 80, Level: "danger", Resolved: true, Duration: 12 * time.Minute, Peak: 95, Message: "Resolved: total back below 80"}
+	got := slackHeader(ev, "now")
+	if !strings.HasPrefix(got, ":large_green_circle: *pgwd* – Resolved\n") {
+		t.Errorf("slackHeader: want resolved title, got %q", got)
+	}
+	if !strings.Contains(got, "• *Resolved*: active for 12m0s, peak total=95 (limit 80)") {
+		t.Errorf("slackHeader: want duration and peak, got %q", got)
+	}
+	if c := slackColor(ev); c != "good" {
+		t.Errorf("slackColor(resolved) = %q, want good (green)", c)
+	}
+}
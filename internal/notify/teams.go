@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Teams sends events to Microsoft Teams as Adaptive Cards, via a Workflows ("Post to a channel when a webhook
+// request is received") or Incoming Webhook URL. The card carries the same content as the Slack message.
+type Teams struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+func teamsTitle(ev Event) string {
+	return teamsEmoji(ev) + " pgwd – " + eventTitle(ev)
+}
+
+func teamsEmoji(ev Event) string {
+	if ev.Resolved {
+		return "🟢"
+	}
+	switch ev.Threshold {
+	case "test":
+		return "✅"
+	case "too_many_clients":
+		return "🚨"
+	case "remediation":
+		return "🛠️"
+	case "connect_failure", "pgbouncer_connect_failure":
+		return "⚠️"
+	}
+	switch ev.Level {
+	case "attention":
+		return "🟡"
+	case "alert":
+		return "🟠"
+	case "danger":
+		return "🔴"
+	default:
+		return "⚠️"
+	}
+}
+
+// teamsColor maps the event to an Adaptive Card color: good (green) for resolved and test events, attention (red)
+// for danger, warning (orange) otherwise. The title emoji tells attention and alert apart.
+func teamsColor(ev Event) string {
+	if ev.Resolved || ev.Threshold == "test" {
+		return "good"
+	}
+	if eventLevel(ev) == "danger" {
+		return "attention"
+	}
+	return "warning"
+}
+
+// teamsCard returns the Adaptive Card of ev: a colored title, the message, the facts and the sessions table.
+func teamsCard(ev Event, ts string) map[string]any {
+	color := teamsColor(ev)
+	body := []map[string]any{
+		{
+			"type":  "Container",
+			"style": color,
+			"bleed": true,
+			"items": []map[string]any{
+				{"type": "TextBlock", "text": teamsTitle(ev), "weight": "Bolder", "size": "Medium", "color": color, "wrap": true},
+			},
+		},
+		{"type": "TextBlock", "text": ev.Message, "weight": "Bolder", "wrap": true},
+		{"type": "FactSet", "facts": eventFacts(ev, ts)},
+	}
+	if len(ev.Sessions) > 0 {
+		body = append(body,
+			map[string]any{"type": "TextBlock", "text": "Sessions", "weight": "Bolder"},
+			map[string]any{"type": "TextBlock", "text": strings.TrimRight(sessionsTable(ev.Sessions), "\n"), "fontType": "Monospace", "size": "Small", "wrap": true},
+		)
+	}
+	return map[string]any{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"msteams": map[string]any{"width": "Full"},
+		"body":    body,
+	}
+}
+
+// Send posts ev as an Adaptive Card.
+func (t *Teams) Send(ctx context.Context, ev Event) error {
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	ts := time.Now().Format("2006-01-02 15:04:05")
+	body := map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{
+			{"contentType": "application/vnd.microsoft.card.adaptive", "content": teamsCard(ev, ts)},
+		},
+	}
+	raw, _ := json.Marshal(body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.WebhookURL, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("teams webhook returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hrodrig/pgwd/internal/postgres"
+)
+
+func TestTeamsColor(t *testing.T) {
+	tests := []struct {
+		ev   Event
+		want string
+	}{
+		{Event{Threshold: "total", Level: "attention"}, "warning"},
+		{Event{Threshold: "total", Level: "alert"}, "warning"},
+		{Event{Threshold: "total", Level: "danger"}, "attention"},
+		{Event{Threshold: "connect_failure"}, "attention"},
+		{Event{Threshold: "total", Level: "danger", Resolved: true}, "good"},
+		{Event{Threshold: "test"}, "good"},
+	}
+	for _, tt := range tests {
+		if got := teamsColor(tt.ev); got != tt.want {
+			t.Errorf("teamsColor(%s/%s resolved=%v) = %s, want %s", tt.ev.Threshold, tt.ev.Level, tt.ev.Resolved, got, tt.want)
+		}
+	}
+}
+
+func TestTeamsEmoji(t *testing.T) {
+	tests := []struct {
+		ev   Event
+		want string
+	}{
+		{Event{Threshold: "connect_failure"}, "⚠️"},
+		{Event{Threshold: "pgbouncer_connect_failure", Level: "danger"}, "⚠️"},
+		{Event{Threshold: "too_many_clients"}, "🚨"},
+		{Event{Threshold: "total", Level: "danger"}, "🔴"},
+		{Event{Threshold: "pgbouncer_connect_failure", Resolved: true}, "🟢"},
+	}
+	for _, tt := range tests {
+		if got := teamsEmoji(tt.ev); got != tt.want {
+			t.Errorf("teamsEmoji(%s/%s resolved=%v) = %s, want %s", tt.ev.Threshold, tt.ev.Level, tt.ev.Resolved, got, tt.want)
+		}
+	}
+}
+
+func TestTeams_Send(t *testing.T) {
+	var got struct {
+		Type        string `json:"type"`
+		Attachments []struct {
+			ContentType string `json:"contentType"`
+			Content     struct {
+				Type string           `json:"type"`
+				Body []map[string]any `json:"body"`
+			} `json:"content"`
+		} `json:"attachments"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("body: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	ev := Event{Threshold: "total", Level: "danger", Message: "Total connections 96 >= 95", Sessions: []postgres.Session{{PID: 42, User: "app", State: "idle"}}}
+	if err := (&Teams{WebhookURL: srv.URL}).Send(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != "message" || len(got.Attachments) != 1 || got.Attachments[0].ContentType != "application/vnd.microsoft.card.adaptive" {
+		t.Fatalf("payload = %+v", got)
+	}
+	card := got.Attachments[0].Content
+	if card.Type != "AdaptiveCard" || len(card.Body) != 5 {
+		t.Fatalf("card = %+v, want title, message, facts and sessions", card)
+	}
+	if card.Body[0]["style"] != "attention" || card.Body[1]["text"] != ev.Message || card.Body[4]["fontType"] != "Monospace" {
+		t.Errorf("card body = %v", card.Body)
+	}
+}
+
+func TestTeams_Send_error_status(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Invalid webhook", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	if err := (&Teams{WebhookURL: srv.URL}).Send(context.Background(), Event{Threshold: "test"}); err == nil {
+		t.Error("Send() = nil, want an error for 400")
+	}
+}
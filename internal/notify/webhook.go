@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultWebhookTemplate is the webhook body when no template is set: the event as JSON (Go field names).
+const DefaultWebhookTemplate = "{{json .}}"
+
+// Webhook headers set when a secret is configured: the Unix time of the request and the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the secret, as "sha256=<hex>".
+const (
+	WebhookTimestampHeader = "X-Pgwd-Timestamp"
+	WebhookSignatureHeader = "X-Pgwd-Signature"
+)
+
+// webhookFuncs are the functions available to webhook templates besides the text/template builtins.
+var webhookFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"now":        time.Now,
+	"formatTime": func(layout string, t time.Time) string { return t.Format(layout) },
+	"level":      eventLevel,
+}
+
+// ParseWebhookTemplate parses a webhook body template (DefaultWebhookTemplate when s is empty). Templates get the
+// Event and the functions json, upper, lower, now, formatTime (layout first: {{now | formatTime "15:04"}}) and
+// level (the event level, derived from the threshold when empty).
+func ParseWebhookTemplate(s string) (*template.Template, error) {
+	if s == "" {
+		s = DefaultWebhookTemplate
+	}
+	return template.New("webhook").Funcs(webhookFuncs).Parse(s)
+}
+
+// ParseWebhookHeaders parses "Name=value,Name2=value2" into headers. The value is everything after the first "=",
+// so it may contain "=" but not ",".
+func ParseWebhookHeaders(s string) (map[string]string, error) {
+	h := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if name = strings.TrimSpace(name); !ok || name == "" || strings.ContainsAny(name, " :") {
+			return nil, fmt.Errorf("invalid header %q: want Name=value", part)
+		}
+		h[name] = strings.TrimSpace(value)
+	}
+	return h, nil
+}
+
+// Webhook sends events to any HTTP endpoint: the body is Body executed with the Event, sent with Method and
+// Headers. With Secret, requests are signed (WebhookSignatureHeader) so the receiver can verify they come from pgwd.
+type Webhook struct {
+	URL     string
+	Method  string // empty = POST
+	Headers map[string]string
+	Body    *template.Template // see ParseWebhookTemplate; nil = DefaultWebhookTemplate
+	Secret  string             // HMAC-SHA256 key; empty = unsigned
+	Client  *http.Client
+}
+
+// webhookSignature returns "sha256=<hex>" of the HMAC-SHA256 of "<timestamp>.<body>".
+func webhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *Webhook) body(ev Event) ([]byte, error) {
+	tmpl := w.Body
+	if tmpl == nil {
+		var err error
+		if tmpl, err = ParseWebhookTemplate(""); err != nil {
+			return nil, err
+		}
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, ev); err != nil {
+		return nil, fmt.Errorf("webhook template: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// Send posts (or Method) the rendered event to the webhook URL.
+func (w *Webhook) Send(ctx context.Context, ev Event) error {
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	method := w.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	raw, err := w.body(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, w.URL, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range w.Headers {
+		req.Header.Set(name, value)
+	}
+	if w.Secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(WebhookTimestampHeader, ts)
+		req.Header.Set(WebhookSignatureHeader, webhookSignature(w.Secret, ts, raw))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
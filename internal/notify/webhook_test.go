@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hrodrig/pgwd/internal/postgres"
+)
+
+// webhookRequest is what the stand-in receiver saw.
+type webhookRequest struct {
+	method string
+	header http.Header
+	body   string
+}
+
+func webhookStandIn(t *testing.T) (*httptest.Server, *webhookRequest) {
+	t.Helper()
+	got := &webhookRequest{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		*got = webhookRequest{r.Method, r.Header, string(raw)}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got
+}
+
+func TestWebhook_template(t *testing.T) {
+	srv, got := webhookStandIn(t)
+	tmpl, err := ParseWebhookTemplate(`{"text": {{json .Message}}, "level": "{{level . | upper}}", "total": {{.Stats.Total}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &Webhook{URL: srv.URL, Method: http.MethodPut, Headers: map[string]string{"Authorization": "Bearer t0k=="}, Body: tmpl}
+	ev := Event{Threshold: "too_many_clients", Message: `DB "app" saturated`, Stats: postgres.ConnectionStats{Total: 100}}
+	if err := w.Send(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"text": "DB \"app\" saturated", "level": "DANGER", "total": 100}`; got.body != want {
+		t.Errorf("body = %s, want %s", got.body, want)
+	}
+	if got.method != http.MethodPut || got.header.Get("Authorization") != "Bearer t0k==" || got.header.Get("Content-Type") != "application/json" {
+		t.Errorf("method %s, headers %v", got.method, got.header)
+	}
+	if got.header.Get(WebhookSignatureHeader) != "" {
+		t.Error("unsigned webhook should not send a signature")
+	}
+}
+
+func TestWebhook_default_body_is_event_json(t *testing.T) {
+	srv, got := webhookStandIn(t)
+	if err := (&Webhook{URL: srv.URL}).Send(context.Background(), Event{Threshold: "idle", Value: 7, Database: "app"}); err != nil {
+		t.Fatal(err)
+	}
+	var ev Event
+	if err := json.Unmarshal([]byte(got.body), &ev); err != nil || ev.Threshold != "idle" || ev.Value != 7 || ev.Database != "app" {
+		t.Errorf("body %s: %v", got.body, err)
+	}
+	if got.method != http.MethodPost {
+		t.Errorf("method = %s, want POST", got.method)
+	}
+}
+
+func TestWebhook_signature(t *testing.T) {
+	srv, got := webhookStandIn(t)
+	if err := (&Webhook{URL: srv.URL, Secret: "s3cret"}).Send(context.Background(), Event{Threshold: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	ts := got.header.Get(WebhookTimestampHeader)
+	if ts == "" || got.header.Get(WebhookSignatureHeader) != webhookSignature("s3cret", ts, []byte(got.body)) {
+		t.Errorf("headers %v do not sign the body", got.header)
+	}
+	// Known value: printf '1700000000.{}' | openssl dgst -sha256 -hmac s3cret
+	if sig := webhookSignature("s3cret", "1700000000", []byte("{}")); sig != "sha256=97926816e98fbb41ccb1673225ff29a2f35369099990e1b1561651e7bd097ebf" {
+		t.Errorf("signature = %s", sig)
+	}
+}
+
+func TestParseWebhookHeaders(t *testing.T) {
+	h, err := ParseWebhookHeaders("Authorization=Basic dXNlcjpwYXNz, X-Team=dba ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"Authorization": "Basic dXNlcjpwYXNz", "X-Team": "dba"}; !maps.Equal(h, want) {
+		t.Errorf("headers = %v, want %v", h, want)
+	}
+	for _, s := range []string{"Authorization", "=value", "X Team=1"} {
+		if _, err := ParseWebhookHeaders(s); err == nil {
+			t.Errorf("ParseWebhookHeaders(%q) should fail", s)
+		}
+	}
+}
+
+func TestParseWebhookTemplate_errors(t *testing.T) {
+	if _, err := ParseWebhookTemplate("{{.Message"); err == nil {
+		t.Error("unterminated action should fail")
+	}
+	if _, err := ParseWebhookTemplate("{{nosuchfunc .}}"); err == nil {
+		t.Error("unknown function should fail")
+	}
+}
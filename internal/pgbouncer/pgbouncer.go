@@ -0,0 +1,162 @@
+// Package pgbouncer reads pool and client statistics from the PgBouncer admin console
+// (SHOW POOLS, SHOW CLIENTS) for pgwd's PgBouncer checks.
+package pgbouncer
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// AdminDatabase is the name of PgBouncer's admin console database; it shows up as a pool of its own.
+const AdminDatabase = "pgbouncer"
+
+// Pool is one row of SHOW POOLS: a (database, user) pair with its client and server connection counts.
+type Pool struct {
+	Database       string
+	User           string
+	ClientActive   int // cl_active: clients linked to a server or idle with no queries waiting
+	ClientWaiting  int // cl_waiting: clients that sent queries but have no server connection yet
+	ServerActive   int // sv_active
+	ServerIdle     int // sv_idle
+	ServerUsed     int // sv_used
+	ServerTested   int // sv_tested
+	ServerLogin    int // sv_login
+	MaxWaitSeconds int // maxwait: how long the oldest waiting client has waited
+	Mode           string
+}
+
+// Clients returns the client connections of the pool (active plus waiting).
+func (p Pool) Clients() int {
+	return p.ClientActive + p.ClientWaiting
+}
+
+// Servers returns the server connections of the pool in any state.
+func (p Pool) Servers() int {
+	return p.ServerActive + p.ServerIdle + p.ServerUsed + p.ServerTested + p.ServerLogin
+}
+
+// Client is one row of SHOW CLIENTS.
+type Client struct {
+	User        string
+	Database    string
+	State       string // e.g. "active", "waiting"
+	Addr        string
+	Port        int
+	Application string // application_name (PgBouncer 1.18+; empty on older versions)
+	WaitSeconds int    // current waiting time
+}
+
+// Connect opens a connection to the PgBouncer admin console, e.g.
+// postgres://pgwd@localhost:6432/pgbouncer. The console only speaks the simple query protocol.
+func Connect(ctx context.Context, dsn string) (*pgx.Conn, error) {
+	cfg, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	cfg.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+	return pgx.ConnectConfig(ctx, cfg)
+}
+
+// Pools runs SHOW POOLS. Columns are read by name, so PgBouncer versions with extra columns work.
+func Pools(ctx context.Context, conn *pgx.Conn) ([]Pool, error) {
+	rows, err := show(ctx, conn, "SHOW POOLS")
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Pool, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, poolFromRow(r))
+	}
+	return out, nil
+}
+
+// Clients runs SHOW CLIENTS. Columns are read by name, as in Pools.
+func Clients(ctx context.Context, conn *pgx.Conn) ([]Client, error) {
+	rows, err := show(ctx, conn, "SHOW CLIENTS")
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Client, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, clientFromRow(r))
+	}
+	return out, nil
+}
+
+func poolFromRow(r map[string]any) Pool {
+	return Pool{
+		Database:       text(r["database"]),
+		User:           text(r["user"]),
+		ClientActive:   number(r["cl_active"]),
+		ClientWaiting:  number(r["cl_waiting"]),
+		ServerActive:   number(r["sv_active"]),
+		ServerIdle:     number(r["sv_idle"]),
+		ServerUsed:     number(r["sv_used"]),
+		ServerTested:   number(r["sv_tested"]),
+		ServerLogin:    number(r["sv_login"]),
+		MaxWaitSeconds: number(r["maxwait"]),
+		Mode:           text(r["pool_mode"]),
+	}
+}
+
+func clientFromRow(r map[string]any) Client {
+	return Client{
+		User:        text(r["user"]),
+		Database:    text(r["database"]),
+		State:       text(r["state"]),
+		Addr:        text(r["addr"]),
+		Port:        number(r["port"]),
+		Application: text(r["application_name"]),
+		WaitSeconds: number(r["wait"]),
+	}
+}
+
+// show runs an admin console command and returns each row keyed by column name.
+func show(ctx context.Context, conn *pgx.Conn, cmd string) ([]map[string]any, error) {
+	rows, err := conn.Query(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	fields := rows.FieldDescriptions()
+	var out []map[string]any
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, err
+		}
+		r := make(map[string]any, len(fields))
+		for i, f := range fields {
+			r[f.Name] = values[i]
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// text returns v as a string ("" for NULL).
+func text(v any) string {
+	if t, ok := v.(string); ok {
+		return t
+	}
+	return ""
+}
+
+// number returns v as an int; text values are parsed, anything else is 0.
+func number(v any) int {
+	switch t := v.(type) {
+	case int64:
+		return int(t)
+	case int32:
+		return int(t)
+	case int16:
+		return int(t)
+	case string:
+		n, _ := strconv.Atoi(t)
+		return n
+	default:
+		return 0
+	}
+}
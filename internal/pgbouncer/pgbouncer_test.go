@@ -0,0 +1,68 @@
+package pgbouncer
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestPoolFromRow(t *testing.T) {
+	p := poolFromRow(map[string]any{
+		"database": "app", "user": "billing", "cl_active": int64(40), "cl_waiting": int64(7),
+		"sv_active": int64(20), "sv_idle": int64(0), "sv_used": "3", "sv_tested": int64(0), "sv_login": int64(1),
+		"maxwait": int64(12), "maxwait_us": int64(345), "pool_mode": "transaction", "load_balance_hosts": nil,
+	})
+	want := Pool{
+		Database: "app", User: "billing", ClientActive: 40, ClientWaiting: 7,
+		ServerActive: 20, ServerUsed: 3, ServerLogin: 1, MaxWaitSeconds: 12, Mode: "transaction",
+	}
+	if p != want {
+		t.Errorf("poolFromRow = %+v, want %+v", p, want)
+	}
+	if p.Clients() != 47 || p.Servers() != 24 {
+		t.Errorf("Clients() = %d, Servers() = %d; want 47, 24", p.Clients(), p.Servers())
+	}
+}
+
+func TestClientFromRow(t *testing.T) {
+	c := clientFromRow(map[string]any{
+		"type": "C", "user": "billing", "database": "app", "state": "waiting", "addr": "10.0.0.5",
+		"port": int64(51234), "wait": int64(9), "application_name": "billing-api",
+	})
+	want := Client{User: "billing", Database: "app", State: "waiting", Addr: "10.0.0.5", Port: 51234, Application: "billing-api", WaitSeconds: 9}
+	if c != want {
+		t.Errorf("clientFromRow = %+v, want %+v", c, want)
+	}
+	if got := clientFromRow(map[string]any{"user": "old"}); got.Application != "" || got.Port != 0 {
+		t.Errorf("clientFromRow with missing columns = %+v", got)
+	}
+}
+
+// Integration test requires a running PgBouncer. Set PGWD_TEST_PGBOUNCER_URL
+// (e.g. postgres://pgbouncer@localhost:6432/pgbouncer?sslmode=disable) to run it.
+func TestPools_Integration(t *testing.T) {
+	dsn := os.Getenv("PGWD_TEST_PGBOUNCER_URL")
+	if dsn == "" {
+		t.Skip("PGWD_TEST_PGBOUNCER_URL not set (skip integration tests)")
+	}
+	ctx := context.Background()
+	conn, err := Connect(ctx, dsn)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer conn.Close(ctx)
+	pools, err := Pools(ctx, conn)
+	if err != nil {
+		t.Fatalf("Pools: %v", err)
+	}
+	found := false
+	for _, p := range pools {
+		found = found || p.Database == AdminDatabase
+	}
+	if !found {
+		t.Errorf("Pools: admin pool %q missing in %+v", AdminDatabase, pools)
+	}
+	if _, err := Clients(ctx, conn); err != nil {
+		t.Fatalf("Clients: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// BlockingStats describes lock waits in one database, based on pg_blocking_pids().
+type BlockingStats struct {
+	Blocked int // sessions waiting on a lock held by another session
+	// LongestWaitSeconds is the longest lock wait among blocked sessions: now() - pg_locks.waitstart
+	// (PostgreSQL 14+), or the age of the waiting query (now() - query_start) on older servers.
+	LongestWaitSeconds int
+	// RootBlocker is the session at the root of the largest blocking tree: it blocks others but
+	// is not waiting itself. AgeSeconds is its transaction age (now() - xact_start). Nil when
+	// nothing is blocked or only a deadlock cycle exists.
+	RootBlocker *Session
+	RootBlocked int // sessions waiting directly or indirectly behind RootBlocker
+}
+
+// Blocking returns blocked-session counts and the root blocker in the named database
+// (empty = current_database()). A root blocker that exits before it is looked up leaves RootBlocker nil.
+func Blocking(ctx context.Context, pool *pgxpool.Pool, database string) (BlockingStats, error) {
+	// pg_locks.waitstart is read through to_jsonb so the query also runs on servers without the column.
+	const q = `
+SELECT
+	pid,
+	pg_blocking_pids(pid),
+	coalesce(extract(epoch FROM now() - coalesce(
+		(SELECT min((to_jsonb(l) ->> 'waitstart')::timestamptz) FROM pg_locks l WHERE l.pid = a.pid AND NOT l.granted),
+		query_start)), 0)::int
+FROM pg_stat_activity a
+WHERE datname = coalesce(nullif($1, ''), current_database())
+  AND ` + CountedBackend + `
+  AND cardinality(pg_blocking_pids(pid)) > 0
+`
+	var st BlockingStats
+	rows, err := pool.Query(ctx, q, database)
+	if err != nil {
+		return st, err
+	}
+	defer rows.Close()
+	waits := make(map[int][]int)
+	for rows.Next() {
+		var pid, wait int
+		var blockers []int32
+		if err := rows.Scan(&pid, &blockers, &wait); err != nil {
+			return st, err
+		}
+		for _, b := range blockers {
+			waits[pid] = append(waits[pid], int(b))
+		}
+		st.Blocked++
+		st.LongestWaitSeconds = max(st.LongestWaitSeconds, wait)
+	}
+	if err := rows.Err(); err != nil {
+		return st, err
+	}
+	root, n := rootBlocker(waits)
+	if root == 0 {
+		return st, nil
+	}
+	s, err := sessionByPID(ctx, pool, root)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	st.RootBlocker, st.RootBlocked = s, n
+	return st, nil
+}
+
+// rootBlocker finds the root of the largest blocking tree in waits (waiting pid -> pids blocking
+// it): a pid that blocks others but is not waiting itself. Returns the root and the number of
+// distinct sessions waiting behind it, directly or indirectly; 0, 0 when there is no root (e.g.
+// only a deadlock cycle). Ties go to the lowest pid.
+func rootBlocker(waits map[int][]int) (root, blocked int) {
+	waiters := make(map[int][]int) // blocker -> pids waiting on it
+	for pid, blockers := range waits {
+		for _, b := range blockers {
+			waiters[b] = append(waiters[b], pid)
+		}
+	}
+	var roots []int
+	for b := range waiters {
+		if _, waiting := waits[b]; !waiting {
+			roots = append(roots, b)
+		}
+	}
+	sort.Ints(roots)
+	for _, r := range roots {
+		if n := countBehind(r, waiters); n > blocked {
+			root, blocked = r, n
+		}
+	}
+	return root, blocked
+}
+
+// countBehind returns the number of distinct pids reachable from pid in waiters.
+func countBehind(pid int, waiters map[int][]int) int {
+	seen := map[int]bool{pid: true}
+	queue := []int{pid}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, w := range waiters[p] {
+			if !seen[w] {
+				seen[w] = true
+				queue = append(queue, w)
+			}
+		}
+	}
+	return len(seen) - 1
+}
+
+// sessionByPID returns the session with the given pid, any database; AgeSeconds is its transaction
+// age (0 when not in a transaction).
+func sessionByPID(ctx context.Context, pool *pgxpool.Pool, pid int) (*Session, error) {
+	const q = `
+SELECT
+	pid,
+	coalesce(usename, ''),
+	coalesce(application_name, ''),
+	coalesce(host(client_addr), ''),
+	coalesce(state, ''),
+	coalesce(extract(epoch FROM now() - xact_start), 0)::int,
+	coalesce(extract(epoch FROM now() - backend_start), 0)::int,
+	left(coalesce(query, ''), $2)
+FROM pg_stat_activity
+WHERE pid = $1
+`
+	var s Session
+	err := pool.QueryRow(ctx, q, pid, MaxQueryLength).Scan(&s.PID, &s.User, &s.Application, &s.ClientAddr, &s.State, &s.AgeSeconds, &s.BackendAgeSeconds, &s.Query)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRootBlocker(t *testing.T) {
+	tests := []struct {
+		name        string
+		waits       map[int][]int
+		wantRoot    int
+		wantBlocked int
+	}{
+		{"none", map[int][]int{}, 0, 0},
+		{"single", map[int][]int{20: {10}}, 10, 1},
+		{"chain", map[int][]int{20: {10}, 30: {20}, 40: {30}}, 10, 3},
+		{"largest tree wins", map[int][]int{20: {10}, 31: {11}, 32: {11}}, 11, 2},
+		{"tie goes to lowest pid", map[int][]int{20: {12}, 21: {11}}, 11, 1},
+		{"multiple blockers counted once", map[int][]int{20: {10}, 30: {10, 20}}, 10, 2},
+		{"deadlock cycle has no root", map[int][]int{10: {20}, 20: {10}}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, blocked := rootBlocker(tt.waits)
+			if root != tt.wantRoot || blocked != tt.wantBlocked {
+				t.Errorf("rootBlocker() = %d, %d; want %d, %d", root, blocked, tt.wantRoot, tt.wantBlocked)
+			}
+		})
+	}
+}
+
+func TestBlocking_Integration(t *testing.T) {
+	ctx := context.Background()
+	dsn := testDSN(t)
+	pool, err := Pool(ctx, dsn)
+	if err != nil {
+		t.Fatalf("Pool: %v", err)
+	}
+	defer pool.Close()
+
+	st, err := Blocking(ctx, pool, "")
+	if err != nil {
+		t.Fatalf("Blocking: %v", err)
+	}
+	if st.Blocked < 0 || (st.RootBlocker == nil) != (st.RootBlocked == 0) {
+		t.Errorf("Blocking: inconsistent stats %+v", st)
+	}
+}
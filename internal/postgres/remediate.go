@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TerminateBackend ends session s (pg_terminate_backend) if it is still the backend that was listed, in the same
+// state: pid, backend_start, state and state_change are checked in the same statement that signals it, so a
+// session that committed or went idle since, or a new backend that reused the pid, is left alone. It returns
+// false when s is gone or has changed. The connecting role needs superuser or pg_signal_backend.
+func TerminateBackend(ctx context.Context, pool *pgxpool.Pool, s Session) (bool, error) {
+	return signalBackend(ctx, pool, "pg_terminate_backend", s)
+}
+
+// CancelBackend cancels the running query of session s (pg_cancel_backend); the connection stays open. Like
+// TerminateBackend, it only signals s while it is in the state it was listed in (the same query, for an active
+// session) and returns false otherwise.
+func CancelBackend(ctx context.Context, pool *pgxpool.Pool, s Session) (bool, error) {
+	return signalBackend(ctx, pool, "pg_cancel_backend", s)
+}
+
+// signalBackend calls fn (a fixed function name from this package) on s when it is unchanged.
+func signalBackend(ctx context.Context, pool *pgxpool.Pool, fn string, s Session) (bool, error) {
+	q := fmt.Sprintf(`
+SELECT coalesce((
+	SELECT %s(pid)
+	FROM pg_stat_activity
+	WHERE pid = $1 AND backend_start = $2 AND state = $3 AND state_change = $4
+), false)
+`, fn)
+	var ok bool
+	err := pool.QueryRow(ctx, q, s.PID, s.BackendStart, s.State, s.StateChange).Scan(&ok)
+	return ok, err
+}
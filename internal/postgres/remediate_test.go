@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTerminateBackend_Integration(t *testing.T) {
+	ctx := context.Background()
+	dsn := testDSN(t)
+	pool, err := Pool(ctx, dsn)
+	if err != nil {
+		t.Fatalf("Pool: %v", err)
+	}
+	defer pool.Close()
+	victim, err := Pool(ctx, dsn)
+	if err != nil {
+		t.Fatalf("Pool: %v", err)
+	}
+	defer victim.Close()
+
+	conn, err := victim.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	defer conn.Release()
+	var pid int
+	if err := conn.QueryRow(ctx, "SELECT pg_backend_pid()").Scan(&pid); err != nil {
+		t.Fatalf("pg_backend_pid: %v", err)
+	}
+	s := Session{PID: pid}
+	err = pool.QueryRow(ctx, "SELECT backend_start, state, state_change FROM pg_stat_activity WHERE pid = $1", pid).
+		Scan(&s.BackendStart, &s.State, &s.StateChange)
+	if err != nil {
+		t.Fatalf("pg_stat_activity: %v", err)
+	}
+
+	changed := s
+	changed.StateChange = s.StateChange.Add(-time.Second)
+	if ok, err := TerminateBackend(ctx, pool, changed); err != nil || ok {
+		t.Fatalf("TerminateBackend(changed session) = %v, %v; want false, nil", ok, err)
+	}
+	if ok, err := CancelBackend(ctx, pool, s); err != nil || !ok {
+		t.Fatalf("CancelBackend(%d) = %v, %v", pid, ok, err)
+	}
+	if ok, err := TerminateBackend(ctx, pool, s); err != nil || !ok {
+		t.Fatalf("TerminateBackend(%d) = %v, %v", pid, ok, err)
+	}
+	if ok, err := TerminateBackend(ctx, pool, Session{}); err != nil || ok {
+		t.Errorf("TerminateBackend(pid 0) = %v, %v; want false, nil", ok, err)
+	}
+}
@@ -2,6 +2,11 @@ package postgres
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -11,40 +16,352 @@ type ConnectionStats struct {
 	Total  int
 	Active int
 	Idle   int
+	// IdleInTransaction counts sessions in state "idle in transaction" (hold locks, block vacuum).
+	IdleInTransaction int
+	// IdleInTransactionAborted counts sessions in state "idle in transaction (aborted)".
+	IdleInTransactionAborted int
+	// Excluded counts backends left out of the other counts: background workers, autovacuum,
+	// WAL senders and other non-client backends, and pgwd's own connections (see CountedBackend).
+	Excluded int
 }
 
-// Stats returns connection counts (total, active, idle) from the database.
+// CountedBackend is the SQL condition for the sessions pgwd counts: client backends other than
+// pgwd's own connections, recognised by their application_name, which Pool makes unique to the
+// process (see ApplicationName). Every pg_stat_activity query in this package applies it.
+const CountedBackend = `(backend_type = 'client backend' AND application_name IS DISTINCT FROM current_setting('application_name'))`
+
+// AppName is the application_name pgwd uses on its connections when the URL does not set one.
+const AppName = "pgwd"
+
+// maxApplicationName is the longest application_name the server keeps (NAMEDATALEN - 1 bytes).
+const maxApplicationName = 63
+
+// instanceID tells this process's connections apart from other pgwd processes and from clients
+// that happen to use the same application_name.
+var instanceID = newInstanceID()
+
+func newInstanceID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ApplicationName returns the application_name of pgwd's connections: name (AppName when empty)
+// followed by this process's instance ID, e.g. "pgwd-3f2a9c1e". name is shortened so the ID is
+// never cut off by the server.
+func ApplicationName(name string) string {
+	if name == "" {
+		name = AppName
+	}
+	suffix := "-" + instanceID
+	if n := maxApplicationName - len(suffix); len(name) > n {
+		name = strings.ToValidUTF8(name[:n], "")
+	}
+	return name + suffix
+}
+
+// scanDest returns the Scan destinations for the per-state count columns, in the order the queries
+// select them: active, idle, idle in transaction, idle in transaction (aborted), total.
+func (s *ConnectionStats) scanDest() []any {
+	return []any{&s.Active, &s.Idle, &s.IdleInTransaction, &s.IdleInTransactionAborted, &s.Total}
+}
+
+// Stats returns connection counts (total, active, idle, idle in transaction) from the database.
+// Non-client backends and pgwd's own connections are only counted in Excluded.
 func Stats(ctx context.Context, pool *pgxpool.Pool) (ConnectionStats, error) {
 	const q = `
 SELECT
-	count(*) FILTER (WHERE state = 'active')   AS active,
-	count(*) FILTER (WHERE state = 'idle')     AS idle,
-	count(*)                                   AS total
-FROM pg_stat_activity
-WHERE datname = current_database()
+	count(*) FILTER (WHERE counted AND state = 'active')                        AS active,
+	count(*) FILTER (WHERE counted AND state = 'idle')                          AS idle,
+	count(*) FILTER (WHERE counted AND state = 'idle in transaction')           AS idle_in_transaction,
+	count(*) FILTER (WHERE counted AND state = 'idle in transaction (aborted)') AS idle_in_transaction_aborted,
+	count(*) FILTER (WHERE counted)                                             AS total,
+	count(*) FILTER (WHERE NOT counted)                                         AS excluded
+FROM (
+	SELECT state, ` + CountedBackend + ` AS counted
+	FROM pg_stat_activity
+	WHERE datname = current_database()
+) a
 `
 	var s ConnectionStats
-	err := pool.QueryRow(ctx, q).Scan(&s.Active, &s.Idle, &s.Total)
+	err := pool.QueryRow(ctx, q).Scan(append(s.scanDest(), &s.Excluded)...)
 	return s, err
 }
 
+// DatabaseConnectionStats holds connection counts for one database on the server.
+type DatabaseConnectionStats struct {
+	Database string
+	ConnectionStats
+}
+
+// DatabaseStats returns connection counts for every database on the server in a single query
+// (cluster-wide mode). Databases that do not accept connections (e.g. template0) are skipped;
+// databases with no connections are included with zero counts.
+func DatabaseStats(ctx context.Context, pool *pgxpool.Pool) ([]DatabaseConnectionStats, error) {
+	const q = `
+SELECT
+	d.datname,
+	count(a.pid) FILTER (WHERE a.counted AND a.state = 'active')                        AS active,
+	count(a.pid) FILTER (WHERE a.counted AND a.state = 'idle')                          AS idle,
+	count(a.pid) FILTER (WHERE a.counted AND a.state = 'idle in transaction')           AS idle_in_transaction,
+	count(a.pid) FILTER (WHERE a.counted AND a.state = 'idle in transaction (aborted)') AS idle_in_transaction_aborted,
+	count(a.pid) FILTER (WHERE a.counted)                                               AS total,
+	count(a.pid) FILTER (WHERE NOT a.counted)                                           AS excluded
+FROM pg_database d
+LEFT JOIN (
+	SELECT datid, pid, state, ` + CountedBackend + ` AS counted
+	FROM pg_stat_activity
+) a ON a.datid = d.oid
+WHERE d.datallowconn AND NOT d.datistemplate
+GROUP BY d.datname
+ORDER BY d.datname
+`
+	rows, err := pool.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []DatabaseConnectionStats
+	for rows.Next() {
+		var s DatabaseConnectionStats
+		if err := rows.Scan(append(append([]any{&s.Database}, s.scanDest()...), &s.Excluded)...); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// RoleConnectionStats holds connection counts for one role across all databases, with the
+// role's own connection limit (pg_roles.rolconnlimit).
+type RoleConnectionStats struct {
+	Role      string
+	ConnLimit int // rolconnlimit; -1 = no limit
+	ConnectionStats
+}
+
+// RoleStats returns connection counts per role (usename) across the whole server, busiest first.
+// Counts are server-wide because rolconnlimit applies to all databases. Only roles with at least
+// one connection are returned.
+func RoleStats(ctx context.Context, pool *pgxpool.Pool) ([]RoleConnectionStats, error) {
+	const q = `
+SELECT
+	r.rolname,
+	r.rolconnlimit,
+	count(*) FILTER (WHERE a.state = 'active')                        AS active,
+	count(*) FILTER (WHERE a.state = 'idle')                          AS idle,
+	count(*) FILTER (WHERE a.state = 'idle in transaction')           AS idle_in_transaction,
+	count(*) FILTER (WHERE a.state = 'idle in transaction (aborted)') AS idle_in_transaction_aborted,
+	count(*)                                                          AS total
+FROM pg_stat_activity a
+JOIN pg_roles r ON r.oid = a.usesysid
+WHERE ` + CountedBackend + `
+GROUP BY r.rolname, r.rolconnlimit
+ORDER BY total DESC, r.rolname
+`
+	rows, err := pool.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []RoleConnectionStats
+	for rows.Next() {
+		var s RoleConnectionStats
+		if err := rows.Scan(append([]any{&s.Role, &s.ConnLimit}, s.scanDest()...)...); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// ApplicationConnectionStats holds connection counts for one application_name.
+type ApplicationConnectionStats struct {
+	Application string // application_name; empty when the client did not set one
+	ConnectionStats
+}
+
+// ApplicationStats returns connection counts per application_name in the named database
+// (empty = current_database()), busiest first.
+func ApplicationStats(ctx context.Context, pool *pgxpool.Pool, database string) ([]ApplicationConnectionStats, error) {
+	const q = `
+SELECT
+	coalesce(application_name, '')                                  AS application,
+	count(*) FILTER (WHERE state = 'active')                        AS active,
+	count(*) FILTER (WHERE state = 'idle')                          AS idle,
+	count(*) FILTER (WHERE state = 'idle in transaction')           AS idle_in_transaction,
+	count(*) FILTER (WHERE state = 'idle in transaction (aborted)') AS idle_in_transaction_aborted,
+	count(*)                                                        AS total
+FROM pg_stat_activity
+WHERE datname = coalesce(nullif($1, ''), current_database())
+  AND ` + CountedBackend + `
+GROUP BY 1
+ORDER BY total DESC, 1
+`
+	rows, err := pool.Query(ctx, q, database)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ApplicationConnectionStats
+	for rows.Next() {
+		var s ApplicationConnectionStats
+		if err := rows.Scan(append([]any{&s.Application}, s.scanDest()...)...); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// IdleInTransactionAge returns how long (seconds, based on state_change) the oldest session in
+// "idle in transaction" or "idle in transaction (aborted)" has been idle in the named database
+// (empty = current_database()). Returns 0 when there is none.
+func IdleInTransactionAge(ctx context.Context, pool *pgxpool.Pool, database string) (int, error) {
+	const q = `
+SELECT coalesce(max(extract(epoch FROM now() - state_change)), 0)::int
+FROM pg_stat_activity
+WHERE datname = coalesce(nullif($1, ''), current_database())
+  AND ` + CountedBackend + `
+  AND state IN ('idle in transaction', 'idle in transaction (aborted)')
+`
+	var n int
+	err := pool.QueryRow(ctx, q, database).Scan(&n)
+	return n, err
+}
+
+// MaxQueryLength is the number of characters of query text kept in Session.Query.
+const MaxQueryLength = 200
+
+// Session is one backend from pg_stat_activity, as reported in alerts.
+type Session struct {
+	PID         int
+	User        string // usename
+	Application string // application_name
+	ClientAddr  string // client_addr; empty for Unix socket connections
+	State       string
+	AgeSeconds  int // age that made the session match (query, transaction or backend age, depending on the check)
+	// BackendAgeSeconds is how long the connection has been open (now() - backend_start).
+	BackendAgeSeconds int
+	Query             string // query text, truncated to MaxQueryLength
+	// BackendStart and StateChange identify the backend and its current state, so remediation only signals the
+	// session it listed (see TerminateBackend). Zero when pg_stat_activity hides them from pgwd's role.
+	BackendStart time.Time
+	StateChange  time.Time
+	// Privileged is true when the session's role is a superuser or has REPLICATION.
+	Privileged bool
+}
+
+// LongRunningQueries returns active sessions whose current query has been running longer than
+// minSeconds (based on query_start) in the named database (empty = current_database()), oldest
+// first and at most limit of them, plus the total number of matching sessions.
+func LongRunningQueries(ctx context.Context, pool *pgxpool.Pool, database string, minSeconds, limit int) ([]Session, int, error) {
+	return sessionsOlderThan(ctx, pool, database, "query_start", "state = 'active'", minSeconds, limit)
+}
+
+// LongTransactions returns sessions whose transaction has been open longer than minSeconds
+// (based on xact_start), oldest first and at most limit of them, plus the total number of
+// matching sessions. Database is as in LongRunningQueries.
+func LongTransactions(ctx context.Context, pool *pgxpool.Pool, database string, minSeconds, limit int) ([]Session, int, error) {
+	return sessionsOlderThan(ctx, pool, database, "xact_start", "xact_start IS NOT NULL", minSeconds, limit)
+}
+
+// OldestSessions returns the sessions whose connection has been open longer than minSeconds
+// (backend_start; 0 = all), oldest first and at most limit of them, plus the total number of
+// matching sessions. Used for stale and total/active snapshots. Database is as in LongRunningQueries.
+func OldestSessions(ctx context.Context, pool *pgxpool.Pool, database string, minSeconds, limit int) ([]Session, int, error) {
+	return sessionsOlderThan(ctx, pool, database, "backend_start", "true", minSeconds, limit)
+}
+
+// IdleSessions returns idle sessions, longest idle first (state_change), at most limit of them,
+// plus the total number of idle sessions. Database is as in LongRunningQueries.
+func IdleSessions(ctx context.Context, pool *pgxpool.Pool, database string, limit int) ([]Session, int, error) {
+	return sessionsOlderThan(ctx, pool, database, "state_change", "state = 'idle'", 0, limit)
+}
+
+// IdleInTransactionSessions returns sessions idle in transaction (including aborted) for longer than
+// minSeconds (state_change; 0 = all), longest idle first, at most limit of them, plus their total.
+// Database is as in LongRunningQueries.
+func IdleInTransactionSessions(ctx context.Context, pool *pgxpool.Pool, database string, minSeconds, limit int) ([]Session, int, error) {
+	return sessionsOlderThan(ctx, pool, database, "state_change", "state IN ('idle in transaction', 'idle in transaction (aborted)')", minSeconds, limit)
+}
+
+// sessionsOlderThan lists sessions where now() - column > minSeconds, the strict comparison of the
+// "(> Ns)" alert messages and of StaleCount. column and cond are fixed SQL fragments from this
+// package, never user input.
+func sessionsOlderThan(ctx context.Context, pool *pgxpool.Pool, database, column, cond string, minSeconds, limit int) ([]Session, int, error) {
+	q := fmt.Sprintf(`
+SELECT
+	pid,
+	coalesce(usename, ''),
+	coalesce(application_name, ''),
+	coalesce(host(client_addr), ''),
+	coalesce(state, ''),
+	extract(epoch FROM now() - %[1]s)::int AS age,
+	extract(epoch FROM now() - backend_start)::int,
+	left(coalesce(query, ''), $4),
+	coalesce(backend_start, 'epoch'),
+	coalesce(state_change, 'epoch'),
+	coalesce((SELECT rolsuper OR rolreplication FROM pg_roles WHERE oid = usesysid), false),
+	count(*) OVER ()
+FROM pg_stat_activity
+WHERE datname = coalesce(nullif($1, ''), current_database())
+  AND %[3]s
+  AND %[2]s
+  AND (now() - %[1]s) > make_interval(secs => $2)
+ORDER BY %[1]s
+LIMIT $3
+`, column, cond, CountedBackend)
+	rows, err := pool.Query(ctx, q, database, minSeconds, limit, MaxQueryLength)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var out []Session
+	total := 0
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.PID, &s.User, &s.Application, &s.ClientAddr, &s.State, &s.AgeSeconds, &s.BackendAgeSeconds, &s.Query,
+			&s.BackendStart, &s.StateChange, &s.Privileged, &total); err != nil {
+			return nil, 0, err
+		}
+		out = append(out, s)
+	}
+	return out, total, rows.Err()
+}
+
 // StaleCount returns the number of connections that have been open longer than maxAgeSeconds
 // (based on backend_start). Use this to detect connections that stay open and never close.
 func StaleCount(ctx context.Context, pool *pgxpool.Pool, maxAgeSeconds int) (int, error) {
+	return StaleCountDatabase(ctx, pool, "", maxAgeSeconds)
+}
+
+// StaleCountDatabase is like StaleCount for the named database. Empty database means the
+// database of the connection (current_database()).
+func StaleCountDatabase(ctx context.Context, pool *pgxpool.Pool, database string, maxAgeSeconds int) (int, error) {
 	const q = `
 SELECT count(*)
 FROM pg_stat_activity
-WHERE datname = current_database()
-  AND (now() - backend_start) > (make_interval(secs => $1))
+WHERE datname = coalesce(nullif($1, ''), current_database())
+  AND ` + CountedBackend + `
+  AND (now() - backend_start) > (make_interval(secs => $2))
 `
 	var n int
-	err := pool.QueryRow(ctx, q, maxAgeSeconds).Scan(&n)
+	err := pool.QueryRow(ctx, q, database, maxAgeSeconds).Scan(&n)
 	return n, err
 }
 
-// Pool creates a connection pool for the given DSN.
+// Pool creates a connection pool for the given DSN. Connections use the application_name of the
+// DSN (AppName when it sets none) made unique to the process, so the counts leave out pgwd's own
+// sessions and nobody else's (CountedBackend).
 func Pool(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
-	return pgxpool.New(ctx, dsn)
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	params := cfg.ConnConfig.RuntimeParams
+	params["application_name"] = ApplicationName(params["application_name"])
+	return pgxpool.NewWithConfig(ctx, cfg)
 }
 
 // MaxConnections returns the server's max_connections setting.
@@ -53,3 +370,15 @@ func MaxConnections(ctx context.Context, pool *pgxpool.Pool) (int, error) {
 	err := pool.QueryRow(ctx, "SELECT current_setting('max_connections')::int").Scan(&n)
 	return n, err
 }
+
+// ReservedConnections returns superuser_reserved_connections and reserved_connections (PostgreSQL 16+;
+// 0 on older servers). Ordinary roles can use at most max_connections minus both.
+func ReservedConnections(ctx context.Context, pool *pgxpool.Pool) (superuser, reserved int, err error) {
+	const q = `
+SELECT
+	current_setting('superuser_reserved_connections')::int,
+	coalesce(nullif(current_setting('reserved_connections', true), ''), '0')::int
+`
+	err = pool.QueryRow(ctx, q).Scan(&superuser, &reserved)
+	return superuser, reserved, err
+}
@@ -3,7 +3,9 @@ package postgres
 import (
 	"context"
 	"os"
+	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 // Integration tests require a running PostgreSQL. Set PGWD_TEST_DB_URL
@@ -54,6 +56,38 @@ func TestStats_Integration(t *testing.T) {
 	}
 }
 
+func TestStats_Integration_excludes_own_connections(t *testing.T) {
+	ctx := context.Background()
+	dsn := testDSN(t)
+	pool, err := Pool(ctx, dsn)
+	if err != nil {
+		t.Fatalf("Pool: %v", err)
+	}
+	defer pool.Close()
+
+	stats, err := Stats(ctx, pool)
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	// The connection running the query has this process's application_name (see ApplicationName).
+	if stats.Excluded < 1 {
+		t.Errorf("Stats: expected pgwd's own connection in Excluded, got %+v", stats)
+	}
+}
+
+func TestApplicationName(t *testing.T) {
+	if got := ApplicationName(""); got != "pgwd-"+instanceID || len(instanceID) != 8 {
+		t.Errorf(`ApplicationName("") = %q, want pgwd-<8 hex digits>`, got)
+	}
+	if got := ApplicationName("billing-watch"); got != "billing-watch-"+instanceID {
+		t.Errorf("ApplicationName(billing-watch) = %q", got)
+	}
+	long := ApplicationName(strings.Repeat("é", 40))
+	if len(long) > maxApplicationName || !strings.HasSuffix(long, "-"+instanceID) || !utf8.ValidString(long) {
+		t.Errorf("ApplicationName(long) = %q (%d bytes), want <= %d bytes ending in the instance ID", long, len(long), maxApplicationName)
+	}
+}
+
 func TestMaxConnections_Integration(t *testing.T) {
 	ctx := context.Background()
 	dsn := testDSN(t)
@@ -90,3 +124,162 @@ func TestStaleCount_Integration(t *testing.T) {
 		t.Errorf("StaleCount: expected non-negative, got %d", n)
 	}
 }
+
+func TestDatabaseStats_Integration(t *testing.T) {
+	ctx := context.Background()
+	dsn := testDSN(t)
+	pool, err := Pool(ctx, dsn)
+	if err != nil {
+		t.Fatalf("Pool: %v", err)
+	}
+	defer pool.Close()
+
+	dbs, err := DatabaseStats(ctx, pool)
+	if err != nil {
+		t.Fatalf("DatabaseStats: %v", err)
+	}
+	if len(dbs) == 0 {
+		t.Fatal("DatabaseStats: expected at least the current database")
+	}
+	for _, d := range dbs {
+		if d.Database == "" {
+			t.Error("DatabaseStats: empty database name")
+		}
+		if d.Total < d.Active+d.Idle {
+			t.Errorf("DatabaseStats %s: total (%d) should be >= active+idle (%d+%d)", d.Database, d.Total, d.Active, d.Idle)
+		}
+	}
+}
+
+func TestRoleStats_Integration(t *testing.T) {
+	ctx := context.Background()
+	dsn := testDSN(t)
+	pool, err := Pool(ctx, dsn)
+	if err != nil {
+		t.Fatalf("Pool: %v", err)
+	}
+	defer pool.Close()
+
+	roles, err := RoleStats(ctx, pool)
+	if err != nil {
+		t.Fatalf("RoleStats: %v", err)
+	}
+	if len(roles) == 0 {
+		t.Fatal("RoleStats: expected at least the role of this connection")
+	}
+	for _, r := range roles {
+		if r.Role == "" || r.Total < 1 {
+			t.Errorf("RoleStats: unexpected row %+v", r)
+		}
+	}
+}
+
+func TestApplicationStats_Integration(t *testing.T) {
+	ctx := context.Background()
+	dsn := testDSN(t)
+	pool, err := Pool(ctx, dsn)
+	if err != nil {
+		t.Fatalf("Pool: %v", err)
+	}
+	defer pool.Close()
+
+	apps, err := ApplicationStats(ctx, pool, "")
+	if err != nil {
+		t.Fatalf("ApplicationStats: %v", err)
+	}
+	if len(apps) == 0 {
+		t.Fatal("ApplicationStats: expected at least this connection")
+	}
+	for i := 1; i < len(apps); i++ {
+		if apps[i].Total > apps[i-1].Total {
+			t.Errorf("ApplicationStats: not sorted busiest first: %+v", apps)
+		}
+	}
+}
+
+func TestIdleInTransactionAge_Integration(t *testing.T) {
+	ctx := context.Background()
+	dsn := testDSN(t)
+	pool, err := Pool(ctx, dsn)
+	if err != nil {
+		t.Fatalf("Pool: %v", err)
+	}
+	defer pool.Close()
+
+	n, err := IdleInTransactionAge(ctx, pool, "")
+	if err != nil {
+		t.Fatalf("IdleInTransactionAge: %v", err)
+	}
+	if n < 0 {
+		t.Errorf("IdleInTransactionAge: expected non-negative, got %d", n)
+	}
+}
+
+func TestLongRunningQueries_Integration(t *testing.T) {
+	ctx := context.Background()
+	dsn := testDSN(t)
+	pool, err := Pool(ctx, dsn)
+	if err != nil {
+		t.Fatalf("Pool: %v", err)
+	}
+	defer pool.Close()
+
+	// Queries running longer than 1 year: normally none
+	sessions, n, err := LongRunningQueries(ctx, pool, "", 365*24*3600, 5)
+	if err != nil {
+		t.Fatalf("LongRunningQueries: %v", err)
+	}
+	if n != len(sessions) || n != 0 {
+		t.Errorf("LongRunningQueries: expected none, got n=%d sessions=%v", n, sessions)
+	}
+	if _, _, err := LongTransactions(ctx, pool, "", 365*24*3600, 5); err != nil {
+		t.Fatalf("LongTransactions: %v", err)
+	}
+}
+
+func TestReservedConnections_Integration(t *testing.T) {
+	ctx := context.Background()
+	dsn := testDSN(t)
+	pool, err := Pool(ctx, dsn)
+	if err != nil {
+		t.Fatalf("Pool: %v", err)
+	}
+	defer pool.Close()
+
+	superuser, reserved, err := ReservedConnections(ctx, pool)
+	if err != nil {
+		t.Fatalf("ReservedConnections: %v", err)
+	}
+	if superuser < 0 || reserved < 0 {
+		t.Errorf("ReservedConnections: expected non-negative, got superuser=%d reserved=%d", superuser, reserved)
+	}
+}
+
+func TestOldestSessions_Integration(t *testing.T) {
+	ctx := context.Background()
+	dsn := testDSN(t)
+	pool, err := Pool(ctx, dsn)
+	if err != nil {
+		t.Fatalf("Pool: %v", err)
+	}
+	defer pool.Close()
+
+	sessions, n, err := OldestSessions(ctx, pool, "", 0, 3)
+	if err != nil {
+		t.Fatalf("OldestSessions: %v", err)
+	}
+	if len(sessions) > 3 || n < len(sessions) {
+		t.Errorf("OldestSessions: got %d sessions, total %d (limit 3)", len(sessions), n)
+	}
+	for i := 1; i < len(sessions); i++ {
+		if sessions[i].BackendAgeSeconds > sessions[i-1].BackendAgeSeconds {
+			t.Errorf("OldestSessions: not sorted oldest first: %+v", sessions)
+		}
+	}
+	if _, _, err := IdleSessions(ctx, pool, "", 3); err != nil {
+		t.Fatalf("IdleSessions: %v", err)
+	}
+	if _, _, err := IdleInTransactionSessions(ctx, pool, "", 0, 3); err != nil {
+		t.Fatalf("IdleInTransactionSessions: %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package silence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression: minute, hour, day of month, month and day of week, as in crontab(5).
+// Fields take *, numbers, ranges (1-5), steps (*/15, 0-30/10), lists (1,15) and three-letter month and day names;
+// the macros @hourly, @daily, @weekly, @monthly and @yearly are accepted too. Like cron, when both day fields
+// are restricted a day matches either of them.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64 // bit n set = value n matches
+	domAny, dowAny                bool
+}
+
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // names[i] is value min+i
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{"day of week", 0, 7, []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat", "sun"}},
+}
+
+// ParseSchedule parses a five-field cron expression such as "0 2 * * sun" (02:00 every Sunday).
+func ParseSchedule(expr string) (*Schedule, error) {
+	if m, ok := cronMacros[strings.ToLower(strings.TrimSpace(expr))]; ok {
+		expr = m
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q: want 5 fields (minute hour day-of-month month day-of-week), got %d", expr, len(parts))
+	}
+	var bits [5]uint64
+	for i, p := range parts {
+		b, err := cronFields[i].parse(p)
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+		}
+		bits[i] = b
+	}
+	if bits[4]&(1<<7) != 0 { // 7 is Sunday too
+		bits[4] |= 1
+	}
+	return &Schedule{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domAny: strings.HasPrefix(parts[2], "*"), dowAny: strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+func (f cronField) parse(s string) (uint64, error) {
+	var bits uint64
+	for item := range strings.SplitSeq(s, ",") {
+		lo, hi, step := f.min, f.max, 1
+		rng := item
+		if r, st, ok := strings.Cut(item, "/"); ok {
+			n, err := strconv.Atoi(st)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s: invalid step %q", f.name, st)
+			}
+			rng, step = r, n
+		}
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = f.value(b); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				hi = f.max // "5/15" means from 5 to the end
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("%s: invalid range %q", f.name, rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	for i, n := range f.names {
+		if strings.EqualFold(s, n) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s: %q is not between %d and %d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Matches reports whether the schedule fires in the minute of t (in t's location).
+func (s *Schedule) Matches(t time.Time) bool {
+	if s.minute&(1<<t.Minute()) == 0 || s.hour&(1<<t.Hour()) == 0 || s.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Within reports whether t falls in a window of length d that starts when the schedule fires, i.e. the schedule
+// fired at some minute f with f <= t < f+d.
+func (s *Schedule) Within(t time.Time, d time.Duration) bool {
+	for f := t.Truncate(time.Minute); t.Sub(f) < d; f = f.Add(-time.Minute) {
+		if s.Matches(f) {
+			return true
+		}
+	}
+	return false
+}
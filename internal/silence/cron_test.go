@@ -0,0 +1,69 @@
+package silence
+
+import (
+	"testing"
+	"time"
+)
+
+func at(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestSchedule_Matches(t *testing.T) {
+	tests := []struct {
+		expr string
+		t    string
+		want bool
+	}{
+		{"0 2 * * sun", "2026-03-01 02:00", true}, // Sunday
+		{"0 2 * * sun", "2026-03-02 02:00", false},
+		{"0 2 * * 7", "2026-03-01 02:00", true},
+		{"*/15 * * * *", "2026-03-02 10:45", true},
+		{"*/15 * * * *", "2026-03-02 10:46", false},
+		{"30 9-17/4 * * mon-fri", "2026-03-02 13:30", true},
+		{"30 9-17/4 * * mon-fri", "2026-03-02 11:30", false},
+		{"0 0 1 jan *", "2026-01-01 00:00", true},
+		{"@monthly", "2026-02-01 00:00", true},
+		{"0 0 1,15 * fri", "2026-03-06 00:00", true}, // both day fields restricted: Friday or the 1st/15th
+		{"0 0 1,15 * fri", "2026-03-15 00:00", true},
+		{"0 0 1,15 * fri", "2026-03-16 00:00", false},
+		{"0 0 */2 * mon", "2026-03-09 00:00", true}, // */2 counts as unrestricted: odd day and Monday
+		{"0 0 */2 * mon", "2026-03-02 00:00", false},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+		if got := s.Matches(at(tt.t)); got != tt.want {
+			t.Errorf("%q at %s = %v, want %v", tt.expr, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestParseSchedule_errors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "x * * * *"} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("%q: want an error", expr)
+		}
+	}
+}
+
+func TestSchedule_Within(t *testing.T) {
+	s, _ := ParseSchedule("0 2 * * sun")
+	for tm, want := range map[string]bool{
+		"2026-03-01 01:59": false,
+		"2026-03-01 02:00": true,
+		"2026-03-01 03:59": true,
+		"2026-03-01 04:00": false,
+		"2026-03-02 02:30": false,
+	} {
+		if got := s.Within(at(tm), 2*time.Hour); got != want {
+			t.Errorf("Within(%s, 2h) = %v, want %v", tm, got, want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Package silence mutes notifications during maintenance: a Silence matches events by target, database, threshold
+// and level and is active between its start and end, or, with a cron schedule, in recurring windows. Silences are
+// kept in a local JSON file (File) managed with `pgwd silence add|list|expire`.
+package silence
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hrodrig/pgwd/internal/lockedfile"
+	"github.com/hrodrig/pgwd/internal/notify"
+)
+
+// LabelNames are the event labels a Matcher can match.
+var LabelNames = []string{"target", "database", "threshold", "level"}
+
+// Labels returns the labels of ev for matching: target is the target name (empty in single-database mode).
+func Labels(target string, ev notify.Event) map[string]string {
+	return map[string]string{"target": target, "database": ev.Database, "threshold": ev.Threshold, "level": ev.Level}
+}
+
+// Matcher matches one label: equal to Value, or, when Regex is set, fully matching the regular expression Value.
+type Matcher struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Regex bool   `json:"regex,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// ParseMatcher parses "name=value" or "name=~regex", e.g. "database=app" or "threshold=~idle.*".
+func ParseMatcher(s string) (Matcher, error) {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return Matcher{}, fmt.Errorf("matcher %q: want name=value or name=~regex", s)
+	}
+	m := Matcher{Name: strings.TrimSpace(name), Value: value}
+	if v, ok := strings.CutPrefix(value, "~"); ok {
+		m.Value, m.Regex = v, true
+	}
+	return m, m.compile()
+}
+
+func (m *Matcher) compile() error {
+	if !slices.Contains(LabelNames, m.Name) {
+		return fmt.Errorf("matcher %s: unknown label %q (want one of %s)", m, m.Name, strings.Join(LabelNames, ", "))
+	}
+	if !m.Regex {
+		return nil
+	}
+	re, err := regexp.Compile("^(?:" + m.Value + ")$")
+	if err != nil {
+		return fmt.Errorf("matcher %s: %w", m, err)
+	}
+	m.re = re
+	return nil
+}
+
+func (m Matcher) String() string {
+	if m.Regex {
+		return m.Name + "=~" + m.Value
+	}
+	return m.Name + "=" + m.Value
+}
+
+func (m Matcher) matches(labels map[string]string) bool {
+	if m.re != nil {
+		return m.re.MatchString(labels[m.Name])
+	}
+	return labels[m.Name] == m.Value
+}
+
+// Silence mutes the events matching all its Matchers while it is active: from StartsAt until EndsAt (zero = no
+// end). With a Schedule it is only active for Duration after each time the cron schedule fires, in local time
+// (e.g. "0 2 * * sun" and 2h: Sundays 02:00-04:00).
+type Silence struct {
+	ID        string    `json:"id"`
+	Matchers  []Matcher `json:"matchers"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at,omitzero"`
+	Schedule  string    `json:"schedule,omitempty"`
+	Duration  string    `json:"duration,omitempty"` // window length for Schedule, e.g. "2h"
+	Comment   string    `json:"comment"`
+	CreatedAt time.Time `json:"created_at"`
+
+	schedule *Schedule
+	duration time.Duration
+}
+
+// Validate checks the silence and prepares its matchers and schedule.
+func (s *Silence) Validate() error {
+	if len(s.Matchers) == 0 {
+		return errors.New("at least one matcher is required")
+	}
+	for i := range s.Matchers {
+		if err := s.Matchers[i].compile(); err != nil {
+			return err
+		}
+	}
+	if s.Comment == "" {
+		return errors.New("a comment is required")
+	}
+	if !s.EndsAt.IsZero() && s.EndsAt.Before(s.StartsAt) {
+		return errors.New("end must not be before start")
+	}
+	if s.Schedule == "" {
+		if s.EndsAt.IsZero() {
+			return errors.New("an end is required (only recurring silences may have none)")
+		}
+		return nil
+	}
+	sched, err := ParseSchedule(s.Schedule)
+	if err != nil {
+		return err
+	}
+	d, err := time.ParseDuration(s.Duration)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("recurring silence: invalid duration %q (e.g. 2h)", s.Duration)
+	}
+	s.schedule, s.duration = sched, d
+	return nil
+}
+
+// Active reports whether the silence mutes events at now.
+func (s *Silence) Active(now time.Time) bool {
+	if now.Before(s.StartsAt) || s.Expired(now) {
+		return false
+	}
+	return s.schedule == nil || s.schedule.Within(now.Local(), s.duration)
+}
+
+// Expired reports whether the silence has ended for good.
+func (s *Silence) Expired(now time.Time) bool {
+	return !s.EndsAt.IsZero() && !now.Before(s.EndsAt)
+}
+
+// Matches reports whether all matchers match labels.
+func (s *Silence) Matches(labels map[string]string) bool {
+	for _, m := range s.Matchers {
+		if !m.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Find returns the first silence that is active at now and matches labels, or nil.
+func Find(silences []Silence, labels map[string]string, now time.Time) *Silence {
+	for i := range silences {
+		if s := &silences[i]; s.Active(now) && s.Matches(labels) {
+			return s
+		}
+	}
+	return nil
+}
+
+// NewID returns a random silence ID (8 hex digits).
+func NewID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// File is the silence file (-silence-file). Readers need no lock: Update replaces the file atomically.
+type File struct {
+	Path string
+}
+
+type fileData struct {
+	Silences []Silence `json:"silences"`
+}
+
+// Load returns the silences in the file, none when it does not exist.
+func (f *File) Load() ([]Silence, error) {
+	raw, err := os.ReadFile(f.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var d fileData
+	if err := json.Unmarshal(raw, &d); err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Path, err)
+	}
+	for i := range d.Silences {
+		if err := d.Silences[i].Validate(); err != nil {
+			return nil, fmt.Errorf("%s: silence %s: %w", f.Path, d.Silences[i].ID, err)
+		}
+	}
+	return d.Silences, nil
+}
+
+// Update loads the silences under the file lock, passes them to fn and writes back what fn returns. When fn
+// returns an error the file is left unchanged.
+func (f *File) Update(fn func(silences []Silence) ([]Silence, error)) error {
+	return lockedfile.Update(f.Path, func() error {
+		silences, err := f.Load()
+		if err != nil {
+			return err
+		}
+		if silences, err = fn(silences); err != nil {
+			return err
+		}
+		raw, err := json.MarshalIndent(fileData{Silences: silences}, "", "  ")
+		if err != nil {
+			return err
+		}
+		return lockedfile.WriteAtomic(f.Path, append(raw, '\n'))
+	})
+}
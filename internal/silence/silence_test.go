@@ -0,0 +1,119 @@
+package silence
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hrodrig/pgwd/internal/notify"
+)
+
+func matchers(t *testing.T, specs ...string) []Matcher {
+	t.Helper()
+	var ms []Matcher
+	for _, s := range specs {
+		m, err := ParseMatcher(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms = append(ms, m)
+	}
+	return ms
+}
+
+func TestParseMatcher(t *testing.T) {
+	m, err := ParseMatcher("threshold=~idle.*")
+	if err != nil || m.Name != "threshold" || m.Value != "idle.*" || !m.Regex {
+		t.Fatalf("got %+v, %v", m, err)
+	}
+	if m.String() != "threshold=~idle.*" {
+		t.Errorf("String() = %q", m.String())
+	}
+	for _, s := range []string{"database", "role=app", "level=~("} {
+		if _, err := ParseMatcher(s); err == nil {
+			t.Errorf("%q: want an error", s)
+		}
+	}
+}
+
+func TestSilence_Matches(t *testing.T) {
+	s := Silence{Matchers: matchers(t, "database=app", "threshold=~idle.*")}
+	labels := Labels("prod", notify.Event{Database: "app", Threshold: "idle_in_transaction", Level: "alert"})
+	if !s.Matches(labels) {
+		t.Error("want a match")
+	}
+	labels["database"] = "billing"
+	if s.Matches(labels) {
+		t.Error("all matchers must match")
+	}
+	anchored := Silence{Matchers: matchers(t, "threshold=~idle")}
+	if anchored.Matches(Labels("", notify.Event{Threshold: "idle_in_transaction"})) {
+		t.Error("regex matchers should match the whole value")
+	}
+}
+
+func TestSilence_Active(t *testing.T) {
+	start := at("2026-03-01 00:00")
+	once := Silence{Matchers: matchers(t, "target=prod"), StartsAt: start, EndsAt: start.Add(time.Hour), Comment: "upgrade"}
+	if err := once.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if once.Active(start.Add(-time.Minute)) || !once.Active(start) || once.Active(start.Add(time.Hour)) {
+		t.Error("one-time silence should be active from start until end")
+	}
+	weekly := Silence{Matchers: matchers(t, "target=prod"), StartsAt: start, Schedule: "0 2 * * sun", Duration: "2h", Comment: "vacuum"}
+	if err := weekly.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	sunday := time.Date(2026, 3, 1, 3, 0, 0, 0, time.Local)
+	if !weekly.Active(sunday) || weekly.Active(sunday.Add(24*time.Hour)) {
+		t.Error("recurring silence should be active only in its windows")
+	}
+}
+
+func TestSilence_Validate(t *testing.T) {
+	start := at("2026-03-01 00:00")
+	ms := matchers(t, "database=app")
+	tests := []struct {
+		name string
+		s    Silence
+	}{
+		{"no matchers", Silence{StartsAt: start, EndsAt: start.Add(time.Hour), Comment: "c"}},
+		{"no comment", Silence{Matchers: ms, StartsAt: start, EndsAt: start.Add(time.Hour)}},
+		{"no end", Silence{Matchers: ms, StartsAt: start, Comment: "c"}},
+		{"end before start", Silence{Matchers: ms, StartsAt: start, EndsAt: start.Add(-time.Hour), Comment: "c"}},
+		{"bad schedule", Silence{Matchers: ms, StartsAt: start, Schedule: "0 2 * *", Duration: "2h", Comment: "c"}},
+		{"no duration", Silence{Matchers: ms, StartsAt: start, Schedule: "@daily", Comment: "c"}},
+	}
+	for _, tt := range tests {
+		if err := tt.s.Validate(); err == nil {
+			t.Errorf("%s: want an error", tt.name)
+		}
+	}
+}
+
+func TestFile_Update(t *testing.T) {
+	f := &File{Path: filepath.Join(t.TempDir(), "silences.json")}
+	if s, err := f.Load(); err != nil || s != nil {
+		t.Fatalf("missing file: %v, %v", s, err)
+	}
+	now := at("2026-03-01 00:00")
+	add := Silence{ID: NewID(), Matchers: matchers(t, "level=attention"), StartsAt: now, EndsAt: now.Add(time.Hour), Comment: "load test"}
+	err := f.Update(func(s []Silence) ([]Silence, error) { return append(s, add), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Update(func(s []Silence) ([]Silence, error) { return nil, errors.New("abort") })
+	if err == nil {
+		t.Error("want fn's error")
+	}
+	silences, err := f.Load()
+	if err != nil || len(silences) != 1 || silences[0].ID != add.ID {
+		t.Fatalf("got %+v, %v", silences, err)
+	}
+	labels := Labels("", notify.Event{Level: "attention"})
+	if Find(silences, labels, now) == nil || Find(silences, labels, now.Add(2*time.Hour)) != nil {
+		t.Error("loaded silence should match while active")
+	}
+}